@@ -0,0 +1,33 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+)
+
+// Profiles are the named states which a long run can rotate across.
+var Profiles = map[string]func() *sqlgen.State{
+	"gbk":                 NewGBKState,
+	"multi-schema-change": NewMultiSchemaChangeState,
+	"tidb600":             NewStateForTiDB600,
+}
+
+// NewProfileState creates the state of the named profile.
+func NewProfileState(name string) (*sqlgen.State, error) {
+	newState, ok := Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, available profiles: %v", name, ProfileNames())
+	}
+	return newState(), nil
+}
+
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
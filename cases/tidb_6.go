@@ -10,5 +10,9 @@ func NewStateForTiDB600() *State {
 	state.SetWeight(FlashBackTable, 0)
 	// TiDB does not support LIST partition by default.
 	state.SetWeight(PartitionDefinitionList, 0)
+	// TiDB supports MEMBER OF since v6.3.0.
+	state.SetWeight(ExprJSONMemberOf, 0)
+	// TiDB supports WITH ROLLUP since v7.4.0.
+	state.SetWeight(GroupByWithRollup, 0)
 	return state
 }
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"context"
-	"database/sql"
 	"fmt"
 	"math/rand"
 	"os"
@@ -18,8 +15,6 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"github.com/zyguan/sqlz"
-	"github.com/zyguan/sqlz/resultset"
 )
 
 func rootCmd() *cobra.Command {
@@ -41,6 +36,7 @@ func checkSyntaxCmd() *cobra.Command {
 		dsn        string
 		failfast   bool
 		outputFile string
+		timeout    time.Duration
 	)
 	cmd := &cobra.Command{
 		Use:           "check-syntax",
@@ -50,44 +46,55 @@ func checkSyntaxCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			parseAndSetSeed(seed)
 			fileWriter := newFileWriter(outputFile)
-			conn := setUpDatabaseConnection(dsn)
+			executor, err := newExecutor(dsn, timeout)
+			if err != nil {
+				return err
+			}
+			defer executor.Close()
 
 			state := cases.NewMultiSchemaChangeState()
 			queries := generatePlainSQLs(state, stmtCount)
 			// queries := generateCreateTables(state, stmtCount)
-
-			for i, query := range queries {
-				if debug {
-					fmt.Printf("-- statement seq: %d\n", i)
-					fmt.Println(query + ";")
-				}
-				fileWriter.writeSQL(query)
-				_, err := executeQuery(conn, query)
-				if err != nil {
-					fmt.Println(query)
-					errMsg := strings.ToLower(err.Error())
-					if strings.Contains(errMsg, "error") &&
-						strings.Contains(errMsg, "error 1064") {
-						return err
-					}
-					fmt.Println(colorizeErrorMsg(err))
-					if failfast {
-						return err
-					}
-				}
-			}
-			return nil
+			return runSyntaxCheck(executor, queries, fileWriter, debug, failfast)
 		},
 	}
-	cmd.Flags().StringVar(&dsn, "dsn", "", "dsn for database")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "dsn for database, or 'dry-run' to print the statements only")
 	cmd.Flags().IntVar(&stmtCount, "count", 100, "number of statements to run")
 	cmd.Flags().StringVar(&seed, "seed", "1", "random seed")
 	cmd.Flags().BoolVar(&debug, "debug", false, "print generated SQLs")
 	cmd.Flags().BoolVar(&failfast, "failfast", false, "fail on any error")
 	cmd.Flags().StringVar(&outputFile, "out", "", "the file path to put the generated SQLs")
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultStmtTimeout, "timeout of each statement")
 	return cmd
 }
 
+func runSyntaxCheck(executor Executor, queries []string, fileWriter *fileWriter, debug, failfast bool) error {
+	for i, query := range queries {
+		if debug {
+			fmt.Printf("-- statement seq: %d\n", i)
+			fmt.Println(query + ";")
+		}
+		fileWriter.writeSQL(query)
+		_, err := execute(executor, query)
+		if execErr, ok := asExecError(err); ok && execErr.Kind != execErrKindTimeout {
+			return errors.Errorf("statement seq %d: %v", i, execErr)
+		}
+		if err != nil {
+			fmt.Println(query)
+			errMsg := strings.ToLower(err.Error())
+			if strings.Contains(errMsg, "error") &&
+				strings.Contains(errMsg, "error 1064") {
+				return err
+			}
+			fmt.Println(colorizeErrorMsg(err))
+			if failfast {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func colorizeErrorMsg(msg error) string {
 	if msg == nil {
 		return ""
@@ -151,13 +158,21 @@ func (f *fileWriter) writeSQL(query string) {
 
 func abtestCmd() *cobra.Command {
 	var (
-		stmtCount   int
-		dsn1        string
-		dsn2        string
-		sqlFilePath string
-		logPath     string
-		seed        string
-		debug       bool
+		stmtCount        int
+		dsn1             string
+		dsn2             string
+		sqlFilePath      string
+		logPath          string
+		seed             string
+		debug            bool
+		epsilon          float64
+		timeout          time.Duration
+		duration         time.Duration
+		resetInterval    time.Duration
+		progressInterval time.Duration
+		profiles         []string
+		failureDir       string
+		failfast         bool
 	)
 	cmd := &cobra.Command{
 		Use:           "abtest",
@@ -167,99 +182,150 @@ func abtestCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			parsedSeed := parseAndSetSeed(seed)
 
-			conn1 := setUpDatabaseConnection(dsn1)
-			conn2 := setUpDatabaseConnection(dsn2)
-
-			state := cases.NewMultiSchemaChangeState()
-			queries := generateInitialSQLs(state)
-			queries = append(queries, generatePlainSQLs(state, stmtCount)...)
-
-			for _, query := range queries {
-				if debug {
-					fmt.Println(query + ";")
-				}
-				rs1, err1 := executeQuery(conn1, query)
-				rs2, err2 := executeQuery(conn2, query)
-				if debug {
-					fmt.Println(colorizeErrorMsg(err1))
-					fmt.Println(colorizeErrorMsg(err2))
-				}
-				if !ValidateErrs(err1, err2) {
-					msg := fmt.Sprintf("error mismatch: %v != %v\nseed: %d\nquery: %s", err1, err2, parsedSeed, query)
-					return errors.Errorf(msg)
-				}
-				if rs1 == nil || rs2 == nil {
-					continue
-				}
-				if debug {
-					fmt.Println(rs1.String())
-					fmt.Println(rs2.String())
-				}
-				if err := compareResult(rs1, rs2, query); err != nil {
-					return err
-				}
+			executor1, err := newExecutor(dsn1, timeout)
+			if err != nil {
+				return err
 			}
-			return nil
+			defer executor1.Close()
+			executor2, err := newExecutor(dsn2, timeout)
+			if err != nil {
+				return err
+			}
+			defer executor2.Close()
+
+			runner := newSoakRunner(executor1, executor2, soakOptions{
+				abtestOptions: abtestOptions{
+					seed:    parsedSeed,
+					debug:   debug,
+					epsilon: epsilon,
+				},
+				count:            stmtCount,
+				duration:         duration,
+				resetInterval:    resetInterval,
+				progressInterval: progressInterval,
+				profiles:         profiles,
+				failureDir:       failureDir,
+				failfast:         failfast,
+				out:              os.Stdout,
+			})
+			return runner.run()
 		},
 	}
-	cmd.Flags().IntVar(&stmtCount, "count", 100, "number of statements to run")
-	cmd.Flags().StringVar(&dsn1, "dsn1", "", "dsn for 1st database")
-	cmd.Flags().StringVar(&dsn2, "dsn2", "", "dsn for 2nd database")
+	cmd.Flags().IntVar(&stmtCount, "count", 100, "number of statements to run, 0 means no limit")
+	cmd.Flags().StringVar(&dsn1, "dsn1", "", "dsn for 1st database, or 'dry-run' to print the statements only")
+	cmd.Flags().StringVar(&dsn2, "dsn2", "", "dsn for 2nd database, or 'dry-run' to print the statements only")
 	cmd.Flags().StringVar(&sqlFilePath, "sqlfile", "rand.sql", "running SQLs")
 	cmd.Flags().StringVar(&logPath, "log", "", "The output of 2 databases")
 	cmd.Flags().StringVar(&seed, "seed", "1", "random seed")
 	cmd.Flags().BoolVar(&debug, "debug", false, "print generated SQLs")
+	cmd.Flags().Float64Var(&epsilon, "float-epsilon", defaultFloatEpsilon, "relative epsilon to compare float values")
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultStmtTimeout, "timeout of each statement")
+	cmd.Flags().DurationVar(&duration, "duration", 0, "how long to run, 0 means no limit")
+	cmd.Flags().DurationVar(&resetInterval, "reset-interval", 0, "drop the database and start with a fresh state periodically, 0 means never")
+	cmd.Flags().DurationVar(&progressInterval, "progress-interval", 10*time.Second, "how often to print the progress, 0 means never")
+	cmd.Flags().StringSliceVar(&profiles, "profiles", []string{"multi-schema-change"},
+		fmt.Sprintf("case profiles to rotate across on every reset, available: %v", cases.ProfileNames()))
+	cmd.Flags().StringVar(&failureDir, "failure-dir", "", "the directory to save a bug report bundle for every failure, the failures are only printed if empty")
+	cmd.Flags().BoolVar(&failfast, "failfast", false, "stop at the first failure")
 	return cmd
 }
 
-func setUpDatabaseConnection(dsn string) *sql.Conn {
-	ctx := context.Background()
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		panic(err)
+type abtestOptions struct {
+	seed    int64
+	debug   bool
+	epsilon float64
+}
+
+const (
+	mismatchKindError  = "error mismatch"
+	mismatchKindResult = "result mismatch"
+)
+
+// stmtOutcome is the outcome of running a statement on both sides.
+type stmtOutcome struct {
+	err1, err2 error
+	// fatal is set if the environment cannot continue, e.g. the server crashed.
+	fatal   error
+	skipped bool
+	// diverged is set if only one side failed because of the environment. The statement may have been
+	// applied on the other side, so the data of both sides may differ from now on.
+	diverged bool
+	// mismatchKind is not empty if the outcomes of both sides differ.
+	mismatchKind string
+	mismatch     error
+}
+
+func compareStatement(executor1, executor2 Executor, state *sqlgen.State, query string, opts abtestOptions) stmtOutcome {
+	return compareQueries(executor1, query, executor2, query, state, opts)
+}
+
+// compareQueries runs query1 on executor1 and query2 on executor2, which are expected to have the same outcome.
+func compareQueries(executor1 Executor, query1 string, executor2 Executor, query2 string,
+	state *sqlgen.State, opts abtestOptions) stmtOutcome {
+	if opts.debug {
+		fmt.Println(query1 + ";")
+		if query2 != query1 {
+			fmt.Println(query2 + ";")
+		}
 	}
-	dbName := "sqlgen_test"
-	conn, err := sqlz.Connect(ctx, db)
-	if err != nil {
-		panic(err)
+	rs1, err1 := execute(executor1, query1)
+	rs2, err2 := execute(executor2, query2)
+	if opts.debug {
+		fmt.Println(colorizeErrorMsg(err1))
+		fmt.Println(colorizeErrorMsg(err2))
 	}
-	_, err = conn.ExecContext(ctx, "drop database if exists "+dbName)
-	if err != nil {
-		panic(err)
+	outcome := stmtOutcome{err1: err1, err2: err2}
+	if skip, diverged, err := checkExecErrs(err1, err2); err != nil {
+		outcome.fatal = err
+		return outcome
+	} else if skip {
+		outcome.skipped, outcome.diverged = true, diverged
+		return outcome
 	}
-	_, err = conn.ExecContext(ctx, "create database "+dbName)
-	if err != nil {
-		panic(err)
+	if !ValidateErrs(err1, err2) {
+		outcome.mismatchKind = mismatchKindError
+		outcome.mismatch = fmt.Errorf("error mismatch: %v != %v", err1, err2)
+		return outcome
 	}
-	_, err = conn.ExecContext(ctx, "use "+dbName)
-	if err != nil {
-		panic(err)
+	if rs1 == nil || rs2 == nil {
+		return outcome
 	}
-	_, err = conn.ExecContext(ctx, "SET GLOBAL sql_mode=(SELECT REPLACE(@@sql_mode,'ONLY_FULL_GROUP_BY',''));")
-	if err != nil {
-		panic(err)
+	if opts.debug {
+		fmt.Println(rs1.String())
+		fmt.Println(rs2.String())
+	}
+	if err := compareResult(rs1, rs2, query1, NewCompareOptions(state, query1, opts.epsilon)); err != nil {
+		outcome.mismatchKind = mismatchKindResult
+		outcome.mismatch = err
 	}
-	return conn
+	return outcome
 }
 
-func executeQuery(conn *sql.Conn, query string) (*resultset.ResultSet, error) {
-	ctx := context.Background()
-	err := conn.PingContext(ctx)
-	if err != nil {
-		return nil, err
+// newExecutor connects to the dsn and sets up the test database.
+// A dsn of "dry-run" prints the statements instead of running them.
+func newExecutor(dsn string, timeout time.Duration) (Executor, error) {
+	var executor Executor
+	if dsn == dryRunDSN {
+		executor = newDryRunExecutor(os.Stdout)
+	} else {
+		mysqlExecutor, err := newMySQLExecutor(dsn, timeout)
+		if err != nil {
+			return nil, err
+		}
+		executor = mysqlExecutor
 	}
-	rows, err := conn.QueryContext(ctx, query)
-	if err != nil {
+	if err := executor.SetUp(); err != nil {
+		executor.Close()
 		return nil, err
 	}
-	defer rows.Close()
-	return resultset.ReadFromRows(rows)
+	return executor, nil
 }
 
-func executeAndPrint(conn *sql.Conn, query string) {
-	rs, err := executeQuery(conn, query)
+func executeAndPrint(executor Executor, query string) {
+	rs, err := execute(executor, query)
 	if err != nil {
 		fmt.Println(err.Error())
+		return
 	}
 	rs.PrettyPrint(os.Stdout)
 }
@@ -267,7 +333,9 @@ func executeAndPrint(conn *sql.Conn, query string) {
 func generateInitialSQLs(state *sqlgen.State) []string {
 	tableCount, columnCount := 5, 5
 	indexCount, rowCount := 2, 10
-	sqls := make([]string, 0, tableCount+tableCount*rowCount)
+	sqls := make([]string, 0, 1+tableCount+tableCount*rowCount)
+	// The CHECK constraints are enabled as the new state assumes, though they may be left off by the last epoch.
+	sqls = append(sqls, "set @@global.tidb_enable_check_constraint = 1")
 	state.SetRepeat(sqlgen.ColumnDefinition, columnCount, columnCount)
 	state.SetRepeat(sqlgen.IndexDefinition, indexCount, indexCount)
 	for i := 0; i < tableCount; i++ {
@@ -318,21 +386,6 @@ func generateCreateTables(state *sqlgen.State, count int) []string {
 	return sqls
 }
 
-func compareResult(rs1, rs2 *resultset.ResultSet, query string) error {
-	h1, h2 := rs1.OrderedDigest(resultset.DigestOptions{}), rs2.OrderedDigest(resultset.DigestOptions{})
-	if h1 != h2 {
-		var b1, b2 bytes.Buffer
-		rs1.PrettyPrint(&b1)
-		rs2.PrettyPrint(&b2)
-		return fmt.Errorf("result digests mismatch: %s != %s %q\n%s\n%s", h1, h2, query, b1.String(), b2.String())
-	}
-	if rs1.IsExecResult() && rs1.ExecResult().RowsAffected != rs2.ExecResult().RowsAffected {
-		return fmt.Errorf("rows affected mismatch: %d != %d %q",
-			rs1.ExecResult().RowsAffected, rs2.ExecResult().RowsAffected, query)
-	}
-	return nil
-}
-
 func printCmd() *cobra.Command {
 	var count int
 	cmd := &cobra.Command{
@@ -342,12 +395,15 @@ func printCmd() *cobra.Command {
 		SilenceUsage:  true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			state := sqlgen.NewState()
+			executor := newDryRunExecutor(os.Stdout)
 			for i := 0; i < count; i++ {
 				query, err := sqlgen.Start.Eval(state)
 				if err != nil {
 					panic(err)
 				}
-				fmt.Printf("%s;\n", query)
+				if _, err := execute(executor, query); err != nil {
+					return err
+				}
 			}
 			return nil
 		},
@@ -356,6 +412,26 @@ func printCmd() *cobra.Command {
 	return cmd
 }
 
+// checkExecErrs reports the environment errors of the two executions.
+// Crashes and hangs stop the test, while timeouts and connection resets skip the statement.
+// If only one side is interrupted, the statement may have been applied on the other side,
+// so both sides are regarded as diverged.
+func checkExecErrs(err1, err2 error) (skip bool, diverged bool, err error) {
+	interrupted := 0
+	for _, e := range []error{err1, err2} {
+		execErr, ok := asExecError(e)
+		if !ok {
+			continue
+		}
+		if execErr.Kind == execErrKindCrash || execErr.Kind == execErrKindHang {
+			return true, false, execErr
+		}
+		log.Warn("skip the statement", zap.Stringer("kind", execErr.Kind), zap.Error(execErr))
+		interrupted++
+	}
+	return interrupted > 0, interrupted == 1, nil
+}
+
 func ValidateErrs(err1 error, err2 error) bool {
 	ignoreErrMsgs := []string{
 		"with index covered now",                         // 4.0 cannot drop column with index
@@ -381,6 +457,56 @@ func ValidateErrs(err1 error, err2 error) bool {
 	return (err1 == nil && err2 == nil) || (err1 != nil && err2 != nil)
 }
 
+var (
+	// expectedErrCodes are the errors which the generated statements may raise legitimately,
+	// e.g. an overflow in arithmetic or an invalid value in CAST.
+	expectedErrCodes = []uint16{
+		1690, // ER_DATA_OUT_OF_RANGE: BIGINT UNSIGNED value is out of range
+		3140, // ER_INVALID_JSON_TEXT
+		3141, // ER_INVALID_JSON_TEXT_IN_PARAM
+		3143, // ER_INVALID_JSON_PATH
+		3149, // ER_INVALID_JSON_PATH_WILDCARD
+		3156, // ER_INVALID_JSON_VALUE_FOR_CAST
+	}
+	// strictErrCodes are raised instead of warnings if the sql_mode is strict.
+	strictErrCodes = []uint16{
+		1264, // ER_WARN_DATA_OUT_OF_RANGE
+		1292, // ER_TRUNCATED_WRONG_VALUE
+		1365, // ER_DIVISION_BY_ZERO
+		1366, // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+		1406, // ER_DATA_TOO_LONG
+		1411, // ER_WRONG_VALUE_FOR_TYPE
+		1441, // ER_DATETIME_FUNCTION_OVERFLOW
+	}
+)
+
+// expectedErrors returns the codes of the expected errors under the sql_mode.
+func expectedErrors(sqlMode string) map[uint16]struct{} {
+	codes := make(map[uint16]struct{})
+	for _, code := range expectedErrCodes {
+		codes[code] = struct{}{}
+	}
+	if strings.Contains(sqlMode, "STRICT_TRANS_TABLES") || strings.Contains(sqlMode, "STRICT_ALL_TABLES") {
+		for _, code := range strictErrCodes {
+			codes[code] = struct{}{}
+		}
+	}
+	return codes
+}
+
+// isExpectedErr reports whether err is nil or one of the expected errors.
+func isExpectedErr(err error, expected map[uint16]struct{}) bool {
+	if err == nil {
+		return true
+	}
+	code, ok := errorCode(err)
+	if !ok {
+		return false
+	}
+	_, ok = expected[code]
+	return ok
+}
+
 func OneOfContains(err1, err2 error, msg string) bool {
 	c1 := err1 != nil && strings.Contains(err1.Error(), msg) && err2 == nil
 	c2 := err2 != nil && strings.Contains(err2.Error(), msg) && err1 == nil
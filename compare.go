@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+const defaultFloatEpsilon = 1e-6
+
+// CompareOptions controls how tolerant compareResult is when two cells differ in their raw bytes.
+type CompareOptions struct {
+	// FloatEpsilon is the relative epsilon used to compare FLOAT and DOUBLE values.
+	FloatEpsilon float64
+	// Columns are the generated columns of the result columns by position, which tell the collations
+	// and whether the values are allocated by the server. They are nil for the computed result columns.
+	Columns []*sqlgen.Column
+	// Ordered means the query has a top-level ORDER BY, so the rows are compared by position.
+	Ordered bool
+}
+
+// NewCompareOptions resolves the result columns of the query which select the columns of the state,
+// so that they can be compared according to their collations.
+func NewCompareOptions(state *sqlgen.State, query string, floatEpsilon float64) CompareOptions {
+	opts := CompareOptions{FloatEpsilon: floatEpsilon, Ordered: isOrderedQuery(query)}
+	if state != nil {
+		opts.Columns = resultColumns(query, state)
+	}
+	return opts
+}
+
+// isOrderedQuery means the rows returned by the query are ordered by a top-level ORDER BY.
+func isOrderedQuery(query string) bool {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return false
+	}
+	switch x := stmt.(type) {
+	case *ast.SelectStmt:
+		return x.OrderBy != nil
+	case *ast.SetOprStmt:
+		return x.OrderBy != nil
+	}
+	return false
+}
+
+// column returns the generated column of the j-th result column, or nil if it is unknown.
+func (o CompareOptions) column(j int) *sqlgen.Column {
+	if j < len(o.Columns) {
+		return o.Columns[j]
+	}
+	return nil
+}
+
+func (o CompareOptions) caseInsensitive(j int) bool {
+	col := o.column(j)
+	if col == nil || col.Collation == nil || !col.Tp.IsStringType() {
+		return false
+	}
+	return strings.HasSuffix(col.Collation.CollationName, "_ci")
+}
+
+// autoAllocated means the values of the column are allocated by AUTO_INCREMENT or AUTO_RANDOM,
+// which may differ between the servers.
+func (o CompareOptions) autoAllocated(j int) bool {
+	col := o.column(j)
+	return col != nil && col.IsAutoAllocated()
+}
+
+// resultColumns returns the generated columns selected by the fields of a SELECT statement by position.
+// The columns are looked up by the table or alias which qualifies them, so the same names in different
+// tables are not confused. The result columns after a wildcard which cannot be expanded are unknown.
+func resultColumns(query string, state *sqlgen.State) []*sqlgen.Column {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return nil
+	}
+	sel, ok := stmt.(*ast.SelectStmt)
+	if !ok || sel.From == nil || sel.Fields == nil {
+		return nil
+	}
+	sources := make(map[string]*sqlgen.Table)
+	var tables []*sqlgen.Table
+	// The columns of the derived tables and the CTEs are unknown, and the joined columns may be coalesced.
+	unknown, coalesced := false, false
+	var collect func(n ast.ResultSetNode)
+	collect = func(n ast.ResultSetNode) {
+		switch x := n.(type) {
+		case *ast.Join:
+			collect(x.Left)
+			if x.Right != nil {
+				collect(x.Right)
+			}
+			coalesced = coalesced || x.NaturalJoin || len(x.Using) > 0
+		case *ast.TableSource:
+			tn, ok := x.Source.(*ast.TableName)
+			if !ok {
+				unknown = true
+				return
+			}
+			tbl := state.Tables.ByName(tn.Name.L)
+			if tbl == nil {
+				tbl = state.Views.ByName(tn.Name.L)
+			}
+			if tbl == nil {
+				unknown = true
+				return
+			}
+			name := tn.Name.L
+			if x.AsName.L != "" {
+				name = x.AsName.L
+			}
+			sources[name] = tbl
+			tables = append(tables, tbl)
+		default:
+			unknown = true
+		}
+	}
+	collect(sel.From.TableRefs)
+	var cols []*sqlgen.Column
+	for _, f := range sel.Fields.Fields {
+		if f.WildCard != nil {
+			expanded := tables
+			if f.WildCard.Table.L != "" {
+				expanded = []*sqlgen.Table{sources[f.WildCard.Table.L]}
+			} else if unknown || coalesced {
+				return cols
+			}
+			for _, tbl := range expanded {
+				if tbl == nil {
+					return cols
+				}
+				cols = append(cols, tbl.Columns...)
+			}
+			continue
+		}
+		var col *sqlgen.Column
+		if e, ok := f.Expr.(*ast.ColumnNameExpr); ok {
+			col = lookupColumn(e.Name, sources, tables, unknown)
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// lookupColumn finds the column by the qualified name in sources, or by the unqualified name in tables
+// if it is unique.
+func lookupColumn(name *ast.ColumnName, sources map[string]*sqlgen.Table, tables []*sqlgen.Table, unknown bool) *sqlgen.Column {
+	byName := func(c *sqlgen.Column) bool {
+		return c.Name == name.Name.L
+	}
+	if name.Table.L != "" {
+		if tbl := sources[name.Table.L]; tbl != nil {
+			if found := tbl.Columns.Filter(byName); len(found) == 1 {
+				return found[0]
+			}
+		}
+		return nil
+	}
+	if unknown {
+		return nil
+	}
+	var found sqlgen.Columns
+	for _, tbl := range tables {
+		found = append(found, tbl.Columns.Filter(byName)...)
+	}
+	if len(found) != 1 {
+		return nil
+	}
+	return found[0]
+}
+
+type cellKind int8
+
+const (
+	cellKindRaw cellKind = iota
+	cellKindFloat
+	cellKindDecimal
+	cellKindJSON
+	cellKindCIString
+	cellKindMasked
+)
+
+type normalizedCell struct {
+	null bool
+	val  string
+	num  float64
+}
+
+type normalizedRow []normalizedCell
+
+func compareResult(rs1, rs2 *resultset.ResultSet, query string, opts CompareOptions) error {
+	if rs1.IsExecResult() != rs2.IsExecResult() {
+		return fmt.Errorf("result type mismatch: %s != %s %q", rs1.String(), rs2.String(), query)
+	}
+	if rs1.IsExecResult() {
+		if rs1.ExecResult().RowsAffected != rs2.ExecResult().RowsAffected {
+			return fmt.Errorf("rows affected mismatch: %d != %d %q",
+				rs1.ExecResult().RowsAffected, rs2.ExecResult().RowsAffected, query)
+		}
+		return nil
+	}
+	h1, h2 := rs1.OrderedDigest(resultset.DigestOptions{}), rs2.OrderedDigest(resultset.DigestOptions{})
+	if h1 == h2 {
+		return nil
+	}
+	if err := tolerantEqual(rs1, rs2, opts); err != nil {
+		var b1, b2 bytes.Buffer
+		rs1.PrettyPrint(&b1)
+		rs2.PrettyPrint(&b2)
+		return fmt.Errorf("result digests mismatch: %s != %s (%v) %q\n%s\n%s",
+			h1, h2, err, query, b1.String(), b2.String())
+	}
+	return nil
+}
+
+// tolerantEqual compares two result sets after normalizing every cell. The rows of an ordered query are
+// compared by position, and the other rows are matched regardless of the order.
+func tolerantEqual(rs1, rs2 *resultset.ResultSet, opts CompareOptions) error {
+	if rs1.NCols() != rs2.NCols() {
+		return fmt.Errorf("column count mismatch: %d != %d", rs1.NCols(), rs2.NCols())
+	}
+	if rs1.NRows() != rs2.NRows() {
+		return fmt.Errorf("row count mismatch: %d != %d", rs1.NRows(), rs2.NRows())
+	}
+	kinds := make([]cellKind, rs1.NCols())
+	for j := range kinds {
+		kinds[j] = columnCellKind(j, rs1.ColumnDef(j), rs2.ColumnDef(j), opts)
+	}
+	rows1, rows2 := normalizeRows(rs1, kinds), normalizeRows(rs2, kinds)
+	if opts.Ordered {
+		for i := range rows1 {
+			if !rowEqual(rows1[i], rows2[i], kinds, opts.FloatEpsilon) {
+				return fmt.Errorf("row %d mismatch", i)
+			}
+		}
+		return nil
+	}
+	matched := make([]bool, len(rows2))
+	for i, r1 := range rows1 {
+		found := false
+		for k, r2 := range rows2 {
+			if matched[k] || !rowEqual(r1, r2, kinds, opts.FloatEpsilon) {
+				continue
+			}
+			matched[k], found = true, true
+			break
+		}
+		if !found {
+			return fmt.Errorf("row %d of the first result set has no counterpart", i)
+		}
+	}
+	return nil
+}
+
+func columnCellKind(j int, def1, def2 resultset.ColumnDef, opts CompareOptions) cellKind {
+	isType := func(tps ...string) bool {
+		for _, tp := range tps {
+			if def1.Type == tp || def2.Type == tp {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case opts.autoAllocated(j):
+		return cellKindMasked
+	case isType("FLOAT", "DOUBLE"):
+		return cellKindFloat
+	case isType("DECIMAL"):
+		return cellKindDecimal
+	case isType("JSON"):
+		return cellKindJSON
+	case opts.caseInsensitive(j):
+		return cellKindCIString
+	}
+	return cellKindRaw
+}
+
+func normalizeRows(rs *resultset.ResultSet, kinds []cellKind) []normalizedRow {
+	rows := make([]normalizedRow, rs.NRows())
+	for i := range rows {
+		row := make(normalizedRow, rs.NCols())
+		for j := range row {
+			raw, _ := rs.RawValue(i, j)
+			row[j] = normalizeCell(raw, kinds[j])
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+func normalizeCell(raw []byte, kind cellKind) normalizedCell {
+	if raw == nil {
+		return normalizedCell{null: true}
+	}
+	val := string(raw)
+	switch kind {
+	case cellKindFloat:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return normalizedCell{val: val, num: f}
+		}
+	case cellKindDecimal:
+		return normalizedCell{val: normalizeDecimal(val)}
+	case cellKindJSON:
+		return normalizedCell{val: normalizeJSON(val)}
+	case cellKindCIString:
+		return normalizedCell{val: strings.ToLower(val)}
+	case cellKindMasked:
+		// Only the presence of an allocated ID is compared.
+		return normalizedCell{}
+	}
+	return normalizedCell{val: val}
+}
+
+func rowEqual(r1, r2 normalizedRow, kinds []cellKind, epsilon float64) bool {
+	for j := range r1 {
+		c1, c2 := r1[j], r2[j]
+		if c1.null || c2.null {
+			if c1.null != c2.null {
+				return false
+			}
+			continue
+		}
+		if kinds[j] == cellKindFloat && floatEqual(c1.num, c2.num, epsilon) {
+			continue
+		}
+		if c1.val != c2.val {
+			return false
+		}
+	}
+	return true
+}
+
+// floatEqual compares the values by a relative epsilon, so that the small values are not all equal.
+func floatEqual(a, b, epsilon float64) bool {
+	if a == b {
+		return true
+	}
+	return math.Abs(a-b) <= epsilon*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// normalizeDecimal removes the trailing zeros of the fractional part, e.g. "1.2300" -> "1.23".
+func normalizeDecimal(val string) string {
+	if strings.Contains(val, ".") {
+		val = strings.TrimRight(val, "0")
+		val = strings.TrimSuffix(val, ".")
+	}
+	if val == "-0" || val == "" {
+		return "0"
+	}
+	return val
+}
+
+// normalizeJSON re-encodes a JSON document with sorted keys, no whitespace and canonical numbers.
+// The integers are kept as they are, so only the fractional numbers are rounded.
+func normalizeJSON(val string) string {
+	dec := json.NewDecoder(strings.NewReader(val))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return val
+	}
+	bs, err := json.Marshal(canonicalJSONNumbers(doc))
+	if err != nil {
+		return val
+	}
+	return string(bs)
+}
+
+func canonicalJSONNumbers(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for k, sub := range v {
+			v[k] = canonicalJSONNumbers(sub)
+		}
+	case []interface{}:
+		for i, sub := range v {
+			v[i] = canonicalJSONNumbers(sub)
+		}
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return v
+		}
+		if f, err := v.Float64(); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', 15, 64))
+		}
+	}
+	return doc
+}
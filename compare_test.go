@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/stretchr/testify/require"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+func newTestResultSet(cols []resultset.ColumnDef, rows ...[]string) *resultset.ResultSet {
+	rs := resultset.New(cols)
+	for _, r := range rows {
+		row := rs.AllocateRow()
+		for j, v := range r {
+			*row[j].(*[]byte) = []byte(v)
+		}
+	}
+	return rs
+}
+
+func TestCompareResultTolerant(t *testing.T) {
+	ci := &sqlgen.Column{Name: "col_1", Tp: sqlgen.ColumnTypeVarchar, Collation: sqlgen.Collations[sqlgen.CollationUtf8mb4GeneralCI]}
+	bin := &sqlgen.Column{Name: "col_2", Tp: sqlgen.ColumnTypeVarchar, Collation: sqlgen.Collations[sqlgen.CollationUtf8mb4Bin]}
+	autoInc := &sqlgen.Column{Name: "col_3", Tp: sqlgen.ColumnTypeBigInt, IsAutoIncrement: true}
+	autoRand := &sqlgen.Column{Name: "col_4", Tp: sqlgen.ColumnTypeBigInt, AutoRandomBits: 5}
+	cases := []struct {
+		tp    string
+		col   *sqlgen.Column
+		v1    string
+		v2    string
+		equal bool
+	}{
+		{"DOUBLE", nil, "0.30000000000000004", "0.3", true},
+		{"DOUBLE", nil, "1e-7", "2e-7", false},
+		{"DOUBLE", nil, "-1e-300", "-1.0000000000001e-300", true},
+		{"FLOAT", nil, "3.1416", "3.1415", false},
+		{"FLOAT", nil, "12121212", "12131212", false},
+		{"DECIMAL", nil, "1.2300", "1.23", true},
+		{"DECIMAL", nil, "10.00", "10", true},
+		{"DECIMAL", nil, "10", "1", false},
+		{"JSON", nil, `{"b": 1, "a": [1, 2]}`, `{"a":[1,2],"b":1}`, true},
+		{"JSON", nil, `323232323.3232323232`, `323232323.32323235`, true},
+		{"JSON", nil, `{"a": 1}`, `{"a": 2}`, false},
+		{"JSON", nil, `{"a": 1234567890123456789}`, `{"a": 1234567890123456788}`, false},
+		{"JSON", nil, `[1, 2.50]`, `[1,2.5]`, true},
+		{"VARCHAR", ci, "Alice", "alice", true},
+		{"VARCHAR", bin, "Alice", "alice", false},
+		{"VARCHAR", nil, "Alice", "alice", false},
+		{"BIGINT", autoInc, "1", "30001", true},
+		{"BIGINT", autoRand, "1152921504606846977", "2", true},
+		{"BIGINT", nil, "1", "30001", false},
+	}
+	for _, c := range cases {
+		opts := CompareOptions{FloatEpsilon: defaultFloatEpsilon, Columns: []*sqlgen.Column{c.col}}
+		cols := []resultset.ColumnDef{{Name: "r0", Type: c.tp}}
+		rs1 := newTestResultSet(cols, []string{c.v1})
+		rs2 := newTestResultSet(cols, []string{c.v2})
+		err := compareResult(rs1, rs2, "select 1", opts)
+		if c.equal {
+			require.NoError(t, err, "%s: %s vs %s", c.tp, c.v1, c.v2)
+		} else {
+			require.Error(t, err, "%s: %s vs %s", c.tp, c.v1, c.v2)
+		}
+	}
+}
+
+func TestResultColumns(t *testing.T) {
+	// The tables have the same column names, e.g. a table created by LIKE, but different collations.
+	ci := &sqlgen.Column{Name: "col_1", Tp: sqlgen.ColumnTypeVarchar, Collation: sqlgen.Collations[sqlgen.CollationUtf8mb4GeneralCI]}
+	bin := &sqlgen.Column{Name: "col_1", Tp: sqlgen.ColumnTypeVarchar, Collation: sqlgen.Collations[sqlgen.CollationUtf8mb4Bin]}
+	id := &sqlgen.Column{Name: "col_2", Tp: sqlgen.ColumnTypeBigInt, IsAutoIncrement: true}
+	state := sqlgen.NewState()
+	state.Tables = append(state.Tables,
+		&sqlgen.Table{Name: "tbl_1", Columns: sqlgen.Columns{ci, id}},
+		&sqlgen.Table{Name: "tbl_2", Columns: sqlgen.Columns{bin}})
+	cases := []struct {
+		query string
+		cols  []*sqlgen.Column
+	}{
+		{"select tbl_2.col_1 as r0, tbl_1.col_1 as r1, 1 as r2 from tbl_1 join tbl_2", []*sqlgen.Column{bin, ci, nil}},
+		{"select ta_1.col_1, col_2 from tbl_2 as ta_1 join tbl_1", []*sqlgen.Column{bin, id}},
+		{"select col_1 from tbl_1 join tbl_2", []*sqlgen.Column{nil}},
+		{"select * from tbl_2 join tbl_1", []*sqlgen.Column{bin, ci, id}},
+		{"select tbl_1.*, col_1 from tbl_1", []*sqlgen.Column{ci, id, ci}},
+		{"select *, col_1 from tbl_1 join tbl_2 using (col_1)", nil},
+		{"select col_1 from (select * from tbl_1) as dt_1", []*sqlgen.Column{nil}},
+		{"select ??? from tbl_1", nil},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.cols, resultColumns(c.query, state), c.query)
+	}
+
+	// The same name is compared by the collation of the column at the position.
+	cols := []resultset.ColumnDef{{Name: "col_1", Type: "VARCHAR"}, {Name: "col_1", Type: "VARCHAR"}}
+	query := "select tbl_1.col_1, tbl_2.col_1 from tbl_1 join tbl_2"
+	opts := NewCompareOptions(state, query, defaultFloatEpsilon)
+	rs1 := newTestResultSet(cols, []string{"Alice", "Bob"})
+	require.NoError(t, compareResult(rs1, newTestResultSet(cols, []string{"alice", "Bob"}), query, opts))
+	require.Error(t, compareResult(rs1, newTestResultSet(cols, []string{"Alice", "bob"}), query, opts))
+}
+
+func TestCompareResultIgnoreRowOrder(t *testing.T) {
+	cols := []resultset.ColumnDef{{Name: "r0", Type: "DOUBLE"}, {Name: "r1", Type: "DECIMAL"}}
+	rs1 := newTestResultSet(cols, []string{"1.0000001", "2.50"}, []string{"3", "4"})
+	rs2 := newTestResultSet(cols, []string{"3", "4.000"}, []string{"1", "2.5"})
+	rs3 := newTestResultSet(cols, []string{"3", "4"}, []string{"3", "4"})
+	rs4 := newTestResultSet(cols, []string{"1", "2.5"}, []string{"3", "4.000"})
+	// The rows of an unordered query are matched regardless of the order.
+	query := "select r0, r1 from tbl_1"
+	opts := NewCompareOptions(nil, query, defaultFloatEpsilon)
+	require.False(t, opts.Ordered)
+	require.NoError(t, compareResult(rs1, rs2, query, opts))
+	require.Error(t, compareResult(rs1, rs3, query, opts))
+	// The rows of an ordered query, including a top-N query, are compared by position.
+	for _, query := range []string{
+		"select r0, r1 from tbl_1 order by r0",
+		"select r0, r1 from tbl_1 order by r0 limit 2",
+		"(select r0, r1 from tbl_1) union all (select r0, r1 from tbl_2) order by 1",
+	} {
+		opts := NewCompareOptions(nil, query, defaultFloatEpsilon)
+		require.True(t, opts.Ordered, query)
+		require.Error(t, compareResult(rs1, rs2, query, opts), query)
+		require.NoError(t, compareResult(rs1, rs4, query, opts), query)
+	}
+	// The ORDER BY in a subquery does not order the result.
+	require.False(t, isOrderedQuery("select * from (select r0 from tbl_1 order by r0) as dt_1"))
+}
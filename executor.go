@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+// Executor runs the generated statements. It decouples the test runners from database/sql,
+// so that they can run against a real server, a recorder or an in-process fake.
+type Executor interface {
+	// Name identifies the executor in reports, e.g. the DSN.
+	Name() string
+	// SetUp prepares a clean database and the session for a test.
+	SetUp() error
+	// Exec runs a statement which returns no rows.
+	Exec(query string) (*resultset.ResultSet, error)
+	// Query runs a statement which returns rows.
+	Query(query string) (*resultset.ResultSet, error)
+	Close() error
+}
+
+// execute dispatches the statement to Exec or Query according to its leading keyword.
+func execute(e Executor, query string) (*resultset.ResultSet, error) {
+	if returnsRows(query) {
+		return e.Query(query)
+	}
+	return e.Exec(query)
+}
+
+func returnsRows(query string) bool {
+	s := strings.ToLower(strings.TrimLeft(query, " \t\n("))
+	if isWithDML(s) {
+		return false
+	}
+	for _, prefix := range []string{"select", "with", "show", "explain", "desc", "admin", "values", "table"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithDML reports whether the statement is an UPDATE or a DELETE with a WITH clause.
+func isWithDML(query string) bool {
+	if !strings.HasPrefix(strings.ToLower(strings.TrimLeft(query, " \t\n(")), "with") {
+		return false
+	}
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return false
+	}
+	switch stmt.(type) {
+	case *ast.UpdateStmt, *ast.DeleteStmt:
+		return true
+	}
+	return false
+}
+
+const dryRunDSN = "dry-run"
+
+var _ Executor = (*dryRunExecutor)(nil)
+
+// dryRunExecutor records the statements without running them.
+type dryRunExecutor struct {
+	out        io.Writer
+	Statements []string
+}
+
+func newDryRunExecutor(out io.Writer) *dryRunExecutor {
+	return &dryRunExecutor{out: out}
+}
+
+func (d *dryRunExecutor) Name() string {
+	return "dry-run"
+}
+
+func (d *dryRunExecutor) SetUp() error {
+	return nil
+}
+
+func (d *dryRunExecutor) Exec(query string) (*resultset.ResultSet, error) {
+	d.record(query)
+	return resultset.NewFromResult(fakeResult{}), nil
+}
+
+func (d *dryRunExecutor) Query(query string) (*resultset.ResultSet, error) {
+	d.record(query)
+	return resultset.New([]resultset.ColumnDef{{Name: "dry-run"}}), nil
+}
+
+func (d *dryRunExecutor) record(query string) {
+	d.Statements = append(d.Statements, query)
+	if d.out != nil {
+		fmt.Fprintf(d.out, "%s;\n", query)
+	}
+}
+
+func (d *dryRunExecutor) Close() error {
+	return nil
+}
+
+var _ Executor = (*fakeExecutor)(nil)
+
+// fakeExecutor is an in-process executor for unit tests. Every statement is answered by Respond,
+// and an exec result with no affected rows is returned if Respond is nil.
+type fakeExecutor struct {
+	name    string
+	Respond func(query string) (*resultset.ResultSet, error)
+
+	mu         sync.Mutex
+	Statements []string
+	closed     bool
+}
+
+func newFakeExecutor(name string, respond func(query string) (*resultset.ResultSet, error)) *fakeExecutor {
+	return &fakeExecutor{name: name, Respond: respond}
+}
+
+func (f *fakeExecutor) Name() string {
+	return f.name
+}
+
+func (f *fakeExecutor) SetUp() error {
+	return nil
+}
+
+func (f *fakeExecutor) Exec(query string) (*resultset.ResultSet, error) {
+	return f.run(query)
+}
+
+func (f *fakeExecutor) Query(query string) (*resultset.ResultSet, error) {
+	return f.run(query)
+}
+
+func (f *fakeExecutor) run(query string) (*resultset.ResultSet, error) {
+	f.mu.Lock()
+	f.Statements = append(f.Statements, query)
+	f.mu.Unlock()
+	if f.Respond == nil {
+		return resultset.NewFromResult(fakeResult{}), nil
+	}
+	return f.Respond(query)
+}
+
+func (f *fakeExecutor) Close() error {
+	f.closed = true
+	return nil
+}
+
+// fakeResult implements sql.Result to build exec results without a server.
+type fakeResult struct {
+	rowsAffected int64
+	lastInsertID int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/log"
+	"github.com/zyguan/sqlz"
+	"github.com/zyguan/sqlz/resultset"
+	"go.uber.org/zap"
+)
+
+const (
+	testDBName = "sqlgen_test"
+
+	defaultStmtTimeout = 60 * time.Second
+	killQueryTimeout   = 10 * time.Second
+	reconnectTimeout   = 30 * time.Second
+)
+
+type execErrKind int8
+
+const (
+	// execErrKindTimeout means the statement exceeded the timeout and was killed.
+	execErrKindTimeout execErrKind = iota
+	// execErrKindHang means the statement exceeded the timeout and the server cannot be reached after that.
+	execErrKindHang
+	// execErrKindConnReset means the connection was broken, but the server is still alive.
+	execErrKindConnReset
+	// execErrKindCrash means the server cannot be reached anymore.
+	execErrKindCrash
+)
+
+func (k execErrKind) String() string {
+	switch k {
+	case execErrKindTimeout:
+		return "timeout"
+	case execErrKindHang:
+		return "hang"
+	case execErrKindConnReset:
+		return "connection reset"
+	case execErrKindCrash:
+		return "server crash"
+	}
+	return "unknown"
+}
+
+// execError is an error caused by the environment instead of the statement semantics.
+type execError struct {
+	Kind  execErrKind
+	DSN   string
+	Query string
+	Err   error
+}
+
+func (e *execError) Error() string {
+	return fmt.Sprintf("%s on %s: %v, query: %s", e.Kind, e.DSN, e.Err, e.Query)
+}
+
+func (e *execError) Unwrap() error {
+	return e.Err
+}
+
+// asExecError returns the execError if err is caused by the environment.
+func asExecError(err error) (*execError, bool) {
+	var e *execError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+var _ Executor = (*mysqlExecutor)(nil)
+
+// sessionVar is a session variable and the statement which sets it, e.g. sql_mode and set @@sql_mode = ”.
+type sessionVar struct {
+	name string
+	stmt string
+}
+
+// mysqlExecutor runs statements on a MySQL protocol connection, which survives
+// statement timeouts and connection resets. The session state is restored after reconnecting.
+type mysqlExecutor struct {
+	dsn     string
+	db      *sql.DB
+	conn    *sql.Conn
+	connID  int64
+	timeout time.Duration
+
+	// sessionVars records the last successful statement which sets every session variable,
+	// in the order the variables are first set.
+	sessionVars []sessionVar
+	inTxn       bool
+	// tempTables records the local temporary tables, which belong to the session instead of the database.
+	tempTables []string
+}
+
+func newMySQLExecutor(dsn string, timeout time.Duration) (*mysqlExecutor, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	c := &mysqlExecutor{dsn: dsn, db: db, timeout: timeout}
+	if err := c.connect(); err != nil {
+		return nil, &execError{Kind: execErrKindCrash, DSN: dsn, Query: "connect", Err: err}
+	}
+	return c, nil
+}
+
+// SetUp recreates the database. The local temporary tables are not dropped with the database,
+// so they are dropped one by one. The session variables set by the previous test are not restored anymore.
+func (c *mysqlExecutor) SetUp() error {
+	c.sessionVars = nil
+	stmts := make([]string, 0, len(c.tempTables)+3)
+	for _, tbl := range c.tempTables {
+		stmts = append(stmts, "drop temporary table if exists "+tbl)
+	}
+	c.tempTables = nil
+	for _, s := range append(stmts,
+		"drop database if exists "+testDBName,
+		"create database "+testDBName,
+		"use "+testDBName,
+	) {
+		if _, err := c.conn.ExecContext(context.Background(), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *mysqlExecutor) connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+	conn, err := sqlz.Connect(ctx, c.db)
+	if err != nil {
+		return err
+	}
+	if err := conn.QueryRowContext(ctx, "select connection_id()").Scan(&c.connID); err != nil {
+		conn.Close()
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// reconnect opens a new connection and restores the session state.
+// An open transaction cannot be restored, so it is regarded as aborted.
+func (c *mysqlExecutor) reconnect() error {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if _, err := c.conn.ExecContext(ctx, "use "+testDBName); err != nil {
+		return err
+	}
+	for _, v := range c.sessionVars {
+		if _, err := c.conn.ExecContext(ctx, v.stmt); err != nil {
+			log.Warn("restore session variable failed", zap.String("stmt", v.stmt), zap.Error(err))
+		}
+	}
+	if c.inTxn {
+		log.Warn("the transaction is aborted by reconnecting", zap.String("dsn", c.dsn))
+		c.inTxn = false
+	}
+	if len(c.tempTables) > 0 {
+		log.Warn("the local temporary tables are dropped by reconnecting", zap.String("dsn", c.dsn),
+			zap.Strings("tables", c.tempTables))
+		c.tempTables = nil
+	}
+	return nil
+}
+
+func (c *mysqlExecutor) Name() string {
+	return c.dsn
+}
+
+func (c *mysqlExecutor) Close() error {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	return c.db.Close()
+}
+
+func (c *mysqlExecutor) Exec(query string) (*resultset.ResultSet, error) {
+	return c.run(query, func(ctx context.Context) (*resultset.ResultSet, error) {
+		res, err := c.conn.ExecContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return resultset.NewFromResult(res), nil
+	})
+}
+
+func (c *mysqlExecutor) Query(query string) (*resultset.ResultSet, error) {
+	return c.run(query, func(ctx context.Context) (*resultset.ResultSet, error) {
+		rows, err := c.conn.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		return resultset.ReadFromRows(rows)
+	})
+}
+
+// run executes the statement with a timeout. Errors returned by the server are returned as they are,
+// while timeouts, broken connections and crashes are reported as *execError.
+func (c *mysqlExecutor) run(query string, do func(ctx context.Context) (*resultset.ResultSet, error)) (*resultset.ResultSet, error) {
+	if c.conn == nil {
+		if err := c.reconnect(); err != nil {
+			return nil, &execError{Kind: execErrKindCrash, DSN: c.dsn, Query: query, Err: err}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	rs, err := do(ctx)
+	if err == nil {
+		c.trackSession(query)
+		return rs, nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, c.handleTimeout(query, err)
+	}
+	if isConnBroken(err) {
+		return nil, c.handleBrokenConn(query, err)
+	}
+	return nil, err
+}
+
+// handleTimeout stops the timed out statement and reconnects. The statement is regarded as hanging
+// only if the server cannot be reached after that.
+func (c *mysqlExecutor) handleTimeout(query string, cause error) error {
+	if err := c.killQuery(); err != nil {
+		log.Warn("kill query failed", zap.String("dsn", c.dsn), zap.Error(err))
+	}
+	// The driver discards the connection once the context is canceled.
+	if err := c.reconnect(); err != nil {
+		return &execError{Kind: execErrKindHang, DSN: c.dsn, Query: query, Err: err}
+	}
+	return &execError{Kind: execErrKindTimeout, DSN: c.dsn, Query: query, Err: cause}
+}
+
+func (c *mysqlExecutor) handleBrokenConn(query string, cause error) error {
+	if err := c.reconnect(); err != nil {
+		return &execError{Kind: execErrKindCrash, DSN: c.dsn, Query: query, Err: cause}
+	}
+	return &execError{Kind: execErrKindConnReset, DSN: c.dsn, Query: query, Err: cause}
+}
+
+// killQuery stops the running statement from another connection. TiDB needs KILL TIDB QUERY unless
+// the global kill is enabled. The connection is usually closed by the driver already, in which case
+// the statement has been stopped and the thread is unknown.
+func (c *mysqlExecutor) killQuery() error {
+	ctx, cancel := context.WithTimeout(context.Background(), killQueryTimeout)
+	defer cancel()
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, kill := range []string{"kill query %d", "kill tidb query %d"} {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(kill, c.connID))
+		if err == nil || isUnknownThread(err) {
+			return nil
+		}
+	}
+	return err
+}
+
+// isUnknownThread reports whether err is ER_NO_SUCH_THREAD, i.e. the connection to kill is gone.
+func isUnknownThread(err error) bool {
+	code, ok := errorCode(err)
+	return ok && code == 1094
+}
+
+// trackSession records the statements which change the session state. The query must have succeeded.
+func (c *mysqlExecutor) trackSession(query string) {
+	for _, stmt := range strings.Split(query, ";") {
+		s := strings.ToLower(strings.TrimSpace(stmt))
+		switch {
+		case strings.HasPrefix(s, "begin"), strings.HasPrefix(s, "start transaction"):
+			c.inTxn = true
+		case strings.HasPrefix(s, "commit"), strings.HasPrefix(s, "rollback"):
+			c.inTxn = false
+		case strings.HasPrefix(s, "set ") && !strings.Contains(s, "@@global.") && !strings.HasPrefix(s, "set global"):
+			c.setSessionVar(strings.TrimSpace(stmt))
+		case strings.HasPrefix(s, "create temporary table "):
+			c.tempTables = append(c.tempTables, strings.Fields(s)[3])
+		case strings.HasPrefix(s, "drop temporary table "), strings.HasPrefix(s, "drop table "):
+			fields := strings.Fields(s)
+			tbl := fields[len(fields)-1]
+			for i, t := range c.tempTables {
+				if t == tbl {
+					c.tempTables = append(c.tempTables[:i], c.tempTables[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// setSessionVar records the statement which sets a session variable, which replaces the previous one
+// of the same variable. The user variables, e.g. the parameters of the prepared statements, are not restored.
+func (c *mysqlExecutor) setSessionVar(stmt string) {
+	name := sessionVarName(stmt)
+	if name == "" {
+		return
+	}
+	for i, v := range c.sessionVars {
+		if v.name == name {
+			c.sessionVars[i].stmt = stmt
+			return
+		}
+	}
+	c.sessionVars = append(c.sessionVars, sessionVar{name: name, stmt: stmt})
+}
+
+// sessionVarName returns the name of the first variable set by the statement, e.g. sql_mode for
+// set @@session.sql_mode = ”. It returns an empty string for a user variable.
+func sessionVarName(stmt string) string {
+	s := strings.TrimSpace(strings.ToLower(stmt)[len("set "):])
+	for _, prefix := range []string{"session ", "local ", "@@session.", "@@local.", "@@"} {
+		if strings.HasPrefix(s, prefix) {
+			s = strings.TrimSpace(s[len(prefix):])
+			break
+		}
+	}
+	if strings.HasPrefix(s, "@") {
+		return ""
+	}
+	if i := strings.IndexAny(s, " =:,"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+func isConnBroken(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackSession(t *testing.T) {
+	c := &mysqlExecutor{}
+	c.trackSession("set @@tidb_enable_clustered_index = 1")
+	c.trackSession("set @@global.tidb_row_format_version = 2")
+	c.trackSession("begin pessimistic ; insert into t values (1)")
+	require.True(t, c.inTxn)
+	require.Equal(t, []sessionVar{{"tidb_enable_clustered_index", "set @@tidb_enable_clustered_index = 1"}}, c.sessionVars)
+	// The last statement of every variable is restored, while the user variables are not.
+	c.trackSession("set @i0 = 1")
+	c.trackSession("set @@session.sql_mode = ''")
+	c.trackSession("set @@tidb_enable_clustered_index = 0")
+	require.Equal(t, []sessionVar{
+		{"tidb_enable_clustered_index", "set @@tidb_enable_clustered_index = 0"},
+		{"sql_mode", "set @@session.sql_mode = ''"},
+	}, c.sessionVars)
+	c.trackSession("update t set a = 1 ; commit")
+	require.False(t, c.inTxn)
+	c.trackSession("create temporary table tbl_1 (a int)")
+	c.trackSession("create global temporary table tbl_2 (a int) on commit delete rows")
+	c.trackSession("create temporary table tbl_3 (a int)")
+	c.trackSession("drop temporary table tbl_1")
+	require.Equal(t, []string{"tbl_3"}, c.tempTables)
+	c.trackSession("drop table tbl_3")
+	require.Empty(t, c.tempTables)
+}
+
+func TestIsConnBroken(t *testing.T) {
+	require.True(t, isConnBroken(driver.ErrBadConn))
+	require.True(t, isConnBroken(fmt.Errorf("read: %w", io.EOF)))
+	require.True(t, isConnBroken(mysql.ErrInvalidConn))
+	require.False(t, isConnBroken(&mysql.MySQLError{Number: 1064, Message: "syntax error"}))
+}
+
+func TestIsUnknownThread(t *testing.T) {
+	require.True(t, isUnknownThread(&mysql.MySQLError{Number: 1094, Message: "Unknown thread id: 7"}))
+	require.False(t, isUnknownThread(&mysql.MySQLError{Number: 1105, Message: "unknown error"}))
+	require.False(t, isUnknownThread(driver.ErrBadConn))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+func TestExecuteDispatch(t *testing.T) {
+	var out bytes.Buffer
+	executor := newDryRunExecutor(&out)
+	rs, err := execute(executor, "( select 1 ) union ( select 2 )")
+	require.NoError(t, err)
+	require.False(t, rs.IsExecResult())
+	rs, err = execute(executor, "insert into t values (1)")
+	require.NoError(t, err)
+	require.True(t, rs.IsExecResult())
+	require.Len(t, executor.Statements, 2)
+	require.Equal(t, "( select 1 ) union ( select 2 );\ninsert into t values (1);\n", out.String())
+
+	// The statement after the WITH clause decides whether rows are returned.
+	require.True(t, returnsRows("with cte_1 (col_1) as (select 1) select * from cte_1"))
+	withUpdate := "with cte_1 (col_1) as (select 1) update t set a = 1 where a in (select col_1 from cte_1)"
+	require.False(t, returnsRows(withUpdate))
+	require.Equal(t, "explain "+withUpdate, explainStmt(withUpdate))
+}
+
+func TestSoakRunnerOffline(t *testing.T) {
+	cols := []resultset.ColumnDef{{Name: "r0", Type: "BIGINT"}}
+	same := func(query string) (*resultset.ResultSet, error) {
+		if strings.HasPrefix(query, "select") {
+			return newTestResultSet(cols, []string{"1"}), nil
+		}
+		return resultset.NewFromResult(fakeResult{rowsAffected: 1}), nil
+	}
+	opts := soakOptions{
+		abtestOptions: abtestOptions{epsilon: defaultFloatEpsilon},
+		count:         50,
+		profiles:      []string{"multi-schema-change", "tidb600"},
+	}
+	e1, e2 := newFakeExecutor("a", same), newFakeExecutor("b", same)
+	runner := newSoakRunner(e1, e2, opts)
+	require.NoError(t, runner.run())
+	require.Equal(t, e1.Statements, e2.Statements)
+	require.Equal(t, 50, runner.generated)
+	require.Len(t, e1.Statements, runner.stmts)
+	require.Equal(t, 1, runner.epoch)
+
+	// Result mismatches are saved, and every failure starts a new epoch with the next profile.
+	diff := newFakeExecutor("c", func(query string) (*resultset.ResultSet, error) {
+		if strings.HasPrefix(query, "select") {
+			return newTestResultSet(cols, []string{"2"}), nil
+		}
+		return same(query)
+	})
+	dir := t.TempDir()
+	failureOpts := opts
+	failureOpts.failureDir = dir
+	runner = newSoakRunner(newFakeExecutor("a", same), diff, failureOpts)
+	err := runner.run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf("found %d failures in %d buckets", runner.failures, runner.buckets.Len()))
+	require.Equal(t, runner.failures+1, runner.epoch)
+	// Only the smallest example of every bucket is saved.
+	for _, bucket := range runner.buckets.Sorted() {
+		saved, err := os.ReadFile(filepath.Join(dir, bundleDirName(bucket.Hash), "repro.sql"))
+		require.NoError(t, err)
+		require.Contains(t, string(saved), bucket.Smallest.Query)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, runner.buckets.Len())
+
+	// Error mismatch stops the test at once with failfast.
+	failed := newFakeExecutor("d", func(query string) (*resultset.ResultSet, error) {
+		return nil, errors.New("Error 1105: unknown error")
+	})
+	failfastOpts := opts
+	failfastOpts.failfast = true
+	err = newSoakRunner(newFakeExecutor("a", same), failed, failfastOpts).run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error mismatch")
+
+	// Timeouts skip the statement, while crashes stop the test.
+	timeout := newFakeExecutor("e", func(query string) (*resultset.ResultSet, error) {
+		return nil, &execError{Kind: execErrKindTimeout, Query: query, Err: errors.New("deadline")}
+	})
+	runner = newSoakRunner(newFakeExecutor("a", same), timeout, opts)
+	require.NoError(t, runner.run())
+	require.Equal(t, runner.stmts, runner.skipped)
+	// A statement interrupted on one side only may have been applied on the other side.
+	require.Equal(t, runner.stmts, runner.divergences)
+	runner = newSoakRunner(timeout, timeout, opts)
+	require.NoError(t, runner.run())
+	require.Equal(t, runner.stmts, runner.skipped)
+	require.Zero(t, runner.divergences)
+	crash := newFakeExecutor("f", func(query string) (*resultset.ResultSet, error) {
+		return nil, &execError{Kind: execErrKindCrash, Query: query, Err: errors.New("EOF")}
+	})
+	err = newSoakRunner(newFakeExecutor("a", same), crash, opts).run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "statement seq 0 caused server crash")
+}
+
+func TestSoakRunnerViewOracle(t *testing.T) {
+	cols := []resultset.ColumnDef{{Name: "c", Type: "BIGINT"}}
+	// The server returns a different row from the views than from the inlined queries.
+	wrongView := func(query string) (*resultset.ResultSet, error) {
+		switch {
+		case regexp.MustCompile(`^select \* from v_\d+$`).MatchString(query):
+			return newTestResultSet(cols, []string{"2"}), nil
+		case strings.HasPrefix(query, "select"):
+			return newTestResultSet(cols, []string{"1"}), nil
+		}
+		return resultset.NewFromResult(fakeResult{}), nil
+	}
+	runner := newSoakRunner(newFakeExecutor("a", wrongView), newFakeExecutor("b", wrongView), soakOptions{
+		abtestOptions: abtestOptions{epsilon: defaultFloatEpsilon},
+		count:         1000,
+		failfast:      true,
+	})
+	err := runner.run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "inlined")
+	require.Equal(t, 1, runner.byFn[viewOracleFn].mismatches)
+}
+
+func TestSoakRunnerSequenceOracle(t *testing.T) {
+	cols := []resultset.ColumnDef{{Name: "v", Type: "BIGINT"}}
+	// The server returns a different value from NEXTVAL than from the expected value.
+	wrongSequence := func(query string) (*resultset.ResultSet, error) {
+		switch {
+		case strings.HasPrefix(query, "select nextval("):
+			return newTestResultSet(cols, []string{"-1000"}), nil
+		case strings.HasPrefix(query, "select"):
+			return newTestResultSet(cols, []string{"1"}), nil
+		}
+		return resultset.NewFromResult(fakeResult{}), nil
+	}
+	runner := newSoakRunner(newFakeExecutor("a", wrongSequence), newFakeExecutor("b", wrongSequence), soakOptions{
+		abtestOptions: abtestOptions{epsilon: defaultFloatEpsilon},
+		count:         3000,
+		failfast:      true,
+	})
+	err := runner.run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected")
+	require.Equal(t, 1, runner.byFn[sequenceOracleFn].mismatches)
+}
+
+func TestJournalStmts(t *testing.T) {
+	failed := stmtOutcome{err1: errors.New("Error 1062: Duplicate entry"), err2: errors.New("Error 1062: Duplicate entry")}
+	require.Equal(t, "insert into t values (1)", journalStmts("insert into t values (1)", stmtOutcome{}))
+	require.Empty(t, journalStmts("insert into t values (1)", failed))
+	require.Empty(t, journalStmts("insert into t values (1)", stmtOutcome{skipped: true}))
+	// The transaction has begun before the failed statement.
+	require.Equal(t, "begin pessimistic", journalStmts("begin pessimistic ; insert into t values (1)", failed))
+	require.Empty(t, journalStmts("insert into t values (1) ; commit", failed))
+}
+
+func TestSoakRunnerDuration(t *testing.T) {
+	runner := newSoakRunner(newFakeExecutor("a", nil), newFakeExecutor("b", nil), soakOptions{
+		duration: 100 * time.Millisecond,
+	})
+	require.NoError(t, runner.run())
+	require.Greater(t, runner.generated, 0)
+}
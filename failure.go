@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	_ "github.com/pingcap/tidb/parser/test_driver"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+// reproDBName is the database created by repro.sql, so that a repro never drops the test database.
+const reproDBName = "sqlgen_repro"
+
+// bundleSysVars are the system variables which may change the behavior of the generated statements.
+var bundleSysVars = []string{
+	"sql_mode", "time_zone", "character_set_connection", "collation_connection",
+	"div_precision_increment", "tidb_enable_clustered_index", "tidb_partition_prune_mode",
+	"tidb_isolation_read_engines", "tidb_enable_vectorized_expression",
+}
+
+// failureKindFatal is the kind of the failures which stop the test, e.g. a server crash.
+const failureKindFatal = "fatal"
+
+// failure records a divergence between the two sides.
+type failure struct {
+	ID      int
+	Seed    int64
+	Epoch   int
+	Profile string
+	// Seq is the sequence number of the statement in the epoch.
+	Seq   int
+	Fn    string
+	Kind  string
+	Query string
+	Err   error
+	// Err1 and Err2 are the errors returned by both sides.
+	Err1, Err2 error
+	// Journal is the statements of the epoch which run before the failed one.
+	Journal []string
+}
+
+func (f *failure) Summary() string {
+	return fmt.Sprintf("%s in %s (epoch %d, seq %d)", f.Kind, f.Fn, f.Epoch, f.Seq)
+}
+
+// bundle is a self-contained bug report of a failure. It can be reproduced by `mysql < repro.sql`.
+type bundle struct {
+	files map[string]string
+}
+
+// newBundle collects the schema, data, plans and environment of a failure from both sides.
+// Any error from the servers is recorded in the bundle instead of being returned,
+// because the servers may be in a bad state after the failure.
+func newBundle(f *failure, executor1, executor2 Executor, state *sqlgen.State) *bundle {
+	b := &bundle{files: make(map[string]string)}
+	tables := touchedTables(f.Query, state)
+	sequences := touchedSequences(f.Query, tables, state)
+
+	var schema, data strings.Builder
+	for _, seq := range sequences {
+		fmt.Fprintf(&schema, "%s;\n", showCreate(executor1, "sequence", seq))
+	}
+	for _, tbl := range tables {
+		fmt.Fprintf(&schema, "%s;\n", showCreate(executor1, "table", tbl))
+		if state == nil || state.Views.ByName(tbl) == nil {
+			fmt.Fprint(&data, dumpTable(executor1, tbl, writableColumns(tbl, state)))
+		}
+	}
+	b.files["schema.sql"] = schema.String()
+	b.files["data.sql"] = data.String()
+	// The foreign keys are not checked while the tables are created and filled, in case the tables
+	// reference each other.
+	if schema.Len() > 0 {
+		b.files["schema.sql"] = "set foreign_key_checks = 0;\n" + schema.String() + "set foreign_key_checks = 1;\n"
+	}
+	if data.Len() > 0 {
+		b.files["data.sql"] = "set foreign_key_checks = 0;\n" + data.String() + "set foreign_key_checks = 1;\n"
+	}
+	b.files["query.sql"] = f.Query + ";\n"
+	b.files["error.txt"] = fmt.Sprintf("%s\n%v\n", f.Kind, f.Err)
+	b.files["journal.sql"] = joinStatements(f.Journal)
+
+	if explain := explainStmt(f.Query); explain != "" {
+		b.files["explain_1.txt"] = fmt.Sprintf("-- %s\n%s", executor1.Name(), queryText(executor1, explain))
+		b.files["explain_2.txt"] = fmt.Sprintf("-- %s\n%s", executor2.Name(), queryText(executor2, explain))
+	}
+
+	var env strings.Builder
+	fmt.Fprintf(&env, "seed: %d\nprofile: %s\nepoch: %d\nseq: %d\nfn: %s\n", f.Seed, f.Profile, f.Epoch, f.Seq, f.Fn)
+	sysVarsQuery := fmt.Sprintf("show variables where variable_name in ('%s')", strings.Join(bundleSysVars, "', '"))
+	for _, e := range []Executor{executor1, executor2} {
+		fmt.Fprintf(&env, "\n-- %s\n", e.Name())
+		fmt.Fprint(&env, queryText(e, "select version()"))
+		fmt.Fprint(&env, queryText(e, sysVarsQuery))
+	}
+	b.files["env.txt"] = env.String()
+
+	var repro strings.Builder
+	fmt.Fprintf(&repro, "drop database if exists %s;\ncreate database %s;\nuse %s;\n", reproDBName, reproDBName, reproDBName)
+	if returnsRows(f.Query) && len(sequences) == 0 {
+		repro.WriteString(b.files["schema.sql"])
+		repro.WriteString(b.files["data.sql"])
+	} else {
+		// The data has been changed by the failed statement, or the current values of the sequences
+		// cannot be dumped, so replay the whole epoch instead.
+		repro.WriteString(b.files["journal.sql"])
+	}
+	repro.WriteString(b.files["query.sql"])
+	b.files["repro.sql"] = repro.String()
+	b.files["issue.md"] = issueBody(f, b, executor1, executor2)
+	return b
+}
+
+func (b *bundle) save(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, content := range b.files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bundleDirName(bucket string) string {
+	return "bucket_" + bucket
+}
+
+const issueJournalExcerpt = 20
+
+func issueBody(f *failure, b *bundle, executor1, executor2 Executor) string {
+	var sb strings.Builder
+	sb.WriteString("## Bug Report\n\n")
+	sb.WriteString("### 1. Minimal reproduce step\n\n")
+	sb.WriteString("```sql\n")
+	sb.WriteString(b.files["repro.sql"])
+	sb.WriteString("```\n\n")
+	sb.WriteString("### 2. What did you expect to see?\n\n")
+	fmt.Fprintf(&sb, "The same result as `%s`.\n\n", executor2.Name())
+	sb.WriteString("### 3. What did you see instead?\n\n")
+	fmt.Fprintf(&sb, "%s on `%s`:\n\n```\n%v\n```\n\n", f.Kind, executor1.Name(), f.Err)
+	for _, name := range []string{"explain_1.txt", "explain_2.txt"} {
+		if plan, ok := b.files[name]; ok {
+			fmt.Fprintf(&sb, "```\n%s```\n\n", plan)
+		}
+	}
+	sb.WriteString("### 4. What is your TiDB version?\n\n")
+	fmt.Fprintf(&sb, "```\n%s```\n\n", b.files["env.txt"])
+	journal := f.Journal
+	if len(journal) > issueJournalExcerpt {
+		journal = journal[len(journal)-issueJournalExcerpt:]
+	}
+	fmt.Fprintf(&sb, "<details><summary>The last %d statements before the failure</summary>\n\n", len(journal))
+	fmt.Fprintf(&sb, "```sql\n%s```\n\n</details>\n", joinStatements(journal))
+	return sb.String()
+}
+
+// explainStmt returns the statement to show the plan of query, or empty if it has no plan.
+// EXPLAIN ANALYZE runs the statement, so it is only used for read-only queries. A query which takes
+// the values of the sequences is not read-only.
+func explainStmt(query string) string {
+	s := strings.ToLower(strings.TrimLeft(query, " \t\n("))
+	if isWithDML(s) || sequenceNameRegexp.MatchString(s) {
+		return "explain " + query
+	}
+	for _, prefix := range []string{"select", "with"} {
+		if strings.HasPrefix(s, prefix) {
+			return "explain analyze " + query
+		}
+	}
+	for _, prefix := range []string{"insert", "replace", "update", "delete"} {
+		if strings.HasPrefix(s, prefix) {
+			return "explain " + query
+		}
+	}
+	return ""
+}
+
+var tableNameRegexp = regexp.MustCompile(`\b(tbl|v)_\d+\b`)
+
+// touchedTables returns the names of the generated tables which the query reads or writes, in order.
+// The tables read by the views and the tables referenced by the foreign keys are touched as well.
+// The referenced tables come before the tables referencing them, and the views come after the tables
+// in the order of definition.
+func touchedTables(query string, state *sqlgen.State) []string {
+	names := make(map[string]struct{})
+	if stmt, err := parser.New().ParseOneStmt(query, "", ""); err == nil {
+		stmt.Accept(&tableNameCollector{names: names})
+	} else {
+		for _, name := range tableNameRegexp.FindAllString(query, -1) {
+			names[name] = struct{}{}
+		}
+	}
+	tables := make([]string, 0, len(names))
+	if state == nil {
+		for name := range names {
+			tables = append(tables, name)
+		}
+		sort.Strings(tables)
+		return tables
+	}
+	var views sqlgen.Tables
+	seen := make(map[string]bool)
+	var touch func(name string)
+	touch = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		// CTEs and aliases are parsed as table names as well.
+		if view := state.Views.ByName(name); view != nil {
+			for _, dep := range view.View.Deps {
+				touch(dep.Name)
+			}
+			views = append(views, view)
+		} else if tbl := state.Tables.ByName(name); tbl != nil {
+			for _, fk := range tbl.ForeignKeys {
+				touch(fk.RefTable.Name)
+			}
+			tables = append(tables, name)
+		}
+	}
+	for name := range names {
+		touch(name)
+	}
+	sort.Strings(tables)
+	tables = parentsFirst(tables, state)
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].ID < views[j].ID
+	})
+	for _, view := range views {
+		tables = append(tables, view.Name)
+	}
+	return tables
+}
+
+// parentsFirst orders the tables so that the referenced tables come before the tables referencing them,
+// and keeps the order of the others.
+func parentsFirst(tables []string, state *sqlgen.State) []string {
+	touched := make(map[string]bool, len(tables))
+	for _, name := range tables {
+		touched[name] = true
+	}
+	ordered := make([]string, 0, len(tables))
+	placed := make(map[string]bool, len(tables))
+	var place func(name string)
+	place = func(name string) {
+		if placed[name] || !touched[name] {
+			return
+		}
+		placed[name] = true
+		for _, fk := range state.Tables.ByName(name).ForeignKeys {
+			place(fk.RefTable.Name)
+		}
+		ordered = append(ordered, name)
+	}
+	for _, name := range tables {
+		place(name)
+	}
+	return ordered
+}
+
+var sequenceNameRegexp = regexp.MustCompile(`\bseq_\d+\b`)
+
+// touchedSequences returns the names of the generated sequences which the query reads, and the sequences
+// of the default values of the touched tables, in order.
+func touchedSequences(query string, tables []string, state *sqlgen.State) []string {
+	names := make(map[string]struct{})
+	for _, name := range sequenceNameRegexp.FindAllString(query, -1) {
+		names[name] = struct{}{}
+	}
+	if state != nil {
+		for _, name := range tables {
+			tbl := state.Tables.ByName(name)
+			if tbl == nil {
+				continue
+			}
+			for _, c := range tbl.Columns {
+				if c.DefaultSeq != nil {
+					names[c.DefaultSeq.Name] = struct{}{}
+				}
+			}
+		}
+	}
+	sequences := make([]string, 0, len(names))
+	for name := range names {
+		sequences = append(sequences, name)
+	}
+	sort.Strings(sequences)
+	return sequences
+}
+
+type tableNameCollector struct {
+	names map[string]struct{}
+}
+
+func (c *tableNameCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if tn, ok := n.(*ast.TableName); ok {
+		c.names[tn.Name.L] = struct{}{}
+	}
+	return n, false
+}
+
+func (c *tableNameCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// showCreate returns the definition of the object, which is a table or a sequence.
+func showCreate(e Executor, object, name string) string {
+	rs, err := e.Query(fmt.Sprintf("show create %s %s", object, name))
+	if err != nil {
+		return fmt.Sprintf("-- show create %s %s: %v", object, name, err)
+	}
+	if rs.NRows() == 0 || rs.NCols() < 2 {
+		return fmt.Sprintf("-- show create %s %s: no result", object, name)
+	}
+	raw, _ := rs.RawValue(0, 1)
+	return string(raw)
+}
+
+// writableColumns returns the names of the columns of the table which can be inserted, i.e. the columns
+// which are not generated. It returns nil if the table is unknown, in which case all the columns are dumped.
+func writableColumns(table string, state *sqlgen.State) []string {
+	if state == nil {
+		return nil
+	}
+	tbl := state.Tables.ByName(table)
+	if tbl == nil {
+		return nil
+	}
+	var cols []string
+	for _, c := range tbl.WritableColumns() {
+		cols = append(cols, c.Name)
+	}
+	return cols
+}
+
+// dumpTable dumps the columns cols of the rows of the table as INSERT statements,
+// or all the columns if cols is empty.
+func dumpTable(e Executor, table string, cols []string) string {
+	fields, colList := "*", ""
+	if len(cols) > 0 {
+		fields = strings.Join(cols, ", ")
+		colList = " (" + fields + ")"
+	}
+	rs, err := e.Query(fmt.Sprintf("select %s from %s", fields, table))
+	if err != nil {
+		return fmt.Sprintf("-- dump %s: %v\n", table, err)
+	}
+	var sb strings.Builder
+	for i := 0; i < rs.NRows(); i++ {
+		values := make([]string, rs.NCols())
+		for j := range values {
+			raw, _ := rs.RawValue(i, j)
+			values[j] = sqlLiteral(raw, rs.ColumnDef(j))
+		}
+		fmt.Fprintf(&sb, "insert into %s%s values (%s);\n", table, colList, strings.Join(values, ", "))
+	}
+	return sb.String()
+}
+
+func sqlLiteral(raw []byte, def resultset.ColumnDef) string {
+	if raw == nil {
+		return "NULL"
+	}
+	switch def.Type {
+	case "BIT", "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB":
+		if len(raw) == 0 {
+			return "''"
+		}
+		return "0x" + hex.EncodeToString(raw)
+	}
+	s := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(string(raw))
+	return "'" + s + "'"
+}
+
+// queryText runs the query and returns the pretty-printed result or the error.
+func queryText(e Executor, query string) string {
+	rs, err := e.Query(query)
+	if err != nil {
+		return fmt.Sprintf("%s: %v\n", query, err)
+	}
+	var buf bytes.Buffer
+	rs.PrettyPrint(&buf)
+	return buf.String()
+}
+
+func joinStatements(stmts []string) string {
+	var sb strings.Builder
+	for _, stmt := range stmts {
+		sb.WriteString(stmt)
+		sb.WriteString(";\n")
+	}
+	return sb.String()
+}
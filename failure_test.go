@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/stretchr/testify/require"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+func TestTouchedTables(t *testing.T) {
+	state := sqlgen.NewState()
+	for _, name := range []string{"tbl_1", "tbl_2", "tbl_3"} {
+		state.Tables = append(state.Tables, &sqlgen.Table{Name: name})
+	}
+	query := "with cte_0 as (select * from tbl_2) select * from tbl_1 join cte_0 where tbl_1.col_1 in (select col_2 from tbl_3)"
+	require.Equal(t, []string{"tbl_1", "tbl_2", "tbl_3"}, touchedTables(query, state))
+	require.Equal(t, []string{"tbl_3"}, touchedTables("update tbl_3 set col_1 = 1", state))
+	// Fall back to match the names if the query cannot be parsed.
+	require.Equal(t, []string{"tbl_2"}, touchedTables("select ??? from tbl_2", state))
+
+	// The tables read by the views are touched, and the views are defined after them.
+	state.Views = append(state.Views,
+		&sqlgen.Table{ID: 4, Name: "v_4", View: &sqlgen.View{Deps: []*sqlgen.ViewDep{{Name: "tbl_3"}}}},
+		&sqlgen.Table{ID: 10, Name: "v_10", View: &sqlgen.View{Deps: []*sqlgen.ViewDep{{Name: "v_4"}, {Name: "tbl_1"}}}})
+	require.Equal(t, []string{"tbl_1", "tbl_3", "v_4", "v_10"}, touchedTables("select * from v_10", state))
+
+	// The tables referenced by the foreign keys are touched transitively, and created before the children.
+	child := &sqlgen.Table{Name: "tbl_5"}
+	parent := &sqlgen.Table{Name: "tbl_9"}
+	grandparent := &sqlgen.Table{Name: "tbl_7"}
+	child.ForeignKeys = []*sqlgen.ForeignKey{{RefTable: parent}}
+	parent.ForeignKeys = []*sqlgen.ForeignKey{{RefTable: grandparent}}
+	state.Tables = append(state.Tables, child, parent, grandparent)
+	require.Equal(t, []string{"tbl_7", "tbl_9", "tbl_5"}, touchedTables("delete from tbl_5", state))
+	require.Equal(t, []string{"tbl_3", "tbl_7", "tbl_9", "tbl_5"}, touchedTables("select * from tbl_5 join tbl_3", state))
+
+	// The sequences are read by the query or by the default values of the tables.
+	seq := &sqlgen.Sequence{Name: "seq_2"}
+	state.Tables[0].Columns = sqlgen.Columns{{Name: "col_1", DefaultSeq: seq}}
+	require.Equal(t, []string{"seq_1", "seq_2"}, touchedSequences("insert into tbl_1 values (nextval(seq_1))", []string{"tbl_1"}, state))
+	require.Empty(t, touchedSequences("select * from tbl_2", []string{"tbl_2"}, state))
+}
+
+func TestNewBundle(t *testing.T) {
+	state := sqlgen.NewState()
+	state.Tables = append(state.Tables, &sqlgen.Table{Name: "tbl_0", Columns: sqlgen.Columns{
+		{Name: "col_0"}, {Name: "col_1"}, {Name: "col_2", Generated: &sqlgen.Generated{Expr: "lower(%s)"}},
+	}})
+	respond := func(query string) (*resultset.ResultSet, error) {
+		switch {
+		case strings.HasPrefix(query, "show create table"):
+			cols := []resultset.ColumnDef{{Name: "Table"}, {Name: "Create Table"}}
+			return newTestResultSet(cols, []string{"tbl_0", "CREATE TABLE `tbl_0` (`col_0` int, `col_1` blob)"}), nil
+		case strings.HasPrefix(query, "select col_0, col_1 from"):
+			cols := []resultset.ColumnDef{{Name: "col_0", Type: "INT"}, {Name: "col_1", Type: "BLOB"}}
+			return newTestResultSet(cols, []string{"1", "it's"}), nil
+		}
+		return newTestResultSet([]resultset.ColumnDef{{Name: "r0"}}, []string{"x"}), nil
+	}
+	f := &failure{
+		ID:      1,
+		Seed:    10086,
+		Fn:      "Query",
+		Kind:    mismatchKindResult,
+		Query:   "select col_0 from tbl_0",
+		Err:     fmt.Errorf("result digests mismatch"),
+		Journal: []string{"create table tbl_0 (col_0 int, col_1 blob)", "insert into tbl_0 values (1, 'it''s')"},
+	}
+	e1, e2 := newFakeExecutor("a", respond), newFakeExecutor("b", respond)
+	b := newBundle(f, e1, e2, state)
+	// The generated columns are not inserted, and the foreign keys are not checked.
+	require.Equal(t, "set foreign_key_checks = 0;\ninsert into tbl_0 (col_0, col_1) values ('1', 0x69742773);\n"+
+		"set foreign_key_checks = 1;\n", b.files["data.sql"])
+	require.Equal(t, "set foreign_key_checks = 0;\nCREATE TABLE `tbl_0` (`col_0` int, `col_1` blob);\n"+
+		"set foreign_key_checks = 1;\n", b.files["schema.sql"])
+	require.Contains(t, b.files["repro.sql"], "CREATE TABLE `tbl_0`")
+	require.Contains(t, b.files["repro.sql"], "select col_0 from tbl_0;\n")
+	require.NotContains(t, b.files["repro.sql"], "insert into tbl_0 values (1, 'it''s')")
+	require.Contains(t, e1.Statements, "explain analyze select col_0 from tbl_0")
+	require.Contains(t, e2.Statements, "explain analyze select col_0 from tbl_0")
+	require.Contains(t, b.files["env.txt"], "seed: 10086")
+	require.Contains(t, b.files["issue.md"], "```sql\n"+b.files["repro.sql"])
+
+	// The DML has changed the data, so the journal is replayed instead.
+	f.Query = "delete from tbl_0"
+	b = newBundle(f, e1, e2, state)
+	require.Contains(t, b.files["repro.sql"], "insert into tbl_0 values (1, 'it''s');\ndelete from tbl_0;\n")
+	require.Contains(t, e1.Statements, "explain delete from tbl_0")
+
+	// The query takes a value of the sequence, so it is not analyzed.
+	f.Query = "select nextval(seq_1) as v"
+	newBundle(f, e1, e2, state)
+	require.Contains(t, e1.Statements, "explain select nextval(seq_1) as v")
+	require.NotContains(t, e1.Statements, "explain analyze select nextval(seq_1) as v")
+}
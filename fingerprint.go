@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb/parser"
+)
+
+var (
+	// generatedNameRegexp matches the names allocated by the generator, e.g. tbl_1, col_23, cte_as_4, dt_2, ta_3, p0 and r1.
+	generatedNameRegexp = regexp.MustCompile(`\b(tbl|col|idx|cte|cte_as|dt|ta|prepare|fn|p|r)_?\d+\b`)
+	planIDSuffixRegexp  = regexp.MustCompile(`_\d+\b`)
+	errorCodeRegexp     = regexp.MustCompile(`Error (\d+)`)
+)
+
+// fingerprint identifies the failures which are likely caused by the same bug.
+type fingerprint struct {
+	Query string
+	// ErrCodes are the error codes of both sides, or the mismatch kind if there is no error.
+	ErrCodes string
+	Fn       string
+	Plan     string
+}
+
+func (fp fingerprint) String() string {
+	return fmt.Sprintf("fn: %s\nkind: %s\nquery: %s\nplan:\n%s\n", fp.Fn, fp.ErrCodes, fp.Query, fp.Plan)
+}
+
+// Hash returns a short digest of the fingerprint, which is used as the bucket name.
+func (fp fingerprint) Hash() string {
+	sum := sha1.Sum([]byte(fp.String()))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// newFingerprint builds the fingerprint of the failure. The plan is read from the first executor.
+func newFingerprint(f *failure, executor Executor) fingerprint {
+	fp := fingerprint{
+		Query:    normalizeQuery(f.Query),
+		ErrCodes: f.Kind,
+		Fn:       f.Fn,
+	}
+	if codes := errorCodes(f.Err1, f.Err2); codes != "" {
+		fp.ErrCodes = fmt.Sprintf("%s(%s)", f.Kind, codes)
+	}
+	if explain := explainStmt(f.Query); explain != "" && f.Kind != failureKindFatal {
+		// EXPLAIN without ANALYZE is enough to tell the plan shape.
+		explain = "explain " + strings.TrimPrefix(explain, "explain analyze ")
+		if rs, err := executor.Query(explain); err == nil {
+			ids := make([]string, 0, rs.NRows())
+			for i := 0; i < rs.NRows(); i++ {
+				raw, _ := rs.RawValue(i, 0)
+				ids = append(ids, normalizePlanID(string(raw)))
+			}
+			fp.Plan = strings.Join(ids, "\n")
+		}
+	}
+	return fp
+}
+
+// normalizeQuery strips the literals and the generated names of the query.
+func normalizeQuery(query string) string {
+	return generatedNameRegexp.ReplaceAllString(parser.Normalize(query), "${1}_?")
+}
+
+// normalizePlanID strips the operator id, e.g. "└─TableFullScan_7" -> "└─TableFullScan".
+func normalizePlanID(id string) string {
+	return planIDSuffixRegexp.ReplaceAllString(id, "")
+}
+
+// errorCode returns the MySQL error code of err, or false if it is not a MySQL error.
+func errorCode(err error) (uint16, bool) {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number, true
+	}
+	if m := errorCodeRegexp.FindStringSubmatch(err.Error()); m != nil {
+		code, err := strconv.ParseUint(m[1], 10, 16)
+		return uint16(code), err == nil
+	}
+	return 0, false
+}
+
+func errorCodes(errs ...error) string {
+	codes := make([]string, 0, len(errs))
+	found := false
+	for _, err := range errs {
+		code := "-"
+		if err != nil {
+			if number, ok := errorCode(err); ok {
+				code = fmt.Sprint(number)
+			} else {
+				code = "?"
+			}
+			found = true
+		}
+		codes = append(codes, code)
+	}
+	if !found {
+		return ""
+	}
+	return strings.Join(codes, ",")
+}
+
+// failureBucket groups the failures with the same fingerprint.
+type failureBucket struct {
+	Hash        string
+	Fingerprint fingerprint
+	Count       int
+	// Smallest is the failure with the shortest query in the bucket.
+	Smallest *failure
+}
+
+// failureBuckets deduplicates the failures by their fingerprints.
+type failureBuckets struct {
+	buckets map[string]*failureBucket
+}
+
+func newFailureBuckets() *failureBuckets {
+	return &failureBuckets{buckets: make(map[string]*failureBucket)}
+}
+
+// Add puts the failure into its bucket, and reports whether it becomes the smallest example of the bucket.
+func (b *failureBuckets) Add(f *failure, fp fingerprint) (*failureBucket, bool) {
+	hash := fp.Hash()
+	bucket, ok := b.buckets[hash]
+	if !ok {
+		bucket = &failureBucket{Hash: hash, Fingerprint: fp}
+		b.buckets[hash] = bucket
+	}
+	bucket.Count++
+	if bucket.Smallest == nil || len(f.Query) < len(bucket.Smallest.Query) {
+		bucket.Smallest = f
+		return bucket, true
+	}
+	return bucket, false
+}
+
+// Sorted returns the buckets with the most failures first.
+func (b *failureBuckets) Sorted() []*failureBucket {
+	buckets := make([]*failureBucket, 0, len(b.buckets))
+	for _, bucket := range b.buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Hash < buckets[j].Hash
+	})
+	return buckets
+}
+
+func (b *failureBuckets) Len() int {
+	return len(b.buckets)
+}
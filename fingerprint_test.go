@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/zyguan/sqlz/resultset"
+)
+
+func TestFingerprint(t *testing.T) {
+	plan := func(ids ...string) *fakeExecutor {
+		return newFakeExecutor("a", func(query string) (*resultset.ResultSet, error) {
+			rows := make([][]string, 0, len(ids))
+			for _, id := range ids {
+				rows = append(rows, []string{id})
+			}
+			return newTestResultSet([]resultset.ColumnDef{{Name: "id"}}, rows...), nil
+		})
+	}
+	hashJoin := plan("HashJoin_8", "├─TableReader_11(Build)", "└─TableReader_14(Probe)")
+	f1 := &failure{
+		Fn:    "Query",
+		Kind:  mismatchKindResult,
+		Query: "select col_1 from tbl_1 join tbl_2 where tbl_1.col_1 > 10 and tbl_2.col_3 = 'Alice'",
+	}
+	f2 := &failure{
+		Fn:    "Query",
+		Kind:  mismatchKindResult,
+		Query: "select col_7 from tbl_3 join tbl_0 where tbl_3.col_7 > 2.5 and tbl_0.col_9 = 'Bob'",
+	}
+	fp1 := newFingerprint(f1, hashJoin)
+	require.Equal(t, fp1, newFingerprint(f2, plan("HashJoin_3", "├─TableReader_5(Build)", "└─TableReader_7(Probe)")))
+	require.Equal(t, "HashJoin\n├─TableReader(Build)\n└─TableReader(Probe)", fp1.Plan)
+	require.True(t, strings.HasPrefix(hashJoin.Statements[0], "explain select"))
+	require.NotEqual(t, fp1, newFingerprint(f2, plan("MergeJoin_3", "├─TableReader_5(Build)", "└─TableReader_7(Probe)")))
+
+	// The error codes tell the failures apart.
+	e1 := &failure{Fn: "DMLStmt", Kind: mismatchKindError, Query: "delete from tbl_1 where col_1 = 1",
+		Err1: errors.New("Error 1105: unknown error")}
+	e2 := &failure{Fn: "DMLStmt", Kind: mismatchKindError, Query: "delete from tbl_2 where col_4 = 3",
+		Err1: errors.New("Error 1105: another message")}
+	e3 := &failure{Fn: "DMLStmt", Kind: mismatchKindError, Query: "delete from tbl_1 where col_1 = 1",
+		Err2: errors.New("Error 1062: duplicate entry")}
+	dml := plan("Delete_4")
+	require.Equal(t, "error mismatch(1105,-)", newFingerprint(e1, dml).ErrCodes)
+	require.Equal(t, newFingerprint(e1, dml), newFingerprint(e2, dml))
+	require.NotEqual(t, newFingerprint(e1, dml), newFingerprint(e3, dml))
+}
+
+func TestFailureBuckets(t *testing.T) {
+	buckets := newFailureBuckets()
+	fp := fingerprint{Query: "select ? from tbl_?", Fn: "Query"}
+	bucket, smallest := buckets.Add(&failure{ID: 1, Query: "select 100 from tbl_1"}, fp)
+	require.True(t, smallest)
+	_, smallest = buckets.Add(&failure{ID: 2, Query: "select 1 from tbl_1"}, fp)
+	require.True(t, smallest)
+	_, smallest = buckets.Add(&failure{ID: 3, Query: "select 1000 from tbl_1"}, fp)
+	require.False(t, smallest)
+	buckets.Add(&failure{ID: 4, Query: "delete from tbl_1"}, fingerprint{Query: "delete from tbl_?", Fn: "DMLStmt"})
+	require.Equal(t, 2, buckets.Len())
+	sorted := buckets.Sorted()
+	require.Equal(t, bucket, sorted[0])
+	require.Equal(t, 3, sorted[0].Count)
+	require.Equal(t, 2, sorted[0].Smallest.ID)
+}
+
+func TestExpectedErrors(t *testing.T) {
+	overflow := &mysql.MySQLError{Number: 1690, Message: "BIGINT UNSIGNED value is out of range"}
+	truncated := errors.New("Error 1292: Truncated incorrect DOUBLE value: 'a'")
+	unknown := errors.New("Error 1105: unknown error")
+
+	nonStrict := expectedErrors("ONLY_FULL_GROUP_BY,NO_ENGINE_SUBSTITUTION")
+	require.True(t, isExpectedErr(nil, nonStrict))
+	require.True(t, isExpectedErr(overflow, nonStrict))
+	require.False(t, isExpectedErr(truncated, nonStrict))
+	require.False(t, isExpectedErr(unknown, nonStrict))
+
+	strict := expectedErrors("STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION")
+	require.True(t, isExpectedErr(overflow, strict))
+	require.True(t, isExpectedErr(truncated, strict))
+	require.False(t, isExpectedErr(unknown, strict))
+}
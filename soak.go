@@ -0,0 +1,417 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PingCAP-QE/clustered-index-rand-test/cases"
+	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/pingcap/log"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type soakOptions struct {
+	abtestOptions
+	// count is the number of generated statements to run, 0 means no limit.
+	count int
+	// duration is how long to run, 0 means no limit.
+	duration time.Duration
+	// resetInterval is how often to drop the database and start with a fresh state, 0 means never.
+	resetInterval time.Duration
+	// progressInterval is how often to print the progress line, 0 means never.
+	progressInterval time.Duration
+	// profiles are the case profiles to rotate across on every reset.
+	profiles []string
+	// failureDir is the directory to save every failure.
+	failureDir string
+	failfast   bool
+	out        io.Writer
+}
+
+// fnStats counts the statements generated by a top-level Fn.
+type fnStats struct {
+	stmts  int
+	errors int
+	// expected counts the statements which fail with the expected errors on both sides.
+	expected   int
+	mismatches int
+}
+
+// errorRate is the percentage of the statements which fail with unexpected errors.
+func (s *fnStats) errorRate() float64 {
+	return 100 * float64(s.errors-s.expected) / float64(s.stmts)
+}
+
+// soakRunner runs the AB test until the count or the duration is reached.
+// It keeps going after a mismatch, and starts again with a fresh state after every failure.
+type soakRunner struct {
+	opts                 soakOptions
+	executor1, executor2 Executor
+	newState             func(profile string) (*sqlgen.State, error)
+
+	state      *sqlgen.State
+	kindHook   *sqlgen.FnHookStmtKind
+	profile    string
+	epoch      int
+	epochStart int
+	// journal is the statements which have succeeded on both sides in the current epoch, so that it can be
+	// replayed by `mysql` which stops at the first error.
+	journal []string
+	// expectedErrs are the expected error codes under the sql_mode of the current epoch, it is loaded lazily.
+	expectedErrs map[uint16]struct{}
+
+	start time.Time
+	// stmts counts all the statements, including the initial ones of every epoch.
+	stmts     int
+	generated int
+	skipped   int
+	byFn      map[string]*fnStats
+	failures  int
+	buckets   *failureBuckets
+
+	// diverged is set if a statement is interrupted on one side only, and the data of both sides may differ.
+	// divergences counts such statements.
+	diverged    bool
+	divergences int
+}
+
+func newSoakRunner(executor1, executor2 Executor, opts soakOptions) *soakRunner {
+	if len(opts.profiles) == 0 {
+		opts.profiles = []string{"multi-schema-change"}
+	}
+	if opts.out == nil {
+		opts.out = io.Discard
+	}
+	return &soakRunner{
+		opts:      opts,
+		executor1: executor1,
+		executor2: executor2,
+		newState:  cases.NewProfileState,
+		byFn:      make(map[string]*fnStats),
+		buckets:   newFailureBuckets(),
+	}
+}
+
+func (r *soakRunner) run() error {
+	r.start = time.Now()
+	err := r.loop()
+	r.printSummary()
+	if err != nil {
+		return err
+	}
+	if r.failures > 0 {
+		return errors.Errorf("found %d failures in %d buckets, seed: %d", r.failures, r.buckets.Len(), r.opts.seed)
+	}
+	return nil
+}
+
+func (r *soakRunner) loop() error {
+	if err := r.reset(); err != nil {
+		return err
+	}
+	lastReset, lastProgress := time.Now(), time.Now()
+	for r.opts.count <= 0 || r.generated < r.opts.count {
+		if r.opts.duration > 0 && time.Since(r.start) >= r.opts.duration {
+			break
+		}
+		if r.opts.resetInterval > 0 && time.Since(lastReset) >= r.opts.resetInterval {
+			if err := r.reset(); err != nil {
+				return err
+			}
+			lastReset = time.Now()
+		}
+		query, err := sqlgen.Start.Eval(r.state)
+		if err != nil {
+			return errors.Wrapf(err, "generate statement, seed: %d", r.opts.seed)
+		}
+		r.generated++
+		kind := r.kindHook.Kind()
+		failed, err := r.runStatement(query, kind)
+		if err != nil {
+			return err
+		}
+		definesView := kind == sqlgen.CreateView.Info || kind == sqlgen.AlterView.Info
+		if !failed && !r.diverged && (definesView || r.generated%viewOracleInterval == 0) {
+			if failed, err = r.runViewOracle(); err != nil {
+				return err
+			}
+		}
+		definesSequence := kind == sqlgen.CreateSequence.Info || kind == sqlgen.AlterSequence.Info
+		if !failed && !r.diverged && (definesSequence || r.generated%sequenceOracleInterval == 0) {
+			if failed, err = r.runSequenceOracle(); err != nil {
+				return err
+			}
+		}
+		if failed || r.diverged {
+			// The two sides may have diverged, start again to avoid reporting the same failure repeatedly.
+			if err := r.reset(); err != nil {
+				return err
+			}
+			lastReset = time.Now()
+		}
+		if r.opts.progressInterval > 0 && time.Since(lastProgress) >= r.opts.progressInterval {
+			r.printProgress()
+			lastProgress = time.Now()
+		}
+	}
+	return nil
+}
+
+// reset drops the database and starts with a fresh state of the next profile.
+func (r *soakRunner) reset() error {
+	r.profile = r.opts.profiles[r.epoch%len(r.opts.profiles)]
+	state, err := r.newState(r.profile)
+	if err != nil {
+		return err
+	}
+	if r.epoch > 0 {
+		if err := r.executor1.SetUp(); err != nil {
+			return errors.Wrapf(err, "reset %s", r.executor1.Name())
+		}
+		if err := r.executor2.SetUp(); err != nil {
+			return errors.Wrapf(err, "reset %s", r.executor2.Name())
+		}
+	}
+	r.epoch++
+	r.epochStart = r.stmts
+	r.journal = nil
+	r.expectedErrs = nil
+	r.diverged = false
+	r.state = state
+	r.kindHook = sqlgen.NewFnHookStmtKind()
+	for _, query := range generateInitialSQLs(state) {
+		if _, err := r.runStatement(query, initialStmtKind); err != nil {
+			return err
+		}
+	}
+	state.Env().Clean()
+	state.Hook().Append(r.kindHook)
+	return nil
+}
+
+// initialStmtKind is the Fn name reported for the statements which create and fill the tables.
+const initialStmtKind = "InitialSQLs"
+
+// runStatement runs a statement on both sides and records the outcome.
+// An error is returned if the test should stop.
+func (r *soakRunner) runStatement(query, fn string) (failed bool, err error) {
+	seq := r.stmts
+	r.stmts++
+	outcome := compareStatement(r.executor1, r.executor2, r.state, query, r.opts.abtestOptions)
+	journal := r.journal
+	if stmts := journalStmts(query, outcome); stmts != "" {
+		r.journal = append(r.journal, stmts)
+	}
+	if outcome.skipped {
+		r.skipped++
+	}
+	if outcome.diverged {
+		log.Warn("the statement is interrupted on one side only, start again", zap.String("query", query))
+		r.diverged = true
+		r.divergences++
+	}
+	return r.record(seq, fn, query, journal, outcome)
+}
+
+// journalStmts returns the statements of the query to be replayed, or empty if nothing has changed.
+// Only the BEGIN of a failed query is replayed, which starts a transaction before the failed statement
+// and stays in effect.
+func journalStmts(query string, outcome stmtOutcome) string {
+	if outcome.err1 == nil && outcome.err2 == nil && !outcome.skipped {
+		return query
+	}
+	first := strings.TrimSpace(strings.SplitN(query, ";", 2)[0])
+	if first != query && strings.HasPrefix(strings.ToLower(first), "begin") {
+		return first
+	}
+	return ""
+}
+
+// viewOracleInterval is how often the view oracle runs, besides after every view is defined.
+const viewOracleInterval = 50
+
+// viewOracleFn is the Fn name reported for the view oracle.
+const viewOracleFn = "ViewOracle"
+
+// runViewOracle checks on both sides that a query over a view returns the same rows as the same query
+// over the inlined definition of the view. The queries are not recorded in the journal.
+func (r *soakRunner) runViewOracle() (failed bool, err error) {
+	query, inlined, ok := sqlgen.ViewOracle(r.state)
+	if !ok {
+		return false, nil
+	}
+	return r.runOracle(viewOracleFn, query, inlined, "inlined")
+}
+
+// sequenceOracleInterval is how often the sequence oracle runs, besides after every sequence is defined.
+const sequenceOracleInterval = 50
+
+// sequenceOracleFn is the Fn name reported for the sequence oracle.
+const sequenceOracleFn = "SequenceOracle"
+
+// runSequenceOracle checks on both sides that NEXTVAL of an uncached sequence returns the value expected
+// by the model. The query takes a value of the sequence, so it is recorded in the journal.
+func (r *soakRunner) runSequenceOracle() (failed bool, err error) {
+	query, expected, ok := sqlgen.SequenceOracle(r.state)
+	if !ok {
+		return false, nil
+	}
+	skipped := r.skipped
+	failed, err = r.runOracle(sequenceOracleFn, query, "select "+expected+" as v", "expected")
+	if !failed && r.skipped == skipped {
+		r.journal = append(r.journal, query)
+	}
+	// The value may have been taken on one side only, so the sides are treated as diverged.
+	return failed || r.skipped > skipped, err
+}
+
+// runOracle runs the query and the reference query on every side, and reports a mismatch if they return
+// different rows. The reference query is named by label in the mismatch.
+func (r *soakRunner) runOracle(fn, query, reference, label string) (failed bool, err error) {
+	// Both queries run on every side.
+	seq := r.stmts
+	r.stmts += 2
+	for _, e := range []Executor{r.executor1, r.executor2} {
+		outcome := compareQueries(e, query, e, reference, r.state, r.opts.abtestOptions)
+		if outcome.skipped {
+			// The oracle tells nothing without the results of both queries.
+			r.skipped += 2
+			return false, nil
+		}
+		if outcome.mismatch != nil {
+			outcome.mismatch = errors.Errorf("%v on %s, %s: %q", outcome.mismatch, e.Name(), label, reference)
+		}
+		if failed, err := r.record(seq, fn, query, r.journal, outcome); failed || err != nil {
+			return failed, err
+		}
+	}
+	return false, nil
+}
+
+// record counts the outcome of a statement, and reports the failure if any.
+// An error is returned if the test should stop.
+func (r *soakRunner) record(seq int, fn, query string, journal []string, outcome stmtOutcome) (failed bool, err error) {
+	stats, ok := r.byFn[fn]
+	if !ok {
+		stats = &fnStats{}
+		r.byFn[fn] = stats
+	}
+	stats.stmts++
+	if outcome.err1 != nil || outcome.err2 != nil {
+		stats.errors++
+		if isExpectedErr(outcome.err1, r.expectedErrors()) && isExpectedErr(outcome.err2, r.expectedErrors()) {
+			stats.expected++
+		}
+	}
+	if outcome.fatal == nil && outcome.mismatch == nil {
+		return false, nil
+	}
+	f := &failure{
+		ID:      r.failures + 1,
+		Seed:    r.opts.seed,
+		Epoch:   r.epoch,
+		Profile: r.profile,
+		Seq:     seq - r.epochStart,
+		Fn:      fn,
+		Query:   query,
+		Kind:    outcome.mismatchKind,
+		Err:     outcome.mismatch,
+		Err1:    outcome.err1,
+		Err2:    outcome.err2,
+		Journal: journal,
+	}
+	if outcome.fatal != nil {
+		f.Kind, f.Err = failureKindFatal, outcome.fatal
+	}
+	stats.mismatches++
+	r.failures++
+	fp := newFingerprint(f, r.executor1)
+	bucket, smallest := r.buckets.Add(f, fp)
+	fmt.Fprintln(r.opts.out, colorizeErrorMsg(errors.Errorf("failure #%d: %s, bucket %s (%d seen)",
+		f.ID, f.Summary(), bucket.Hash, bucket.Count)))
+	if r.opts.failureDir != "" && smallest {
+		// Only the smallest example of every bucket is kept.
+		dir := filepath.Join(r.opts.failureDir, bundleDirName(bucket.Hash))
+		b := newBundle(f, r.executor1, r.executor2, r.state)
+		b.files["fingerprint.txt"] = fp.String()
+		if err := os.RemoveAll(dir); err != nil {
+			return true, err
+		}
+		if err := b.save(dir); err != nil {
+			return true, err
+		}
+		fmt.Fprintf(r.opts.out, "failure #%d is saved to %s\n", f.ID, dir)
+	}
+	if outcome.fatal != nil {
+		return true, errors.Errorf("statement seq %d caused %v\nseed: %d", seq, outcome.fatal, r.opts.seed)
+	}
+	if r.opts.failfast {
+		return true, errors.Errorf("%v\nseed: %d\nquery: %s", outcome.mismatch, r.opts.seed, query)
+	}
+	return true, nil
+}
+
+// expectedErrors returns the expected error codes under the sql_mode of the first executor.
+func (r *soakRunner) expectedErrors() map[uint16]struct{} {
+	if r.expectedErrs == nil {
+		var sqlMode string
+		if rs, err := r.executor1.Query("select @@session.sql_mode"); err == nil && rs.NRows() > 0 {
+			raw, _ := rs.RawValue(0, 0)
+			sqlMode = string(raw)
+		}
+		r.expectedErrs = expectedErrors(sqlMode)
+	}
+	return r.expectedErrs
+}
+
+func (r *soakRunner) printProgress() {
+	elapsed := time.Since(r.start)
+	fns := r.sortedFns()
+	rates := make([]string, 0, len(fns))
+	for _, fn := range fns {
+		s := r.byFn[fn]
+		rates = append(rates, fmt.Sprintf("%s %.1f%%", fn, s.errorRate()))
+	}
+	fmt.Fprintf(r.opts.out, "[%s] %d stmts (%.1f/s), %d failures, %d skipped, epoch %d (%s), error rate: %s\n",
+		elapsed.Truncate(time.Second), r.stmts, float64(r.stmts)/elapsed.Seconds(), r.failures, r.skipped,
+		r.epoch, r.profile, strings.Join(rates, ", "))
+}
+
+func (r *soakRunner) printSummary() {
+	elapsed := time.Since(r.start)
+	fmt.Fprintf(r.opts.out, "\nsummary: %d stmts in %s, %d epochs, %d skipped, %d diverged, %d failures in %d buckets, seed: %d\n",
+		r.stmts, elapsed.Truncate(time.Second), r.epoch, r.skipped, r.divergences, r.failures, r.buckets.Len(), r.opts.seed)
+	w := tabwriter.NewWriter(r.opts.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "fn\tstmts\terrors\texpected errors\terror rate\tfailures")
+	for _, fn := range r.sortedFns() {
+		s := r.byFn[fn]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f%%\t%d\n", fn, s.stmts, s.errors, s.expected, s.errorRate(), s.mismatches)
+	}
+	w.Flush()
+	if r.buckets.Len() == 0 {
+		return
+	}
+	fmt.Fprintln(r.opts.out)
+	w = tabwriter.NewWriter(r.opts.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "bucket	count	smallest")
+	for _, bucket := range r.buckets.Sorted() {
+		fmt.Fprintf(w, "%s\t%d\t#%d %s\n", bucket.Hash, bucket.Count, bucket.Smallest.ID, bucket.Smallest.Summary())
+	}
+	w.Flush()
+}
+
+func (r *soakRunner) sortedFns() []string {
+	fns := make([]string, 0, len(r.byFn))
+	for fn := range r.byFn {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	return fns
+}
@@ -1,11 +1,15 @@
 package sqlgen
 
 type IDAllocator struct {
-	tableID  int
-	columnID int
-	indexID  int
-	cteID    int
-	renameID int
+	tableID        int
+	columnID       int
+	indexID        int
+	cteID          int
+	renameID       int
+	derivedTableID int
+	tableAliasID   int
+	constraintID   int
+	sequenceID     int
 }
 
 func (a *IDAllocator) AllocTableID() int {
@@ -28,7 +32,27 @@ func (a *IDAllocator) AllocCTEID() int {
 	return a.cteID
 }
 
+func (a *IDAllocator) AllocDerivedTableID() int {
+	a.derivedTableID++
+	return a.derivedTableID
+}
+
+func (a *IDAllocator) AllocTableAliasID() int {
+	a.tableAliasID++
+	return a.tableAliasID
+}
+
 func (a *IDAllocator) AllocRenameID() int {
 	a.renameID++
 	return a.renameID
 }
+
+func (a *IDAllocator) AllocConstraintID() int {
+	a.constraintID++
+	return a.constraintID
+}
+
+func (a *IDAllocator) AllocSequenceID() int {
+	a.sequenceID++
+	return a.sequenceID
+}
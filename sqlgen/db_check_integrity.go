@@ -16,12 +16,42 @@ func (s *State) CheckIntegrity() {
 		Assert(tb != nil)
 		tb.CheckIntegrity()
 	}
+	for _, v := range s.Views {
+		Assert(v.View != nil && len(v.Columns) > 0)
+	}
+	// The sequences of the default values cannot be dropped.
+	for _, tb := range s.Tables {
+		for _, c := range tb.Columns {
+			Assert(c.DefaultSeq == nil || s.Sequences.ByName(c.DefaultSeq.Name) == c.DefaultSeq)
+		}
+	}
+	for _, seq := range s.Sequences {
+		Assert(seq.Increment != 0 && seq.MinValue < seq.MaxValue)
+		Assert(seq.Start >= seq.MinValue && seq.Start <= seq.MaxValue)
+	}
 }
 
 func (t *Table) CheckIntegrity() {
+	autoCols := t.Columns.Filter(func(c *Column) bool {
+		return c.IsAutoAllocated()
+	})
+	// There can be only one auto column. The key of an AUTO_INCREMENT column is not checked,
+	// because it is added after the column definitions.
+	Assert(len(autoCols) <= 1)
+	for _, c := range autoCols {
+		if c.AutoRandomBits > 0 {
+			pk := t.Indexes.Primary()
+			Assert(t.Clustered && pk != nil && pk.Columns[0].ID == c.ID)
+		}
+	}
 	for _, col := range t.Columns {
 		Assert(col != nil)
 		col.CheckIntegrity()
+		if col.Generated != nil {
+			for _, dep := range col.Generated.Deps {
+				Assert(t.Columns.Contain(dep))
+			}
+		}
 	}
 	for _, idx := range t.Indexes {
 		Assert(idx != nil)
@@ -30,6 +60,28 @@ func (t *Table) CheckIntegrity() {
 			Assert(t.Columns.Contain(idxCol))
 		}
 	}
+	for _, fk := range t.ForeignKeys {
+		Assert(fk.RefTable != t && len(fk.Columns) > 0 && len(fk.Columns) == len(fk.RefColumns))
+		for _, c := range fk.Columns {
+			Assert(t.Columns.Contain(c))
+		}
+	}
+	for _, chk := range t.Checks {
+		Assert(t.Columns.Contain(chk.Column))
+	}
+	if t.Temporary != TempTableNone {
+		// The temporary tables are not partitioned, in foreign keys or replicated to TiFlash.
+		Assert(t.Partition == nil && len(t.ForeignKeys) == 0 && t.TiflashReplica == 0)
+		for _, c := range autoCols {
+			Assert(c.AutoRandomBits == 0)
+		}
+	}
+	if t.Partition != nil {
+		Assert(len(t.Partition.Defs) > 0)
+		for _, partCol := range t.Partition.Columns {
+			Assert(t.Columns.Contain(partCol))
+		}
+	}
 }
 
 func (c *Column) CheckIntegrity() {
@@ -40,6 +92,7 @@ func (c *Column) CheckIntegrity() {
 func (i *Index) CheckIntegrity() {
 	Assert(len(i.Name) > 0)
 	Assert(len(i.Columns) > 0)
+	Assert(len(i.Funcs) == len(i.Columns))
 }
 
 func NotNil(object interface{}) {
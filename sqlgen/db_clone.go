@@ -14,6 +14,32 @@ func (s *State) Clone() *State {
 	for _, tbl := range s.Tables {
 		s1.Tables = append(s1.Tables, tbl.Clone())
 	}
+	// The foreign keys reference the cloned tables.
+	for _, tbl := range s1.Tables {
+		for _, fk := range tbl.ForeignKeys {
+			if ref := s1.Tables.ByID(fk.RefTable.ID); ref != nil {
+				fk.RefColumns = remapColumns(fk.RefColumns, ref.Columns, fk.RefTable.Columns)
+				fk.RefTable = ref
+			}
+		}
+	}
+	s1.Views = make([]*Table, 0, len(s.Views))
+	for _, v := range s.Views {
+		s1.Views = append(s1.Views, v.Clone())
+	}
+	s1.Sequences = make(Sequences, 0, len(s.Sequences))
+	for _, seq := range s.Sequences {
+		newSeq := *seq
+		s1.Sequences = append(s1.Sequences, &newSeq)
+	}
+	// The default values of the columns are taken from the cloned sequences.
+	for _, tbl := range s1.Tables {
+		for _, c := range tbl.Columns {
+			if c.DefaultSeq != nil {
+				c.DefaultSeq = s1.Sequences.ByName(c.DefaultSeq.Name)
+			}
+		}
+	}
 	s1.env = s.env.Clone()
 	return &s1
 }
@@ -24,6 +50,16 @@ func (t *Table) Clone() *Table {
 	for _, col := range t.Columns {
 		newTable.Columns = append(newTable.Columns, col.Clone())
 	}
+	for _, col := range newTable.Columns {
+		if col.Generated != nil {
+			newGen := *col.Generated
+			newGen.Deps = make(Columns, 0, len(col.Generated.Deps))
+			for _, dep := range col.Generated.Deps {
+				newGen.Deps = append(newGen.Deps, newTable.Columns[t.Columns.ByID(dep.ID)])
+			}
+			col.Generated = &newGen
+		}
+	}
 	newTable.Values = cloneValues(t.Values)
 	newTable.Indexes = make([]*Index, 0, len(t.Indexes))
 	for _, idx := range t.Indexes {
@@ -34,6 +70,7 @@ func (t *Table) Clone() *Table {
 			newIdx.Columns = append(newIdx.Columns, newTable.Columns[offset])
 		}
 		newIdx.ColumnPrefix = cloneInts(idx.ColumnPrefix)
+		newIdx.Funcs = cloneStrings(idx.Funcs)
 		newTable.Indexes = append(newTable.Indexes, &newIdx)
 	}
 	newTable.ColForPrefixIndex = make([]*Column, 0, len(t.ColForPrefixIndex))
@@ -41,11 +78,49 @@ func (t *Table) Clone() *Table {
 		offset := t.Columns.ByID(c.ID)
 		newTable.ColForPrefixIndex = append(newTable.ColForPrefixIndex, newTable.Columns[offset])
 	}
+	if t.Partition != nil {
+		newTable.Partition = t.Partition.Clone(newTable.Columns, t.Columns)
+	}
+	newTable.ForeignKeys = make([]*ForeignKey, 0, len(t.ForeignKeys))
+	for _, fk := range t.ForeignKeys {
+		newFK := *fk
+		newFK.Columns = remapColumns(fk.Columns, newTable.Columns, t.Columns)
+		newTable.ForeignKeys = append(newTable.ForeignKeys, &newFK)
+	}
+	newTable.Checks = make([]*Check, 0, len(t.Checks))
+	for _, chk := range t.Checks {
+		newChk := *chk
+		newChk.Column = newTable.Columns[t.Columns.ByID(chk.Column.ID)]
+		newTable.Checks = append(newTable.Checks, &newChk)
+	}
 	// TODO: DROP TABLE need to remove itself from children tables.
 	newTable.ChildTables = []*Table{&newTable}
 	return &newTable
 }
 
+// Clone copies the partitioning, whose columns are replaced by the columns at the same offsets in newCols.
+func (p *Partition) Clone(newCols, oldCols Columns) *Partition {
+	newPart := *p
+	newPart.Columns = make(Columns, 0, len(p.Columns))
+	for _, c := range p.Columns {
+		newPart.Columns = append(newPart.Columns, newCols[oldCols.ByID(c.ID)])
+	}
+	newPart.Defs = make([]*PartitionDef, 0, len(p.Defs))
+	for _, def := range p.Defs {
+		newPart.Defs = append(newPart.Defs, &PartitionDef{Name: def.Name, Values: cloneStrings(def.Values)})
+	}
+	return &newPart
+}
+
+// remapColumns replaces the columns cols by the columns at the same offsets in newCols.
+func remapColumns(cols, newCols, oldCols Columns) Columns {
+	ret := make(Columns, 0, len(cols))
+	for _, c := range cols {
+		ret = append(ret, newCols[oldCols.ByID(c.ID)])
+	}
+	return ret
+}
+
 func (c *Column) Clone() *Column {
 	newCol := *c
 	newCol.Args = cloneStrings(c.Args)
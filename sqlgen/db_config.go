@@ -2,8 +2,34 @@ package sqlgen
 
 type ConfigurableState State
 
+// maxJoinTables is the max number of the tables joined in a query.
+var maxJoinTables = 4
+
+// maxSetOpBranches is the max number of the queries combined by the set operators.
+var maxSetOpBranches = 4
+
 func (s *ConfigurableState) SetMaxTable(count int) {
 	NoTooMuchTables = func(s *State) bool {
 		return len(s.Tables) < count
 	}
 }
+
+func (s *ConfigurableState) SetMaxJoinTables(count int) {
+	maxJoinTables = count
+}
+
+func (s *ConfigurableState) SetMaxSetOpBranches(count int) {
+	maxSetOpBranches = count
+}
+
+func (s *ConfigurableState) SetMaxSubQueryDepth(depth int) {
+	NoTooDeepSubQuery = func(s *State) bool {
+		return s.env.SubQueryDepth < depth
+	}
+}
+
+func (s *ConfigurableState) SetMaxExprDepth(depth int) {
+	NoTooDeepExpr = func(s *State) bool {
+		return s.env.ExprDepth < depth
+	}
+}
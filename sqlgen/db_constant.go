@@ -43,7 +43,6 @@ func (c *Column) EstimateSizeInBytes() int {
 		return c.Arg1
 	}
 	panic(fmt.Sprintf("unknown column type %d", c.Tp))
-	return 0
 }
 
 type ColumnType int64
@@ -218,6 +217,25 @@ func (c ColumnType) IsFloatingType() bool {
 	return false
 }
 
+func (c ColumnType) IsNumericType() bool {
+	return c.IsIntegerType() || c.IsFloatingType() || c == ColumnTypeBoolean
+}
+
+// CompatibleWith reports whether a value of the type other can be used as an expression of the type c.
+func (c ColumnType) CompatibleWith(other ColumnType) bool {
+	switch {
+	case c.IsIntegerType() || c == ColumnTypeBoolean:
+		return other.IsIntegerType() || other == ColumnTypeBoolean
+	case c.IsFloatingType():
+		return other.IsNumericType()
+	case c.IsStringType() || c == ColumnTypeEnum || c == ColumnTypeSet:
+		return other.IsStringType() || other == ColumnTypeEnum || other == ColumnTypeSet
+	case c == ColumnTypeDate || c == ColumnTypeDatetime || c == ColumnTypeTimestamp:
+		return other == ColumnTypeDate || other == ColumnTypeDatetime || other == ColumnTypeTimestamp
+	}
+	return c == other
+}
+
 func (c ColumnType) SameTypeAs(other ColumnType) bool {
 	return (c.IsStringType() && other.IsStringType()) || (c.IsIntegerType() && other.IsIntegerType())
 }
@@ -252,6 +270,25 @@ func (c ColumnType) IsPartitionType() bool {
 	return c.IsIntegerType()
 }
 
+// IsColumnsPartitionType means the column can be used in KEY, RANGE COLUMNS and LIST COLUMNS.
+func (c ColumnType) IsColumnsPartitionType() bool {
+	switch c {
+	case ColumnTypeChar, ColumnTypeVarchar, ColumnTypeBinary, ColumnTypeVarBinary, ColumnTypeDate, ColumnTypeDatetime:
+		return true
+	}
+	return c.IsIntegerType()
+}
+
+// IsForeignKeyType means the column can be used in a foreign key. The string types are not used,
+// because the charsets and the collations of the columns must be the same.
+func (c ColumnType) IsForeignKeyType() bool {
+	switch c {
+	case ColumnTypeDecimal, ColumnTypeDate, ColumnTypeDatetime:
+		return true
+	}
+	return c.IsIntegerType()
+}
+
 func (c ColumnType) IsPointGetableType() bool {
 	switch c {
 	case ColumnTypeFloat, ColumnTypeDouble, ColumnTypeText, ColumnTypeBlob:
@@ -341,6 +378,93 @@ func (tp IndexType) String() string {
 	return ""
 }
 
+type PartitionType int64
+
+const (
+	PartitionTypeHash PartitionType = iota
+	PartitionTypeRange
+	PartitionTypeList
+	PartitionTypeKey
+	PartitionTypeRangeColumns
+	PartitionTypeListColumns
+)
+
+func (tp PartitionType) String() string {
+	switch tp {
+	case PartitionTypeHash:
+		return "hash"
+	case PartitionTypeRange:
+		return "range"
+	case PartitionTypeList:
+		return "list"
+	case PartitionTypeKey:
+		return "key"
+	case PartitionTypeRangeColumns:
+		return "range columns"
+	case PartitionTypeListColumns:
+		return "list columns"
+	}
+	return ""
+}
+
+// IsHash means the partitions are only defined by the number, i.e. HASH and KEY.
+func (tp PartitionType) IsHash() bool {
+	return tp == PartitionTypeHash || tp == PartitionTypeKey
+}
+
+func (tp PartitionType) IsRange() bool {
+	return tp == PartitionTypeRange || tp == PartitionTypeRangeColumns
+}
+
+func (tp PartitionType) IsList() bool {
+	return tp == PartitionTypeList || tp == PartitionTypeListColumns
+}
+
+// ReferOption is the referential action of a foreign key on the deletion or the update of the referenced rows.
+type ReferOption int64
+
+const (
+	ReferOptionRestrict ReferOption = iota
+	ReferOptionCascade
+	ReferOptionSetNull
+	ReferOptionNoAction
+)
+
+func (o ReferOption) String() string {
+	switch o {
+	case ReferOptionRestrict:
+		return "restrict"
+	case ReferOptionCascade:
+		return "cascade"
+	case ReferOptionSetNull:
+		return "set null"
+	case ReferOptionNoAction:
+		return "no action"
+	}
+	return ""
+}
+
+// TempTableType is the kind of a temporary table. A local temporary table only exists in the session which
+// creates it. A global temporary table is visible to all the sessions, but its rows belong to the transaction
+// which writes them, and are deleted when the transaction ends.
+type TempTableType int64
+
+const (
+	TempTableNone TempTableType = iota
+	TempTableLocal
+	TempTableGlobal
+)
+
+func (t TempTableType) String() string {
+	switch t {
+	case TempTableLocal:
+		return "temporary"
+	case TempTableGlobal:
+		return "global temporary"
+	}
+	return ""
+}
+
 const DefaultKeySizeLimit = 3072
 
 const SelectOutFileDir = "/tmp/tidb_tp_test_outfile"
@@ -356,5 +480,48 @@ const (
 )
 
 const (
-	QueryAggregation = "agg"
+	QueryGroupBy = "group"
 )
+
+// CastTarget is a type name in CAST(x AS type), and the type of the result.
+type CastTarget struct {
+	Name string
+	Tp   ColumnType
+}
+
+var CastTargets = []CastTarget{
+	{"signed", ColumnTypeBigInt},
+	{"unsigned", ColumnTypeBigInt},
+	{"decimal", ColumnTypeDecimal},
+	{"decimal(10, 2)", ColumnTypeDecimal},
+	{"decimal(65, 30)", ColumnTypeDecimal},
+	{"double", ColumnTypeDouble},
+	{"float", ColumnTypeFloat},
+	{"char", ColumnTypeVarchar},
+	{"char(5)", ColumnTypeVarchar},
+	{"binary", ColumnTypeVarBinary},
+	{"binary(5)", ColumnTypeVarBinary},
+	{"date", ColumnTypeDate},
+	{"datetime", ColumnTypeDatetime},
+	{"datetime(6)", ColumnTypeDatetime},
+	{"time", ColumnTypeTime},
+	{"time(3)", ColumnTypeTime},
+	{"json", ColumnTypeJSON},
+}
+
+// CastPair is a cell of the cast matrix, which converts a value of the type Src to the Target.
+type CastPair struct {
+	Src    ColumnType
+	Target CastTarget
+}
+
+// CastMatrix is every pair of ColumnTypeAllTypes and CastTargets.
+var CastMatrix []CastPair
+
+func init() {
+	for _, src := range ColumnTypeAllTypes {
+		for _, target := range CastTargets {
+			CastMatrix = append(CastMatrix, CastPair{Src: src, Target: target})
+		}
+	}
+}
@@ -8,18 +8,27 @@ type Env struct {
 }
 
 type Elem struct {
-	Table      *Table
-	Column     *Column
-	OldColumn  *Column
-	PartColumn *Column
-	IdxColumn  *Column
-	Columns    Columns
-	Index      *Index
-	QState     *QueryState
-	QColumns   QueryStateColumns
-	FnInfo     string
-	Bool       bool
-	MultiObjs  *MultiObjs
+	Table     *Table
+	Column    *Column
+	OldColumn *Column
+	IdxColumn *Column
+	Columns   Columns
+	Index     *Index
+	QState    *QueryState
+	QColumns  QueryStateColumns
+	FnInfo    string
+	Bool      bool
+	MultiObjs *MultiObjs
+	ExprTp    ColumnType
+	ExprDepth int
+	// SubQueryDepth is the nesting depth of the subqueries.
+	SubQueryDepth int
+	// CTEs are the CTEs which can be referenced in the current scope.
+	CTEs Tables
+	// View is the view being defined, which only reads the tables and the views defined before it.
+	View *Table
+	// PartColumns are the columns which can be the partitioning columns.
+	PartColumns Columns
 }
 
 func (e *Env) Enter() {
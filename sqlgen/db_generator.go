@@ -1,11 +1,14 @@
 package sqlgen
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cznic/mathutil"
@@ -23,11 +26,26 @@ func (s *State) GenNewTable() *Table {
 func (s *State) GenNewCTE() *Table {
 	id := s.alloc.AllocCTEID()
 	return &Table{
-		ID:   -1, // we do not use the id in CTE
+		// The negative ID distinguishes the CTEs from the tables.
+		ID:   -id,
 		Name: fmt.Sprintf("cte_%d", id),
 	}
 }
 
+// GenNewView returns a view without the definition. The views share the IDs with the tables,
+// so that a view is never mistaken for a table in a query.
+func (s *State) GenNewView() *Table {
+	id := s.alloc.AllocTableID()
+	return &Table{ID: id, Name: fmt.Sprintf("v_%d", id)}
+}
+
+// GenNewSequence returns a sequence with the default options, which are an ascending sequence from 1 with a cache.
+func (s *State) GenNewSequence() *Sequence {
+	id := s.alloc.AllocSequenceID()
+	return &Sequence{ID: id, Name: fmt.Sprintf("seq_%d", id), Start: 1, Increment: 1, MinValue: 1,
+		MaxValue: math.MaxInt64 - 1, Cache: 1000}
+}
+
 func (s *State) GenNewColumnWithType(tps ...ColumnType) *Column {
 	id := s.alloc.AllocColumnID()
 	col := &Column{ID: id, Name: fmt.Sprintf("col_%d", id)}
@@ -113,7 +131,83 @@ func (t *Table) GenRandValues(cols []*Column) []string {
 	}
 	row := make([]string, len(cols))
 	for i, c := range cols {
-		row[i] = c.RandomValue()
+		row[i] = c.RandomInsertValue()
+	}
+	t.satisfyConstraints(cols, row)
+	return row
+}
+
+// satisfyConstraints replaces the values of the columns cols in row which are likely to violate the constraints
+// of t. The values of a foreign key are taken from a referenced row, or null if there is no such row.
+func (t *Table) satisfyConstraints(cols Columns, row []string) {
+	for _, fk := range t.ForeignKeys {
+		ref := fk.RefTable.GetRandRow(fk.RefColumns)
+		for j, c := range fk.Columns {
+			i := cols.ByID(c.ID)
+			switch {
+			case i < 0:
+			case ref != nil:
+				row[i] = ref[j]
+			case !c.IsNotNull:
+				row[i] = "null"
+			}
+		}
+	}
+	for _, chk := range t.Checks {
+		i := cols.ByID(chk.Column.ID)
+		for retry := 0; i >= 0 && row[i] == chk.Violation && retry < 10; retry++ {
+			row[i] = chk.Column.RandomValue()
+		}
+	}
+}
+
+// ViolatingValues returns the values of some columns of t which violate a random foreign key or CHECK constraint,
+// and only the foreign keys unless checks is true. The values of a foreign key are not referenced by any row,
+// as far as the rows of the referenced table are known.
+func (t *Table) ViolatingValues(checks bool) (Columns, []string) {
+	numChecks := 0
+	if checks {
+		numChecks = len(t.Checks)
+	}
+	n := rand.Intn(len(t.ForeignKeys) + numChecks)
+	if n >= len(t.ForeignKeys) {
+		chk := t.Checks[n-len(t.ForeignKeys)]
+		return Columns{chk.Column}, []string{chk.Violation}
+	}
+	fk := t.ForeignKeys[n]
+	vals := make([]string, len(fk.Columns))
+	for retry := 0; retry < 10; retry++ {
+		for i, c := range fk.Columns {
+			vals[i] = c.RandomValuesAsc(1)[0]
+		}
+		if !fk.RefTable.HasRow(fk.RefColumns, vals) {
+			break
+		}
+	}
+	return fk.Columns, vals
+}
+
+// RandomInsertValue returns a random value to insert into the column. NULL or 0 is inserted into the
+// AUTO_INCREMENT column sometimes, and into the AUTO_RANDOM column always, so that the value is allocated.
+// The explicit values of an AUTO_RANDOM column are not allowed by default.
+func (c *Column) RandomInsertValue() string {
+	if c.AutoRandomBits > 0 || (c.IsAutoIncrement && rand.Intn(3) == 0) {
+		return []string{"null", "0"}[rand.Intn(2)]
+	}
+	return c.RandomValue()
+}
+
+// RowOfWritableValues returns a row of the table whose writable columns are filled with vals in order.
+// The values of the generated columns are not evaluated, so they are filled with the zero values.
+func (t *Table) RowOfWritableValues(vals []string) []string {
+	row := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		if c.Generated != nil {
+			row = append(row, c.ZeroValue())
+			continue
+		}
+		row = append(row, vals[0])
+		vals = vals[1:]
 	}
 	return row
 }
@@ -191,6 +285,22 @@ func (c *Column) ZeroValue() string {
 	}
 }
 
+// RandConstantOfType returns a random literal of the type.
+func RandConstantOfType(tp ColumnType) string {
+	col := &Column{Tp: tp, IsNotNull: rand.Intn(10) != 0, Collation: Collations[CollationUtf8mb4Bin]}
+	switch tp {
+	case ColumnTypeDecimal:
+		col.Arg1, col.Arg2 = 10, 2
+	case ColumnTypeBit:
+		col.Arg1 = 8
+	case ColumnTypeChar, ColumnTypeVarchar, ColumnTypeText, ColumnTypeBlob, ColumnTypeBinary, ColumnTypeVarBinary:
+		col.Arg1 = 10
+	case ColumnTypeEnum, ColumnTypeSet:
+		col.Args = []string{"Alice", "Bob", "Charlie", "David"}
+	}
+	return col.RandomValue()
+}
+
 func (c *Column) RandomValue() string {
 	if !c.IsNotNull && rand.Intn(30) == 0 {
 		return "null"
@@ -310,6 +420,64 @@ func RandJsons(count int) []string {
 	return res
 }
 
+var (
+	// jsonPaths are the paths which exist in the documents of RandJsons.
+	jsonPaths []string
+	// jsonWildcardPaths may match several values, they are not allowed in the modifying functions.
+	jsonWildcardPaths = []string{"$.*", "$[*]", "$**.sub_obj0", "$.obj1.*", "$**[0]"}
+	// jsonMissingPaths do not exist in any document.
+	jsonMissingPaths = []string{"$.obj9", "$[7]", "$.obj1.sub_obj9", `$."key with space"`}
+)
+
+func init() {
+	seen := make(map[string]struct{})
+	for _, docs := range jMap {
+		for _, doc := range docs {
+			raw, err := strconv.Unquote(doc)
+			if err != nil {
+				panic(err)
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(raw), &v); err != nil {
+				panic(err)
+			}
+			collectJSONPaths("$", v, seen)
+		}
+	}
+	for path := range seen {
+		jsonPaths = append(jsonPaths, path)
+	}
+	sort.Strings(jsonPaths)
+}
+
+func collectJSONPaths(prefix string, v interface{}, seen map[string]struct{}) {
+	seen[prefix] = struct{}{}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for key, sub := range x {
+			collectJSONPaths(prefix+"."+key, sub, seen)
+		}
+	case []interface{}:
+		for i, sub := range x {
+			collectJSONPaths(fmt.Sprintf("%s[%d]", prefix, i), sub, seen)
+		}
+	}
+}
+
+// RandJSONPath returns a quoted JSON path, which is likely to exist in the documents of RandJsons.
+func RandJSONPath(wildcard bool) string {
+	var path string
+	switch n := rand.Intn(10); {
+	case n < 7:
+		path = jsonPaths[rand.Intn(len(jsonPaths))]
+	case n < 9 && wildcard:
+		path = jsonWildcardPaths[rand.Intn(len(jsonWildcardPaths))]
+	default:
+		path = jsonMissingPaths[rand.Intn(len(jsonMissingPaths))]
+	}
+	return fmt.Sprintf("'%s'", path)
+}
+
 var asciiRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789~!@#$%^&*()_+=-")
 
 func RandStringRunes(n int, mixCNChar bool) string {
@@ -456,3 +624,69 @@ func RandomFloats(low, high float64, count int) []string {
 	}
 	return result
 }
+
+var (
+	// timeUnits are the units of TIMESTAMPDIFF and TIMESTAMPADD.
+	timeUnits = []string{"microsecond", "second", "minute", "hour", "day", "week", "month", "quarter", "year"}
+	// intervalUnits are the units of INTERVAL and EXTRACT, the composite ones take a string value like '1:2'.
+	intervalUnits = append(timeUnits, "second_microsecond", "minute_microsecond", "minute_second",
+		"hour_microsecond", "hour_second", "hour_minute", "day_microsecond", "day_second", "day_minute",
+		"day_hour", "year_month")
+	timeFormatSpecifiers = []string{"%a", "%b", "%c", "%D", "%d", "%e", "%f", "%H", "%h", "%I", "%i", "%j",
+		"%k", "%l", "%M", "%m", "%p", "%r", "%S", "%s", "%T", "%U", "%u", "%V", "%v", "%W", "%w", "%X", "%x",
+		"%Y", "%y", "%%"}
+)
+
+func RandTimeUnit() string {
+	return timeUnits[rand.Intn(len(timeUnits))]
+}
+
+func RandIntervalUnit() string {
+	return intervalUnits[rand.Intn(len(intervalUnits))]
+}
+
+// RandInterval returns an INTERVAL expression with a value matching the unit, e.g. interval '1:30' hour_minute.
+func RandInterval() string {
+	unit := RandIntervalUnit()
+	parts := strings.Count(unit, "_") + 1
+	if parts == 1 {
+		return fmt.Sprintf("interval %s %s", RandomNum(-1000, 1000), unit)
+	}
+	values := make([]string, parts)
+	for i := range values {
+		values[i] = RandomNum(0, 100)
+	}
+	sign := ""
+	if rand.Intn(4) == 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("interval '%s%s' %s", sign, strings.Join(values, ":"), unit)
+}
+
+// RandTimeFormat returns a quoted format string of DATE_FORMAT and STR_TO_DATE.
+func RandTimeFormat() string {
+	n := 1 + rand.Intn(4)
+	seps := []string{"-", ":", " ", "/", ""}
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(seps[rand.Intn(len(seps))])
+		}
+		sb.WriteString(timeFormatSpecifiers[rand.Intn(len(timeFormatSpecifiers))])
+	}
+	return fmt.Sprintf("'%s'", sb.String())
+}
+
+// RandTimeZoneOffset returns a quoted time zone offset. Named time zones are not used,
+// because MySQL returns NULL for them unless the time zone tables are loaded.
+func RandTimeZoneOffset() string {
+	offsets := []string{"+00:00", "+08:00", "-05:00", "+05:30", "-09:30", "+13:00", "-12:00"}
+	return fmt.Sprintf("'%s'", offsets[rand.Intn(len(offsets))])
+}
+
+var numericTypes = []ColumnType{ColumnTypeTinyInt, ColumnTypeInt, ColumnTypeBigInt, ColumnTypeBoolean,
+	ColumnTypeDecimal, ColumnTypeFloat, ColumnTypeDouble}
+
+func RandNumericType() ColumnType {
+	return numericTypes[rand.Intn(len(numericTypes))]
+}
@@ -1,5 +1,10 @@
 package sqlgen
 
+import (
+	"fmt"
+	"strings"
+)
+
 func (s *State) SetWeight(prod Fn, weight int) {
 	Assert(weight >= 0)
 	s.weight[prod.Info] = weight
@@ -19,18 +24,26 @@ func (s *State) AppendTable(t *Table) {
 	s.Tables = append(s.Tables, t)
 }
 
+// RemoveTable drops the table. The temporary tables cannot be restored by FLASHBACK TABLE.
 func (s *State) RemoveTable(t *Table) {
 	tmp := s.Tables[:0]
 	for _, tb := range s.Tables {
 		if tb.ID != t.ID {
 			tmp = append(tmp, tb)
-		} else {
+		} else if tb.Temporary == TempTableNone {
 			s.droppedTables = append(s.droppedTables, tb)
 		}
 	}
 	s.Tables = tmp
 }
 
+// RemoveView drops the view. The views reading it become invalid.
+func (s *State) RemoveView(v *Table) {
+	s.Views = s.Views.Filter(func(t *Table) bool {
+		return t.ID != v.ID
+	})
+}
+
 func (s *State) TruncateTable(t *Table) {
 	newTable := t.CloneCreateTableLike(s)
 	newTable.Name = t.Name
@@ -40,7 +53,24 @@ func (s *State) TruncateTable(t *Table) {
 			break
 		}
 	}
-	s.droppedTables = append(s.droppedTables, t)
+	if t.Temporary == TempTableNone {
+		s.droppedTables = append(s.droppedTables, t)
+	}
+}
+
+// BeginTxn starts an explicit transaction.
+func (s *State) BeginTxn() {
+	s.inTxn = true
+}
+
+// EndTxn ends the explicit transaction by COMMIT or ROLLBACK. The rows of the global temporary tables are deleted.
+func (s *State) EndTxn() {
+	s.inTxn = false
+	for _, t := range s.Tables {
+		if t.Temporary == TempTableGlobal {
+			t.Values = nil
+		}
+	}
 }
 
 func (s *State) FlashbackTable(t *Table) {
@@ -56,50 +86,6 @@ func (s *State) FlashbackTable(t *Table) {
 	s.AppendTable(t)
 }
 
-func (s *State) PushCTE(cte *Table) {
-	s.ctes[len(s.ctes)-1] = append(s.ctes[len(s.ctes)-1], cte)
-}
-
-func (s *State) PopCTE() []*Table {
-	if len(s.ctes) == 0 {
-		panic("0 CTEs")
-	}
-	tc := s.ctes[len(s.ctes)-1]
-	s.ctes = s.ctes[:len(s.ctes)-1]
-	return tc
-}
-
-func (s *State) CurrentCTE() *Table {
-	if len(s.ctes) == 0 {
-		return nil
-	}
-	l := s.ctes[len(s.ctes)-1]
-	if len(l) == 0 {
-		return nil
-	}
-	return l[len(l)-1]
-}
-
-func (s *State) LastCTEs() []*Table {
-	return s.ctes[len(s.ctes)-1]
-}
-
-func (s *State) ParentCTEColCount() int {
-	if len(s.ctes) < 2 {
-		return 0
-	}
-	ctes := s.ctes[len(s.ctes)-2]
-	return len(ctes[len(ctes)-1].Columns)
-}
-
-func (s *State) ParentCTE() *Table {
-	if len(s.ctes) < 2 {
-		return nil
-	}
-	ctes := s.ctes[len(s.ctes)-2]
-	return ctes[len(ctes)-1]
-}
-
 func (s *State) AppendPrepare(pre *Prepare) {
 	s.prepareStmts = append(s.prepareStmts, pre)
 }
@@ -263,9 +249,179 @@ func (t *Table) AppendRow(row []string) {
 	t.Values = append(t.Values, row)
 }
 
+// DeleteRows removes the rows of t which have the values vals in the columns cols, and applies the
+// referential actions of the foreign keys to the rows of the child tables. Nothing is changed and false is
+// returned if the deletion is restricted by a child row.
+func (s *State) DeleteRows(t *Table, cols Columns, vals []string) bool {
+	if !s.deleteRows(t, cols, vals, false) {
+		return false
+	}
+	s.deleteRows(t, cols, vals, true)
+	return true
+}
+
+// UpdateRows sets the column col of the rows of t which have the values vals in the columns cols to newVal,
+// and applies the referential actions like DeleteRows.
+func (s *State) UpdateRows(t *Table, cols Columns, vals []string, col *Column, newVal string) bool {
+	if !s.updateRows(t, cols, vals, col, newVal, false) {
+		return false
+	}
+	s.updateRows(t, cols, vals, col, newVal, true)
+	return true
+}
+
+// deleteRows only checks whether the rows can be deleted if apply is false.
+func (s *State) deleteRows(t *Table, cols Columns, vals []string, apply bool) bool {
+	rows := t.rowsOf(cols, vals)
+	fks, children := s.ReferencingKeys(t)
+	for i, fk := range fks {
+		for _, row := range rows {
+			key := t.ValuesOf(row, fk.RefColumns)
+			if containsNull(key) || !children[i].HasRow(fk.Columns, key) {
+				continue
+			}
+			switch fk.OnDelete {
+			case ReferOptionCascade:
+				if !s.deleteRows(children[i], fk.Columns, key, apply) {
+					return false
+				}
+			case ReferOptionSetNull:
+				if apply {
+					children[i].setNull(fk.Columns, key)
+				}
+			default:
+				return false
+			}
+		}
+	}
+	if apply {
+		matches := t.rowMatcher(cols, vals)
+		kept := t.Values[:0]
+		for _, row := range t.Values {
+			if !matches(row) {
+				kept = append(kept, row)
+			}
+		}
+		t.Values = kept
+	}
+	return true
+}
+
+// updateRows only checks whether the rows can be updated if apply is false.
+func (s *State) updateRows(t *Table, cols Columns, vals []string, col *Column, newVal string, apply bool) bool {
+	rows := t.rowsOf(cols, vals)
+	fks, children := s.ReferencingKeys(t)
+	for i, fk := range fks {
+		pos := fk.RefColumns.ByID(col.ID)
+		if pos < 0 {
+			continue
+		}
+		for _, row := range rows {
+			key := t.ValuesOf(row, fk.RefColumns)
+			if key[pos] == newVal || containsNull(key) || !children[i].HasRow(fk.Columns, key) {
+				continue
+			}
+			switch fk.OnUpdate {
+			case ReferOptionCascade:
+				if !s.updateRows(children[i], fk.Columns, key, fk.Columns[pos], newVal, apply) {
+					return false
+				}
+			case ReferOptionSetNull:
+				if apply {
+					children[i].setNull(fk.Columns, key)
+				}
+			default:
+				return false
+			}
+		}
+	}
+	if apply {
+		offset := t.Columns.ByID(col.ID)
+		for _, row := range rows {
+			row[offset] = newVal
+		}
+	}
+	return true
+}
+
+// setNull sets the columns cols of the rows of t which have the values vals in them to null.
+func (t *Table) setNull(cols Columns, vals []string) {
+	for _, row := range t.rowsOf(cols, vals) {
+		for _, c := range cols {
+			row[t.Columns.ByID(c.ID)] = "null"
+		}
+	}
+}
+
+func containsNull(vals []string) bool {
+	for _, v := range vals {
+		if strings.EqualFold(v, "null") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDef returns a RANGE or LIST partition, which is named by NextID.
+func (p *Partition) NewDef(values []string) *PartitionDef {
+	def := &PartitionDef{Name: fmt.Sprintf("p%d", p.NextID), Values: values}
+	p.NextID++
+	return def
+}
+
+func (p *Partition) AppendDef(values []string) *PartitionDef {
+	def := p.NewDef(values)
+	p.Defs = append(p.Defs, def)
+	return def
+}
+
+// ResizeHash sets the number of the HASH or KEY partitions, which are named by p0, p1, ...
+func (p *Partition) ResizeHash(n int) {
+	p.Defs = make([]*PartitionDef, n)
+	for i := range p.Defs {
+		p.Defs[i] = &PartitionDef{Name: fmt.Sprintf("p%d", i)}
+	}
+}
+
+func (p *Partition) RemoveDefs(defs []*PartitionDef) {
+	p.ReplaceDefs(defs, nil)
+}
+
+// ReplaceDefs replaces the partitions olds by news, which are put at the position of the first one in olds.
+func (p *Partition) ReplaceDefs(olds, news []*PartitionDef) {
+	defs := make([]*PartitionDef, 0, len(p.Defs)-len(olds)+len(news))
+	replaced := false
+	for _, def := range p.Defs {
+		if !containsPartitionDef(olds, def) {
+			defs = append(defs, def)
+		} else if !replaced {
+			defs = append(defs, news...)
+			replaced = true
+		}
+	}
+	p.Defs = defs
+}
+
+func containsPartitionDef(defs []*PartitionDef, def *PartitionDef) bool {
+	for _, d := range defs {
+		if d == def {
+			return true
+		}
+	}
+	return false
+}
+
 func (i *Index) AppendColumn(col *Column, prefix int) {
 	i.Columns = append(i.Columns, col)
 	i.ColumnPrefix = append(i.ColumnPrefix, prefix)
+	i.Funcs = append(i.Funcs, "")
+}
+
+// AppendExprColumn appends the key part fn(col) to an expression index.
+func (i *Index) AppendExprColumn(col *Column, fn string) {
+	i.Columns = append(i.Columns, col)
+	i.ColumnPrefix = append(i.ColumnPrefix, 0)
+	i.Funcs = append(i.Funcs, fn)
 }
 
 func (i *Index) AppendColumnIfNotExists(cols ...*Column) {
@@ -282,6 +438,7 @@ func (i *Index) AppendColumnIfNotExists(cols ...*Column) {
 		}
 		i.Columns = append(i.Columns, c)
 		i.ColumnPrefix = append(i.ColumnPrefix, 0)
+		i.Funcs = append(i.Funcs, "")
 	}
 }
 
@@ -292,3 +449,62 @@ func (p *Prepare) AppendColumns(cols ...*Column) {
 		})
 	}
 }
+
+// NextCastPair returns the next pair in CastMatrix which satisfies the pred, and moves the cursor after it.
+func (s *State) NextCastPair(pred func(CastPair) bool) (CastPair, bool) {
+	for i := 0; i < len(CastMatrix); i++ {
+		pos := (s.castCursor + i) % len(CastMatrix)
+		if pred(CastMatrix[pos]) {
+			s.castCursor = pos + 1
+			return CastMatrix[pos], true
+		}
+	}
+	return CastPair{}, false
+}
+
+// RemoveSequence drops the sequence.
+func (s *State) RemoveSequence(seq *Sequence) {
+	s.Sequences = s.Sequences.Filter(func(ss *Sequence) bool {
+		return ss.ID != seq.ID
+	})
+}
+
+// Restart makes the sequence start over from Start, so that its next value is known again.
+func (seq *Sequence) Restart() {
+	seq.Next, seq.NextKnown = seq.Start, true
+}
+
+// SkipValues makes the next value unknown, e.g. after NEXTVAL is evaluated for an unknown number of rows.
+func (seq *Sequence) SkipValues() {
+	seq.NextKnown = false
+}
+
+// NextVal takes the next value like NEXTVAL. It returns false if the value is unknown or the values have run out,
+// in which case the sequence is not changed.
+func (seq *Sequence) NextVal() (int64, bool) {
+	if !seq.NextKnown {
+		return 0, false
+	}
+	if seq.Next < seq.MinValue || seq.Next > seq.MaxValue {
+		if !seq.Cycle {
+			return 0, false
+		}
+		seq.Next = seq.MinValue
+		if seq.Increment < 0 {
+			seq.Next = seq.MaxValue
+		}
+	}
+	v := seq.Next
+	seq.Next += seq.Increment
+	return v, true
+}
+
+// SetVal sets the last value like SETVAL. The value is ignored if it is behind the next value.
+func (seq *Sequence) SetVal(v int64) {
+	if !seq.NextKnown {
+		return
+	}
+	if (seq.Increment > 0 && v >= seq.Next) || (seq.Increment < 0 && v <= seq.Next) {
+		seq.Next = v + seq.Increment
+	}
+}
@@ -4,6 +4,14 @@ var NoTooMuchTables = func(s *State) bool {
 	return len(s.Tables) < 20
 }
 
+var NoTooDeepExpr = func(s *State) bool {
+	return s.env.ExprDepth < 3
+}
+
+var NoTooDeepSubQuery = func(s *State) bool {
+	return s.env.SubQueryDepth < 2
+}
+
 var HasModifiableIndexes = func(s *State) bool {
 	cnt := len(s.Env().Table.Indexes)
 	switch cnt {
@@ -20,6 +28,40 @@ var HasTables = func(s *State) bool {
 	return len(s.Tables) >= 1
 }
 
+// HasPersistentTables means some tables are not temporary, e.g. for the statements which are not supported
+// on the temporary tables.
+var HasPersistentTables = func(s *State) bool {
+	return len(s.PersistentTables()) > 0
+}
+
+var IsNotTemporary = func(s *State) bool {
+	return s.env.Table.Temporary == TempTableNone
+}
+
+var HasViews = func(s *State) bool {
+	return len(s.Views) > 0
+}
+
+var IsPartitioned = func(s *State) bool {
+	return s.env.Table.Partition != nil
+}
+
+// HasDroppablePartitions means some RANGE or LIST partitions can be dropped or merged.
+var HasDroppablePartitions = func(s *State) bool {
+	part := s.env.Table.Partition
+	return part != nil && !part.Tp.IsHash() && len(part.Defs) > 1
+}
+
+var HasCoalescablePartitions = func(s *State) bool {
+	part := s.env.Table.Partition
+	return part != nil && part.Tp.IsHash() && len(part.Defs) > 1
+}
+
+// HasPartitionableColumn means env.Table can be partitioned. The tables in foreign keys cannot be partitioned.
+var HasPartitionableColumn = func(s *State) bool {
+	return !s.InForeignKey(s.env.Table) && len(partitionableColumns(s.env.Table)) > 0
+}
+
 var HasDroppedTables = func(s *State) bool {
 	return len(s.droppedTables) > 0
 }
@@ -31,8 +73,23 @@ var MoreThan1Columns = func(s *State) bool {
 
 var HasDroppableColumn = func(s *State) bool {
 	tbl := s.env.Table
+	updatable := tbl.UpdatableColumns()
 	for _, c := range tbl.Columns {
-		if !c.HasIndex(tbl) {
+		if !c.HasIndex(tbl) && !c.IsAutoAllocated() && !tbl.PartitionColumns().Contain(c) &&
+			!tbl.ExprDepColumns().Contain(c) && !s.ConstraintColumns(tbl).Contain(c) &&
+			!(len(updatable) == 1 && updatable.Contain(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+var HasModifiableColumn = func(s *State) bool {
+	tbl := s.env.Table
+	pk := tbl.Indexes.Primary()
+	for _, c := range tbl.Columns {
+		if (pk == nil || !pk.HasColumn(c)) && c.Generated == nil && !c.IsAutoAllocated() &&
+			!tbl.PartitionColumns().Contain(c) && !tbl.ExprDepColumns().Contain(c) && !s.ConstraintColumns(tbl).Contain(c) {
 			return true
 		}
 	}
@@ -62,6 +119,44 @@ var IndexColumnCanHaveNoPrefix = func(s *State) bool {
 	return !col.Tp.NeedKeyLength()
 }
 
+// IndexColumnExpressible means the index column can be used in an expression key part.
+var IndexColumnExpressible = func(s *State) bool {
+	col := s.env.IdxColumn
+	return (col.Tp == ColumnTypeChar || col.Tp == ColumnTypeVarchar) && col.Generated == nil &&
+		s.env.Index.Tp != IndexTypePrimary && !s.env.Table.PartitionColumns().Contain(col)
+}
+
+// HasIndexedExprs means the table has some expression key parts or generated columns.
+var HasIndexedExprs = func(s *State) bool {
+	tbl := s.env.Table
+	if tbl.Columns.Found(func(c *Column) bool {
+		return c.Generated != nil
+	}) {
+		return true
+	}
+	return baseTable(tbl).Indexes.Found(func(i *Index) bool {
+		for _, fn := range i.Funcs {
+			if fn != "" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+var HasNoAutoColumn = func(s *State) bool {
+	return s.env.Table.AutoColumn() == nil
+}
+
+// CanDefineIndexes means the indexes are not disabled, e.g. the auto columns can be defined as keys.
+var CanDefineIndexes = func(s *State) bool {
+	return s.GetWeight(IndexDefinitions) > 0
+}
+
+var HasNoPrimaryKey = func(s *State) bool {
+	return s.env.Table.Indexes.Primary() == nil
+}
+
 var HasNonPKCol = func(s *State) bool {
 	tbl := s.env.Table
 	pk := tbl.Indexes.Primary()
@@ -79,8 +174,14 @@ var isShardableColumn = func(c *Column) bool {
 
 var HasSameColumnType = func(s *State) bool {
 	col := s.env.Column
-	t, _ := GetRandTableColumnWithTp(s.Tables, col.Tp)
-	return t != nil
+	for _, t := range s.Tables {
+		for _, c := range t.Columns {
+			if c.Tp == col.Tp {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 var ModifyColumnCompatible = func(oldCol *Column, newColTp ColumnType) bool {
@@ -127,3 +228,49 @@ var CharsetCompatible = func(from, to *Column) bool {
 	}
 	return true
 }
+
+// CanReferenceTables means env.Table can define a foreign key referencing another table in CREATE TABLE.
+var CanReferenceTables = func(s *State) bool {
+	tbl := s.env.Table
+	return tbl.Partition == nil && tbl.Temporary == TempTableNone && len(referableTables(s, tbl)) > 0
+}
+
+var HasForeignKeyCandidates = func(s *State) bool {
+	return len(foreignKeyCandidates(s, s.env.Table)) > 0
+}
+
+var HasForeignKeys = func(s *State) bool {
+	return len(s.env.Table.ForeignKeys) > 0
+}
+
+var HasCheckableColumns = func(s *State) bool {
+	return len(checkableColumns(s.env.Table)) > 0
+}
+
+var HasChecks = func(s *State) bool {
+	return len(s.env.Table.Checks) > 0
+}
+
+// IsCheckEnabled means the CHECK constraints can be added, dropped and violated.
+var IsCheckEnabled = func(s *State) bool {
+	return !s.checkDisabled
+}
+
+// HasConstraints means env.Table has some foreign keys or enforced CHECK constraints to violate.
+var HasConstraints = func(s *State) bool {
+	return HasForeignKeys(s) || (HasChecks(s) && IsCheckEnabled(s))
+}
+
+// HasReferencedRows means env.Table is referenced by some foreign keys, and has some rows.
+var HasReferencedRows = func(s *State) bool {
+	return s.IsReferenced(s.env.Table) && len(s.env.Table.Values) > 0
+}
+
+var HasSequences = func(s *State) bool {
+	return len(s.Sequences) > 0
+}
+
+// HasNextValColumns means some columns of env.Table can take the values of the sequences.
+var HasNextValColumns = func(s *State) bool {
+	return len(s.Sequences) > 0 && len(nextValColumns(s.env.Table)) > 0
+}
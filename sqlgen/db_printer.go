@@ -32,15 +32,15 @@ func PrintRandValues(values []string) string {
 }
 
 // partition p0 values less than (v0), partition p1...
-func PrintRangePartitionDefs(rangeValues []string) string {
+func PrintRangePartitionDefs(defs []*PartitionDef) string {
 	var sb strings.Builder
-	for i, v := range rangeValues {
+	for i, def := range defs {
 		sb.WriteString("partition ")
-		sb.WriteString(fmt.Sprintf("p%d ", i))
-		sb.WriteString("values less than (")
-		sb.WriteString(v)
+		sb.WriteString(def.Name)
+		sb.WriteString(" values less than (")
+		sb.WriteString(PrintRandValues(def.Values))
 		sb.WriteString(")")
-		if i != len(rangeValues)-1 {
+		if i != len(defs)-1 {
 			sb.WriteString(", ")
 		}
 	}
@@ -48,27 +48,44 @@ func PrintRangePartitionDefs(rangeValues []string) string {
 }
 
 // partition p0 values in (v0, v1, v2), partition p1...
-func PrintListPartitionDefs(listGroups [][]string) string {
+func PrintListPartitionDefs(defs []*PartitionDef) string {
 	var sb strings.Builder
-	for i, group := range listGroups {
+	for i, def := range defs {
 		sb.WriteString("partition ")
-		sb.WriteString(fmt.Sprintf("p%d ", i))
-		sb.WriteString("values in (")
-		sb.WriteString(PrintRandValues(group))
+		sb.WriteString(def.Name)
+		sb.WriteString(" values in (")
+		sb.WriteString(PrintRandValues(def.Values))
 		sb.WriteString(")")
-		if i != len(listGroups)-1 {
+		if i != len(defs)-1 {
 			sb.WriteString(", ")
 		}
 	}
 	return sb.String()
 }
 
+// PrintPartitionDefs prints the definitions of the RANGE or LIST partitions.
+func PrintPartitionDefs(tp PartitionType, defs []*PartitionDef) string {
+	if tp.IsRange() {
+		return PrintRangePartitionDefs(defs)
+	}
+	return PrintListPartitionDefs(defs)
+}
+
 func PrintRandomAssignments(cols []*Column) string {
+	vals := make([]string, len(cols))
+	for i, col := range cols {
+		vals[i] = col.RandomValue()
+	}
+	return PrintAssignments(cols, vals)
+}
+
+// PrintAssignments prints the assignments of vals to cols, e.g. a = 1, b = 'x'.
+func PrintAssignments(cols []*Column, vals []string) string {
 	var sb strings.Builder
 	for i, col := range cols {
 		sb.WriteString(col.Name)
 		sb.WriteString(" = ")
-		sb.WriteString(col.RandomValue())
+		sb.WriteString(vals[i])
 		if i != len(cols)-1 {
 			sb.WriteString(", ")
 		}
@@ -166,24 +183,13 @@ func PrintPredicateIn(cols []*Column, values [][]string) string {
 	return sb.String()
 }
 
-func PrintColumnWithFunction(col *Column) string {
-	switch col.Tp {
-	case ColumnTypeInt:
-		return fmt.Sprintf("%s+1", col.Name)
-	case ColumnTypeChar:
-		return fmt.Sprintf("concat(%s, 1)", col.Name)
-	}
-
-	return col.Name
-}
-
-func PrintConstantWithFunction(tp ColumnType) string {
-	switch tp {
-	case ColumnTypeInt:
-		return fmt.Sprintf("1+1")
-	case ColumnTypeChar:
-		return fmt.Sprintf("concat('a', 1)")
+// PrintTableReference prints the table in the FROM clause, with the alias if it is a derived or an aliased table.
+func PrintTableReference(t *Table) string {
+	switch {
+	case t.Derived != "":
+		return fmt.Sprintf("%s as %s", t.Derived, t.Name)
+	case t.AliasOf != nil:
+		return fmt.Sprintf("%s as %s", t.AliasOf.Name, t.Name)
 	}
-
-	return "1"
+	return t.Name
 }
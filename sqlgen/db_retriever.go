@@ -2,10 +2,8 @@ package sqlgen
 
 import (
 	"fmt"
-	"math"
 	"math/rand"
-
-	"github.com/cznic/mathutil"
+	"reflect"
 )
 
 type Tables []*Table
@@ -27,6 +25,19 @@ func (ts Tables) ByID(id int) *Table {
 	return nil
 }
 
+func (ts Tables) ByName(name string) *Table {
+	for _, t := range ts {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (ts Tables) Contain(t *Table) bool {
+	return gContain(ts, t)
+}
+
 func (ts Tables) Filter(pred func(*Table) bool) Tables {
 	return gFilter(ts, pred)
 }
@@ -47,32 +58,41 @@ func (ts Tables) Append(t *Table) Tables {
 
 type Columns []*Column
 
-func (s *State) GetRandTableOrCTE() *Table {
-	return s.GetRandTableOrCTEs()[0]
+type Sequences []*Sequence
+
+func (ss Sequences) Rand() *Sequence {
+	return gRand1(ss)
 }
 
-func (s *State) GetRandTableOrCTEs() Tables {
-	tbls := make([]*Table, 0)
-	for _, t := range s.Tables {
-		tbls = append(tbls, t)
-	}
-	for _, cte := range s.ctes {
-		for _, c := range cte {
-			tbls = append(tbls, c)
+func (ss Sequences) ByName(name string) *Sequence {
+	for _, s := range ss {
+		if s.Name == name {
+			return s
 		}
 	}
+	return nil
+}
 
-	rand.Shuffle(len(tbls), func(i, j int) {
-		tbls[i], tbls[j] = tbls[j], tbls[i]
-	})
-	tbls = tbls[:mathutil.Min(10, len(tbls))]
-	n := len(tbls)
-	x := rand.Intn(n * n * (n + 1) * (n + 1) / 4)
-	return tbls[:n-(int(math.Sqrt(2*math.Sqrt(float64(x))+0.25)-0.5))]
+func (ss Sequences) Filter(pred func(*Sequence) bool) Sequences {
+	return gFilter(ss, pred)
 }
 
-func (s *State) IncCTEDeep() {
-	s.ctes = append(s.ctes, make([]*Table, 0))
+// Predictable means the next value of the sequence is known. The values of a cached sequence are not
+// predictable, because the cache is discarded by the server from time to time.
+func (seq *Sequence) Predictable() bool {
+	return seq.NextKnown && seq.Cache == 0
+}
+
+// IsSequenceInUse means the sequence is the default value of some columns.
+func (s *State) IsSequenceInUse(seq *Sequence) bool {
+	for _, t := range s.Tables {
+		for _, c := range t.Columns {
+			if c.DefaultSeq != nil && c.DefaultSeq.ID == seq.ID {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (s *State) GetRandPrepare() *Prepare {
@@ -148,6 +168,77 @@ func (t *Table) CloneCreateTableLike(state *State) *Table {
 	return newTable
 }
 
+// WritableColumns returns the columns which can be written directly, i.e. the columns which are not generated.
+func (t *Table) WritableColumns() Columns {
+	return t.Columns.Filter(func(c *Column) bool {
+		return c.Generated == nil
+	})
+}
+
+// ExprDepColumns returns the columns which are referenced by the generated columns or the expression indexes.
+// They cannot be dropped, modified or renamed.
+func (t *Table) ExprDepColumns() Columns {
+	var deps Columns
+	for _, c := range t.Columns {
+		if c.Generated != nil {
+			deps = append(deps, c.Generated.Deps...)
+		}
+	}
+	for _, idx := range t.Indexes {
+		for i, c := range idx.Columns {
+			if idx.Funcs[i] != "" {
+				deps = append(deps, c)
+			}
+		}
+	}
+	return deps
+}
+
+// PartitionColumns returns the partitioning columns, or nil if the table is not partitioned.
+func (t *Table) PartitionColumns() Columns {
+	if t.Partition == nil {
+		return nil
+	}
+	return t.Partition.Columns
+}
+
+// SameStructureAs means the tables have the same columns and indexes, e.g. the tables created by CREATE TABLE LIKE.
+func (t *Table) SameStructureAs(other *Table) bool {
+	if len(t.Columns) != len(other.Columns) || len(t.Indexes) != len(other.Indexes) || len(t.Checks) != len(other.Checks) ||
+		t.Collate != other.Collate || t.Clustered != other.Clustered {
+		return false
+	}
+	for i, chk := range t.Checks {
+		if chk.Expr != other.Checks[i].Expr || chk.Column.Name != other.Checks[i].Column.Name {
+			return false
+		}
+	}
+	for i, c := range t.Columns {
+		if c.String() != other.Columns[i].String() {
+			return false
+		}
+	}
+	for i, idx := range t.Indexes {
+		otherIdx := other.Indexes[i]
+		if idx.String() != otherIdx.String() || !reflect.DeepEqual(idx.ColumnPrefix, otherIdx.ColumnPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefOfValue returns the LIST partition which contains the value, or nil if there is none.
+func (p *Partition) DefOfValue(val string) *PartitionDef {
+	for _, def := range p.Defs {
+		for _, v := range def.Values {
+			if v == val {
+				return def
+			}
+		}
+	}
+	return nil
+}
+
 func (cols Columns) Filter(pred func(c *Column) bool) Columns {
 	return gFilter(cols, pred)
 }
@@ -223,6 +314,54 @@ func (cols Columns) Or(others Columns) Columns {
 	return cols
 }
 
+// SameFullTypeAs means c has the same type as other, including the length, the sign, the collation
+// and the elements of ENUM and SET, e.g. a foreign key column and the referenced column.
+func (c *Column) SameFullTypeAs(other *Column) bool {
+	if c.Tp != other.Tp || c.Arg1 != other.Arg1 || c.Arg2 != other.Arg2 || c.IsUnsigned != other.IsUnsigned ||
+		len(c.Args) != len(other.Args) {
+		return false
+	}
+	if c.Tp.IsStringType() && c.Collation != other.Collation {
+		return false
+	}
+	for i := range c.Args {
+		if c.Args[i] != other.Args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAutoAllocated means the values of the column can be allocated by AUTO_INCREMENT or AUTO_RANDOM.
+func (c *Column) IsAutoAllocated() bool {
+	return c.IsAutoIncrement || c.AutoRandomBits > 0
+}
+
+// AutoColumn returns the AUTO_INCREMENT or AUTO_RANDOM column, or nil if there is none.
+func (t *Table) AutoColumn() *Column {
+	for _, c := range t.Columns {
+		if c.IsAutoAllocated() {
+			return c
+		}
+	}
+	return nil
+}
+
+// UpdatableColumns returns the columns which can be updated, i.e. the writable columns except the
+// AUTO_RANDOM column, whose values cannot be specified explicitly.
+func (t *Table) UpdatableColumns() Columns {
+	return t.WritableColumns().Filter(func(c *Column) bool {
+		return c.AutoRandomBits == 0
+	})
+}
+
+// LeadsIndex means the column is the first column of some index of t.
+func (c *Column) LeadsIndex(t *Table) bool {
+	return t.Indexes.Found(func(i *Index) bool {
+		return i.Columns[0].ID == c.ID
+	})
+}
+
 func (c *Column) HasIndex(t *Table) bool {
 	for _, idx := range t.Indexes {
 		if idx.HasColumn(c) {
@@ -274,3 +413,192 @@ func (p *Prepare) UserVars() []string {
 	}
 	return userVars
 }
+
+// ReferencingKeys returns the foreign keys of the other tables which reference t, and the tables they belong to.
+func (s *State) ReferencingKeys(t *Table) ([]*ForeignKey, Tables) {
+	var fks []*ForeignKey
+	var children Tables
+	for _, child := range s.Tables {
+		for _, fk := range child.ForeignKeys {
+			if fk.RefTable == t {
+				fks = append(fks, fk)
+				children = append(children, child)
+			}
+		}
+	}
+	return fks, children
+}
+
+// IsReferenced means some foreign keys reference t. Such a table cannot be dropped or truncated.
+func (s *State) IsReferenced(t *Table) bool {
+	fks, _ := s.ReferencingKeys(t)
+	return len(fks) > 0
+}
+
+// InForeignKey means t references or is referenced by some foreign keys. Such a table cannot be partitioned.
+func (s *State) InForeignKey(t *Table) bool {
+	return len(t.ForeignKeys) > 0 || s.IsReferenced(t)
+}
+
+// ConstraintColumns returns the columns of t in the foreign keys and the CHECK constraints, including
+// the columns referenced by the foreign keys of the other tables. They cannot be dropped, modified or renamed.
+func (s *State) ConstraintColumns(t *Table) Columns {
+	var cols Columns
+	for _, fk := range t.ForeignKeys {
+		cols = append(cols, fk.Columns...)
+	}
+	for _, chk := range t.Checks {
+		cols = append(cols, chk.Column)
+	}
+	fks, _ := s.ReferencingKeys(t)
+	for _, fk := range fks {
+		cols = append(cols, fk.RefColumns...)
+	}
+	return cols
+}
+
+// IsForeignKeyIndex means the index of t is needed by a foreign key of t, or by a foreign key referencing t.
+func (s *State) IsForeignKeyIndex(t *Table, idx *Index) bool {
+	for _, fk := range t.ForeignKeys {
+		if idx.LedBy(fk.Columns) {
+			return true
+		}
+	}
+	fks, _ := s.ReferencingKeys(t)
+	for _, fk := range fks {
+		if idx.LedBy(fk.RefColumns) {
+			return true
+		}
+	}
+	return false
+}
+
+// LedBy means the columns cols are the first key parts of the index in order, without the prefix.
+func (i *Index) LedBy(cols Columns) bool {
+	if len(i.Columns) < len(cols) {
+		return false
+	}
+	for j, c := range cols {
+		if i.Columns[j].ID != c.ID || i.Funcs[j] != "" || i.ColumnPrefix[j] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ReferableKeys returns the unique keys of t which can be referenced by foreign keys. The key parts are
+// columns of the types usable in foreign keys, without the prefix. The keys with auto columns are not used,
+// because the allocated values are unknown, and cannot be referenced by the inserted rows.
+func (t *Table) ReferableKeys() Indexes {
+	if t.Partition != nil {
+		return nil
+	}
+	return t.Indexes.Filter(func(i *Index) bool {
+		if !i.IsUnique() {
+			return false
+		}
+		for j, c := range i.Columns {
+			if !c.Tp.IsForeignKeyType() || c.Generated != nil || c.IsAutoAllocated() || i.Funcs[j] != "" || i.ColumnPrefix[j] != 0 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// HasRow means some row of t has the values vals in the columns cols.
+func (t *Table) HasRow(cols Columns, vals []string) bool {
+	return len(t.rowsOf(cols, vals)) > 0
+}
+
+// rowsOf returns the rows of t which have the values vals in the columns cols.
+func (t *Table) rowsOf(cols Columns, vals []string) [][]string {
+	matches := t.rowMatcher(cols, vals)
+	var rows [][]string
+	for _, row := range t.Values {
+		if matches(row) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func (t *Table) rowMatcher(cols Columns, vals []string) func(row []string) bool {
+	offsets := make([]int, len(cols))
+	for i, c := range cols {
+		offsets[i] = t.Columns.ByID(c.ID)
+	}
+	return func(row []string) bool {
+		for i, offset := range offsets {
+			if row[offset] != vals[i] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ValuesOf returns the values of the columns cols in the row of t.
+func (t *Table) ValuesOf(row []string, cols Columns) []string {
+	vals := make([]string, len(cols))
+	for i, c := range cols {
+		vals[i] = row[t.Columns.ByID(c.ID)]
+	}
+	return vals
+}
+
+// ReadableTables returns the tables and the valid views which can be read in a query. A view only reads the
+// persistent tables and the views defined before it. The views are not read in UPDATE and DELETE, because they
+// may read the target table.
+func (s *State) ReadableTables() Tables {
+	tbls := make(Tables, 0, len(s.Tables)+len(s.Views))
+	if s.env.View != nil {
+		tbls = append(tbls, s.PersistentTables()...)
+	} else {
+		tbls = append(tbls, s.Tables...)
+	}
+	if s.env.IsIn("CommonDelete") || s.env.IsIn("CommonUpdate") {
+		return tbls
+	}
+	for _, v := range s.Views {
+		if (s.env.View == nil || v.ID < s.env.View.ID) && s.IsValidView(v) {
+			tbls = append(tbls, v)
+		}
+	}
+	return tbls
+}
+
+// PersistentTables returns the tables which are not temporary.
+func (s *State) PersistentTables() Tables {
+	return s.Tables.Filter(func(t *Table) bool {
+		return t.Temporary == TempTableNone
+	})
+}
+
+// KeepsRows reports whether the rows written to t are kept after the statement. The rows of a global temporary
+// table are deleted when the transaction is committed, so they are only kept in an explicit transaction.
+func (s *State) KeepsRows(t *Table) bool {
+	return t.Temporary != TempTableGlobal || s.inTxn
+}
+
+// IsValidView reports whether the tables and the views read by the view still exist with all the columns
+// they had when the view was defined. The names are resolved when the view is queried, like the server does.
+func (s *State) IsValidView(v *Table) bool {
+	for _, dep := range v.View.Deps {
+		t := s.Tables.ByName(dep.Name)
+		if t == nil {
+			t = s.Views.ByName(dep.Name)
+			if t == nil || !s.IsValidView(t) {
+				return false
+			}
+		}
+		for _, name := range dep.Columns {
+			if !t.Columns.Found(func(c *Column) bool {
+				return c.Name == name
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,9 +1,11 @@
 package sqlgen_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/pingcap/tidb/parser"
 	"github.com/stretchr/testify/require"
 )
 
@@ -11,3 +13,13 @@ func TestRandGBKStrings(t *testing.T) {
 	res := sqlgen.RandGBKStringRunes(10)
 	require.Greater(t, len(res), 10, res)
 }
+
+func TestRandTimeArgs(t *testing.T) {
+	p := parser.New()
+	for i := 0; i < 200; i++ {
+		query := fmt.Sprintf("select date_add(now(), %s), date_format(now(), %s), convert_tz(now(), %s, %s), timestampdiff(%s, now(), now())",
+			sqlgen.RandInterval(), sqlgen.RandTimeFormat(), sqlgen.RandTimeZoneOffset(), sqlgen.RandTimeZoneOffset(), sqlgen.RandTimeUnit())
+		_, _, err := p.ParseSQL(query)
+		require.NoError(t, err, query)
+	}
+}
@@ -12,21 +12,33 @@ type State struct {
 
 	Tables        Tables
 	droppedTables Tables
+	// Views are read-only, they are only referenced in the queries.
+	Views Tables
+	// Sequences are read by NEXTVAL, LASTVAL and SETVAL, and by the default values of the columns.
+	Sequences Sequences
 
-	ctes  [][]*Table
 	alloc *IDAllocator
 
 	env *Env
 
 	prepareStmts []*Prepare
 
+	// castCursor is the position of the next pair in CastMatrix.
+	castCursor int
+
+	// inTxn means the statements are in an explicit transaction. Otherwise every statement is committed.
+	inTxn bool
+
+	// checkDisabled means tidb_enable_check_constraint is off, so the CHECK constraints are neither
+	// added, dropped nor enforced, though the existing ones are kept.
+	checkDisabled bool
+
 	fnStack string
 }
 
 type Table struct {
 	ID        int
 	Name      string
-	AsName    string
 	Columns   Columns
 	Indexes   Indexes
 	Collate   *Collation
@@ -37,6 +49,23 @@ type Table struct {
 	Values            [][]string
 	ColForPrefixIndex Columns
 
+	// Derived is the subquery of a derived table, and Name is its alias.
+	Derived string
+	// AliasOf is the table referenced by the alias Name, e.g. in a self-join.
+	AliasOf *Table
+
+	// Partition is the partitioning of the table, or nil if the table is not partitioned.
+	Partition *Partition
+
+	// ForeignKeys reference the other tables. A table never references itself.
+	ForeignKeys []*ForeignKey
+	Checks      []*Check
+
+	// View is the definition of a view, or nil if the table is not a view.
+	View *View
+	// Temporary is the kind of a temporary table, or TempTableNone if the table is persistent.
+	Temporary TempTableType
+
 	// ChildTables records tables that have the same structure.
 	// A table is also its ChildTables.
 	// This is used for SELECT OUT FILE and LOAD DATA.
@@ -56,6 +85,22 @@ type Column struct {
 	Args       []string // for ColumnTypeSet and ColumnTypeEnum
 	DefaultVal string
 	IsNotNull  bool
+
+	// Generated is the expression of a generated column, or nil if the column is not generated.
+	Generated *Generated
+	// IsAutoIncrement and AutoRandomBits mean the values of the column can be allocated by the server.
+	// AutoRandomBits is the shard bits of an AUTO_RANDOM column, or 0 if the column is not AUTO_RANDOM.
+	IsAutoIncrement bool
+	AutoRandomBits  int
+	// DefaultSeq is the sequence whose NEXTVAL is the default value of the column, or nil.
+	DefaultSeq *Sequence
+}
+
+// Generated is the expression of a generated column. The verbs in Expr are replaced by the names of Deps.
+type Generated struct {
+	Expr   string
+	Deps   Columns
+	Stored bool
 }
 
 type Index struct {
@@ -64,6 +109,77 @@ type Index struct {
 	Tp           IndexType
 	Columns      Columns
 	ColumnPrefix []int
+	// Funcs[i] is the function applied to Columns[i] in an expression index, e.g. lower.
+	// It is empty if the key part is the column itself.
+	Funcs []string
+}
+
+type Partition struct {
+	Tp      PartitionType
+	Columns Columns
+	// Func is the function applied to the partitioning column of HASH, RANGE and LIST, e.g. year.
+	// The column is used directly if Func is empty.
+	Func string
+	// Defs are the partitions in order. The partitions of HASH and KEY are always named by p0, p1, ...
+	Defs []*PartitionDef
+	// NextID is used to name the new partitions of RANGE and LIST.
+	NextID int
+}
+
+// PartitionDef is a partition. Values is the upper bound of RANGE, or the values of LIST.
+type PartitionDef struct {
+	Name   string
+	Values []string
+}
+
+// ForeignKey references the columns RefColumns of RefTable by Columns, which have the same types.
+type ForeignKey struct {
+	Name       string
+	Columns    Columns
+	RefTable   *Table
+	RefColumns Columns
+	OnDelete   ReferOption
+	OnUpdate   ReferOption
+}
+
+// Check is a CHECK constraint on a column. The verb in Expr is replaced by the name of Column.
+// Violation is a value of the column which violates the constraint.
+type Check struct {
+	Name      string
+	Column    *Column
+	Expr      string
+	Violation string
+}
+
+// View is the query of a view. The columns of the view are typed by the fields of Query.
+// Deps are the tables and the views read by Query. The view is valid as long as they keep the columns in Deps.
+type View struct {
+	Query string
+	Deps  []*ViewDep
+}
+
+// ViewDep is a table or a view read by a view, with the names of its columns when the view is defined.
+type ViewDep struct {
+	Name    string
+	Columns []string
+}
+
+// Sequence produces the integers Start, Start+Increment, ... in [MinValue, MaxValue]. A cycling sequence starts
+// over from MinValue, or from MaxValue if Increment is negative, after the values run out.
+type Sequence struct {
+	ID        int
+	Name      string
+	Start     int64
+	Increment int64
+	MinValue  int64
+	MaxValue  int64
+	Cycle     bool
+	// Cache is the number of the values allocated in advance, or 0 if the sequence is not cached.
+	Cache int64
+	// Next is the value returned by the next NEXTVAL if NextKnown is true. It becomes unknown once NEXTVAL
+	// is evaluated for an unknown number of rows, and is known again after the sequence is restarted.
+	Next      int64
+	NextKnown bool
 }
 
 type Prepare struct {
@@ -155,46 +271,50 @@ func (s *State) RemoveWeight(fn Fn) {
 	}
 }
 
-func (s *State) PickRandomCTEOrTableName() string {
-	names := make([]string, 0, 10)
-	for _, cteL := range s.ctes {
-		for _, cte := range cteL {
-			names = append(names, cte.Name)
-		}
-	}
-
-	for _, tbl := range s.Tables {
-		names = append(names, tbl.Name)
-	}
-
-	return names[rand.Intn(len(names))]
-}
-
-func (s *State) GetRandomCTE() *Table {
-	ctes := make([]*Table, 0, 10)
-	for _, cteL := range s.ctes {
-		for _, cte := range cteL {
-			ctes = append(ctes, cte)
-		}
-	}
-
-	return ctes[rand.Intn(len(ctes))]
-}
-
-func (s *State) GetCTECount() int {
-	c := 0
-	for _, cteL := range s.ctes {
-		c += len(cteL)
-	}
-
-	return c
-}
-
 // QueryState represent an intermediate state during a query generation.
 type QueryState struct {
 	SelectedCols map[*Table]QueryStateColumns
 	IsWindow     bool
 	FieldNumHint int
+	// FieldTypes are the types of the fields, e.g. in the branches of a set operation.
+	FieldTypes []ColumnType
+	// IsAggregated means the fields are aggregate functions or expressions over the grouped columns.
+	IsAggregated bool
+	IsDistinct   bool
+	WithRollup   bool
+	// GroupedFields are the positions of the fields which only reference the grouped columns.
+	GroupedFields []int
+	// windows are the named windows in the WINDOW clause.
+	windows []*windowDef
+}
+
+// HasGroupBy reports whether any column is grouped.
+func (q QueryState) HasGroupBy() bool {
+	return q.GroupedView() != nil
+}
+
+// GroupedView returns a query state which only contains the grouped columns, or nil if there is none.
+func (q QueryState) GroupedView() *QueryState {
+	var view *QueryState
+	for t, cols := range q.SelectedCols {
+		var grouped Columns
+		for i, attr := range cols.Attr {
+			if attr == QueryGroupBy {
+				grouped = append(grouped, cols.Columns[i])
+			}
+		}
+		if len(grouped) == 0 {
+			continue
+		}
+		if view == nil {
+			view = &QueryState{SelectedCols: map[*Table]QueryStateColumns{}}
+		}
+		view.SelectedCols[t] = QueryStateColumns{
+			Columns: grouped,
+			Attr:    make([]string, len(grouped)),
+		}
+	}
+	return view
 }
 
 type QueryStateColumns struct {
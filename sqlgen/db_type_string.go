@@ -1,13 +1,22 @@
 package sqlgen
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 func (t *Table) String() string {
+	if t.View != nil {
+		return fmt.Sprintf("create view %s %s as %s", t.Name, PrintColumnNamesWithPar(t.Columns, ""), t.View.Query)
+	}
 	var sb strings.Builder
-	sb.WriteString("create table ")
+	sb.WriteString("create ")
+	if t.Temporary != TempTableNone {
+		sb.WriteString(t.Temporary.String())
+		sb.WriteString(" ")
+	}
+	sb.WriteString("table ")
 	sb.WriteString(t.Name)
 	sb.WriteString(" (")
 	for i, c := range t.Columns {
@@ -25,7 +34,22 @@ func (t *Table) String() string {
 			sb.WriteString(idx.String())
 		}
 	}
+	for _, fk := range t.ForeignKeys {
+		sb.WriteString(", ")
+		sb.WriteString(fk.String())
+	}
+	for _, chk := range t.Checks {
+		sb.WriteString(", ")
+		sb.WriteString(chk.String())
+	}
 	sb.WriteString(")")
+	if t.Partition != nil {
+		sb.WriteString(" ")
+		sb.WriteString(t.Partition.String())
+	}
+	if t.Temporary == TempTableGlobal {
+		sb.WriteString(" on commit delete rows")
+	}
 	return sb.String()
 }
 
@@ -47,6 +71,67 @@ func (c *Column) String() string {
 		sb.WriteString(strconv.Itoa(c.Arg2))
 		sb.WriteString(")")
 	}
+	if c.Generated != nil {
+		sb.WriteString(" ")
+		sb.WriteString(c.Generated.String())
+	}
+	if c.DefaultSeq != nil {
+		sb.WriteString(" default nextval(")
+		sb.WriteString(c.DefaultSeq.Name)
+		sb.WriteString(")")
+	}
+	if c.IsAutoIncrement {
+		sb.WriteString(" auto_increment")
+	}
+	if c.AutoRandomBits > 0 {
+		sb.WriteString(" auto_random(")
+		sb.WriteString(strconv.Itoa(c.AutoRandomBits))
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// String prints the generated column clause, e.g. generated always as (lower(a)) virtual.
+func (g *Generated) String() string {
+	kind := "virtual"
+	if g.Stored {
+		kind = "stored"
+	}
+	return "generated always as (" + g.Print("") + ") " + kind
+}
+
+// String prints the foreign key definition, e.g. constraint fk_1 foreign key (a) references t (b) on delete cascade.
+func (fk *ForeignKey) String() string {
+	return fmt.Sprintf("constraint %s foreign key %s references %s %s on delete %s on update %s",
+		fk.Name, PrintColumnNamesWithPar(fk.Columns, ""), fk.RefTable.Name, PrintColumnNamesWithPar(fk.RefColumns, ""),
+		fk.OnDelete, fk.OnUpdate)
+}
+
+// String prints the CHECK constraint definition, e.g. constraint chk_1 check (a is not null).
+func (c *Check) String() string {
+	return fmt.Sprintf("constraint %s check (%s)", c.Name, fmt.Sprintf(c.Expr, c.Column.Name))
+}
+
+// String prints the partition clause, e.g. partition by range (a) (partition p0 values less than (1)).
+func (p *Partition) String() string {
+	var sb strings.Builder
+	sb.WriteString("partition by ")
+	sb.WriteString(p.Tp.String())
+	sb.WriteString(" (")
+	if p.Func != "" {
+		sb.WriteString(p.Func + "(" + p.Columns[0].Name + ")")
+	} else {
+		sb.WriteString(PrintColumnNamesWithoutPar(p.Columns, ""))
+	}
+	sb.WriteString(")")
+	if p.Tp.IsHash() {
+		sb.WriteString(" partitions ")
+		sb.WriteString(strconv.Itoa(len(p.Defs)))
+		return sb.String()
+	}
+	sb.WriteString(" (")
+	sb.WriteString(PrintPartitionDefs(p.Tp, p.Defs))
+	sb.WriteString(")")
 	return sb.String()
 }
 
@@ -55,11 +140,35 @@ func (i *Index) String() string {
 	sb.WriteString(i.Tp.String())
 	sb.WriteString(" ")
 	sb.WriteString(i.Name)
-	for i, c := range i.Columns {
-		if i != 0 {
+	for j := range i.Columns {
+		if j != 0 {
 			sb.WriteString(",")
 		}
-		sb.WriteString(c.Name)
+		sb.WriteString(i.KeyPart(j, ""))
 	}
 	return sb.String()
 }
+
+// KeyPart prints the j-th key part of the index, whose column is qualified by tblName if it is not empty.
+func (i *Index) KeyPart(j int, tblName string) string {
+	name := i.Columns[j].Name
+	if tblName != "" {
+		name = tblName + "." + name
+	}
+	if i.Funcs[j] == "" {
+		return name
+	}
+	return i.Funcs[j] + "(" + name + ")"
+}
+
+// Print prints the expression of the generated column, whose columns are qualified by tblName if it is not empty.
+func (g *Generated) Print(tblName string) string {
+	names := make([]interface{}, len(g.Deps))
+	for i, dep := range g.Deps {
+		names[i] = dep.Name
+		if tblName != "" {
+			names[i] = tblName + "." + dep.Name
+		}
+	}
+	return fmt.Sprintf(g.Expr, names...)
+}
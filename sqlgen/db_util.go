@@ -22,7 +22,7 @@ func Assert(cond bool, targets ...interface{}) {
 }
 
 type Entity interface {
-	*Table | *Column | *Index | *TableColumns
+	*Table | *Column | *Index | *TableColumns | *Sequence
 }
 
 func gRand1[T Entity](is []T) T {
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
+	"github.com/pingcap/tidb/parser/mysql"
 	"github.com/stretchr/testify/require"
 )
 
@@ -59,28 +60,34 @@ func TestExampleInitialize(t *testing.T) {
 	}
 }
 
-//func TestExampleCTE(t *testing.T) {
-//	state := sqlgen.NewState()
-//	state.SetWeight(sqlgen.IndexDefinitions, 0)
-//	state.SetWeight(sqlgen.PartitionDefinition, 0)
-//	state.SetRepeat(sqlgen.ColumnDefinition, 5, 5)
-//	rowCount := 10
-//	tblCount := 2
-//	for i := 0; i < tblCount; i++ {
-//		sql := sqlgen.CreateTable.Eval(state)
-//		fmt.Println(sql)
-//	}
-//
-//	generateInsertInto(state, rowCount)
-//
-//	for i := 0; i < 100; i++ {
-//		fmt.Println(sqlgen.CTEQueryStatement.Eval(state))
-//	}
-//
-//	for i := 0; i < 100; i++ {
-//		fmt.Println(sqlgen.CTEDMLStatement.Eval(state), ";")
-//	}
-//}
+func TestExampleCTE(t *testing.T) {
+	state := sqlgen.NewState()
+	state.SetWeight(sqlgen.IndexDefinitions, 0)
+	state.SetWeight(sqlgen.PartitionDefinition, 0)
+	state.SetRepeat(sqlgen.ColumnDefinition, 5, 5)
+	rowCount := 10
+	tblCount := 2
+	for i := 0; i < tblCount; i++ {
+		sql, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		fmt.Println(sql)
+	}
+
+	generateInsertInto(state, rowCount)
+
+	for i := 0; i < 100; i++ {
+		sql, err := sqlgen.CTEQueryStatement.Eval(state)
+		require.NoError(t, err)
+		fmt.Println(sql)
+		require.True(t, strings.HasPrefix(sql, "with"))
+	}
+
+	for i := 0; i < 100; i++ {
+		sql, err := sqlgen.CTEDMLStatement.Eval(state)
+		require.NoError(t, err)
+		fmt.Println(sql, ";")
+	}
+}
 
 func TestExampleCreateTableWithoutIndexOrPartitions(t *testing.T) {
 	state := sqlgen.NewState()
@@ -135,7 +142,11 @@ func TestExampleColumnTypeChangeWithGivenTypes(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		query, err := sqlgen.CreateTable.Eval(state)
 		require.NoError(t, err)
-		require.Equal(t, 5, strings.Count(query, "int"), query)
+		defs, n := parseColumnDefs(t, query, state.Tables[len(state.Tables)-1])
+		require.Equal(t, 5, n, query)
+		for _, def := range defs {
+			require.Equal(t, mysql.TypeLong, def.Tp.GetType(), query)
+		}
 	}
 	for i := 0; i < 20; i++ {
 		state.Env().Table = state.Tables.Rand()
@@ -145,13 +156,19 @@ func TestExampleColumnTypeChangeWithGivenTypes(t *testing.T) {
 	}
 	for i := 0; i < 20; i++ {
 		randTable := state.Tables.Rand()
-		state.Env().Table = state.Tables.Rand()
+		state.Env().Table = randTable
 		query, err := sqlgen.AlterColumn.Eval(state)
 		require.NoError(t, err)
 		if len(query) == 0 {
-			pk := randTable.Indexes.Primary()
-			if pk != nil {
-				require.Len(t, randTable.Columns.Diff(pk.Columns), 0)
+			// Only the columns in the primary key, the partitioning, the expressions or the constraints, and the
+			// generated or auto columns are left.
+			cols := randTable.Columns.Diff(randTable.PartitionColumns()).Diff(randTable.ExprDepColumns()).
+				Diff(state.ConstraintColumns(randTable))
+			if pk := randTable.Indexes.Primary(); pk != nil {
+				cols = cols.Diff(pk.Columns)
+			}
+			for _, c := range cols {
+				require.True(t, c.Generated != nil || c.IsAutoAllocated(), c.Name)
 			}
 		} else if strings.Contains(query, "modify") || strings.Contains(query, "change") {
 			require.Contains(t, query, "tinyint", query)
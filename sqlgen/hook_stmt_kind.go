@@ -0,0 +1,37 @@
+package sqlgen
+
+var _ FnEvaluateHook = (*FnHookStmtKind)(nil)
+
+const HookNameStmtKind = "stmt_kind"
+
+// FnHookStmtKind records which branch of the root Fn produced the last statement,
+// e.g. Query or DMLStmt if the root Fn is Start.
+type FnHookStmtKind struct {
+	FnHookDefault
+	depth int
+	kind  string
+}
+
+func (h *FnHookStmtKind) BeforeEvaluate(state *State, fn Fn) Fn {
+	// The root Fn returns an Or(), whose chosen branch is at depth 2.
+	// A failed branch is overwritten by the next one.
+	if h.depth == 2 {
+		h.kind = fn.Info
+	}
+	h.depth++
+	return fn
+}
+
+func (h *FnHookStmtKind) AfterEvaluate(state *State, fn Fn, result string) string {
+	h.depth--
+	return result
+}
+
+// Kind returns the Fn name of the last generated statement.
+func (h *FnHookStmtKind) Kind() string {
+	return h.kind
+}
+
+func NewFnHookStmtKind() *FnHookStmtKind {
+	return &FnHookStmtKind{FnHookDefault: NewFnHookDefault(HookNameStmtKind)}
+}
@@ -2,6 +2,7 @@ package sqlgen_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
@@ -43,3 +44,20 @@ func TestHookReplacer(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, result, query)
 }
+
+func TestHookStmtKind(t *testing.T) {
+	state := sqlgen.NewState()
+	kindHook := sqlgen.NewFnHookStmtKind()
+	state.Hook().Append(kindHook)
+	kinds := map[string]int{}
+	for i := 0; i < 100; i++ {
+		query, err := sqlgen.Start.Eval(state)
+		require.NoError(t, err)
+		kinds[kindHook.Kind()]++
+		if strings.HasPrefix(query, "create table") && !strings.Contains(query, " like ") {
+			require.Equal(t, sqlgen.CreateTable.Info, kindHook.Kind(), query)
+		}
+	}
+	require.Greater(t, kinds[sqlgen.CreateTable.Info], 0)
+	require.Greater(t, kinds[sqlgen.Query.Info], 0)
+}
@@ -1,7 +1,12 @@
 package sqlgen
 
+import "strings"
+
 var _ FnEvaluateHook = (*FnHookTxnWrap)(nil)
 
+// FnHookTxnWrap wraps the statements generated by Start in explicit transactions, e.g.
+// begin pessimistic ; insert ... ; update ... ; commit. The State is told when a transaction
+// starts and ends, so that the rows of the global temporary tables are deleted on commit and rollback.
 type FnHookTxnWrap struct {
 	FnHookDefault
 	maxTxnStmtCount int
@@ -13,7 +18,7 @@ type FnHookTxnWrap struct {
 const txnStartWrapName = "txnWrappedStart"
 
 func (s *FnHookTxnWrap) BeforeEvaluate(state *State, fn Fn) Fn {
-	if fn.Info == Start.Info {
+	if fn.Info != Start.Info {
 		return fn
 	}
 	return Fn{
@@ -27,7 +32,7 @@ func (s *FnHookTxnWrap) BeforeEvaluate(state *State, fn Fn) Fn {
 			if err != nil {
 				return "", err
 			}
-			return startTxnRs + " ; " + currRs, nil
+			return joinTxnStmts(startTxnRs, currRs), nil
 		},
 	}
 }
@@ -51,9 +56,10 @@ func (s *FnHookTxnWrap) startTxn() (string, error) {
 		chosenFn = fns[randomSelectByFactor(fns, func(f Fn) int {
 			return f.Weight
 		})]
-		if chosenFn.Equal(Empty) {
+		if !chosenFn.Equal(Empty) {
 			s.inTxn = true
 			s.inflightStmts = 0
+			s.state.BeginTxn()
 		}
 	}
 	return chosenFn.Eval(s.state)
@@ -67,7 +73,7 @@ func (s *FnHookTxnWrap) AfterEvaluate(state *State, fn Fn, result string) string
 	if err != nil {
 		return ""
 	}
-	return result + " ; " + endTxnRs
+	return joinTxnStmts(result, endTxnRs)
 }
 
 func (s *FnHookTxnWrap) endTxn() (string, error) {
@@ -82,6 +88,7 @@ func (s *FnHookTxnWrap) endTxn() (string, error) {
 	if !s.inTxn {
 		fnIdx = 0
 	} else {
+		s.inflightStmts++
 		inTxnW := s.maxTxnStmtCount - s.inflightStmts
 		if inTxnW < 0 {
 			inTxnW = 0
@@ -95,14 +102,24 @@ func (s *FnHookTxnWrap) endTxn() (string, error) {
 		})
 	}
 	chosenFn := fns[fnIdx]
-	if chosenFn.Equal(Empty) {
+	if !chosenFn.Equal(Empty) {
 		s.inTxn = false
-	} else if s.inTxn {
-		s.inflightStmts++
+		s.state.EndTxn()
 	}
 	return chosenFn.Eval(s.state)
 }
 
+// joinTxnStmts joins the non-empty statements by semicolons.
+func joinTxnStmts(stmts ...string) string {
+	nonEmpty := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		if stmt != "" {
+			nonEmpty = append(nonEmpty, stmt)
+		}
+	}
+	return strings.Join(nonEmpty, " ; ")
+}
+
 func NewFnHookTxnWrap(state *State, maxTxnStmtCount int) *FnHookTxnWrap {
 	return &FnHookTxnWrap{
 		FnHookDefault:   NewFnHookDefault("txn_wrap"),
@@ -9,15 +9,17 @@ import (
 var Start = NewFn(func(state *State) Fn {
 	return Or(
 		SetSystemVars.W(2),
-		AdminCheck.W(1).P(HasTables),
+		AdminCheck.W(1).P(HasPersistentTables),
 		CreateTable.W(13).P(NoTooMuchTables),
 		CreateTableLike.W(6).P(HasTables, NoTooMuchTables),
 		Query.W(20).P(HasTables),
+		CTEQueryStatement.W(3).P(HasTables),
+		CTEDMLStatement.W(2).P(HasTables),
 		// QueryPrepare.W(2).P(HasTables),
 		DMLStmt.W(20).P(HasTables),
-		AlterTable.W(5).P(HasTables),
-		SplitRegion.W(1).P(HasTables),
-		AnalyzeTable.W(0).P(HasTables),
+		AlterTable.W(5).P(HasPersistentTables),
+		SplitRegion.W(1).P(HasPersistentTables),
+		AnalyzeTable.W(0).P(HasPersistentTables),
 		// PrepareStmt.W(2).P(HasTables),
 		// DeallocPrepareStmt.W(1).P(HasTables),
 		FlashBackTable.W(1).P(HasDroppedTables),
@@ -25,7 +27,14 @@ var Start = NewFn(func(state *State) Fn {
 		// LoadTable.W(1).P(HasTables),
 		DropTable.W(1).P(HasTables),
 		TruncateTable.W(1).P(HasTables),
-		SetTiFlashReplica.W(0).P(HasTables),
+		CreateView.W(2).P(HasPersistentTables),
+		AlterView.W(1).P(HasPersistentTables, HasViews),
+		DropView.W(1).P(HasViews),
+		SetTiFlashReplica.W(0).P(HasPersistentTables),
+		CreateSequence.W(1),
+		AlterSequence.W(1).P(HasSequences),
+		DropSequence.W(1).P(HasSequences),
+		SequenceQuery.W(2).P(HasSequences),
 	)
 })
 
@@ -35,19 +44,29 @@ var DMLStmt = NewFn(func(state *State) Fn {
 		CommonDelete.W(1),
 		CommonInsertOrReplace.W(3),
 		CommonUpdate.W(1),
-		NonTransactionalDelete.W(0).P(HasShardableColumn),
+		CommonMultiUpdate.W(1),
+		CommonMultiDelete.W(1),
+		NonTransactionalDelete.W(0).P(HasShardableColumn, IsNotTemporary),
+		ViolateConstraint.W(1).P(HasConstraints),
+		DeleteReferencedRows.W(1).P(HasReferencedRows),
+		UpdateReferencedRows.W(1).P(HasReferencedRows),
+		InsertNextVal.W(1).P(HasNextValColumns),
+		UpdateNextVal.W(1).P(HasNextValColumns),
 	)
 })
 
+// AlterTable changes a persistent table. Few changes are supported on the temporary tables.
 var AlterTable = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.PersistentTables().Rand()
 	state.env.Table = tbl
 	return And(Str("alter table"), Str(tbl.Name),
 		Or(
 			AlterTableChangeSingle,
 			AlterTableChangeMulti.W(0),
+			AlterPartition.W(1),
+			AlterConstraint.W(1),
 		))
-})
+}).P(HasPersistentTables)
 
 var AlterTableChangeMulti = NewFn(func(state *State) Fn {
 	state.Env().MultiObjs = NewMultiObjs()
@@ -71,6 +90,7 @@ var SetSystemVars = NewFn(func(state *State) Fn {
 	return Or(
 		SwitchRowFormatVer,
 		SwitchClustered,
+		SwitchCheckConstraint,
 	)
 })
 
@@ -82,14 +102,39 @@ var SwitchClustered = NewFn(func(state *State) Fn {
 	return Strs("set @@global.tidb_enable_clustered_index =", RandomNum(0, 1))
 })
 
+// SwitchCheckConstraint turns the CHECK constraints on or off. The variable is global, so the switch is shared
+// with the other sessions of the server, and every session is assumed to run the generated statements.
+var SwitchCheckConstraint = NewFn(func(state *State) Fn {
+	state.checkDisabled = RandomBool()
+	if state.checkDisabled {
+		return Str("set @@global.tidb_enable_check_constraint = 0")
+	}
+	return Str("set @@global.tidb_enable_check_constraint = 1")
+})
+
+// DropTable drops a table. The tables referenced by foreign keys cannot be dropped.
 var DropTable = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.Tables.Filter(func(t *Table) bool {
+		return !state.IsReferenced(t)
+	}).Rand()
+	if tbl == nil {
+		return None("all tables are referenced")
+	}
 	state.RemoveTable(tbl)
+	if tbl.Temporary == TempTableLocal {
+		return And(Str("drop"), Opt(Str("temporary")), Strs("table", tbl.Name))
+	}
 	return Strs("drop table", tbl.Name)
 })
 
+// TruncateTable truncates a table. The tables referenced by foreign keys cannot be truncated.
 var TruncateTable = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.Tables.Filter(func(t *Table) bool {
+		return !state.IsReferenced(t)
+	}).Rand()
+	if tbl == nil {
+		return None("all tables are referenced")
+	}
 	state.TruncateTable(tbl)
 	return Strs("truncate table", tbl.Name)
 })
@@ -98,17 +143,18 @@ var CreateTable = NewFn(func(state *State) Fn {
 	tbl := state.GenNewTable()
 	state.Tables = state.Tables.Append(tbl)
 	state.env.Table = tbl
-	// The eval order matters because the dependency is ColumnDefinitions <- PartitionDefinition <- IndexDefinitions.
-	eColDefs, err := ColumnDefinitions.Eval(state)
+	// The eval order matters because the dependency is TemporaryTableOpt <- ColumnDefinitions <-
+	// PartitionDefinition <- IndexDefinitions <- ConstraintDefinitions <- TableOptions.
+	eTemporary, err := TemporaryTableOpt.Eval(state)
 	if err != nil {
 		return NoneBecauseOf(err)
 	}
-	state.env.PartColumn = tbl.Columns.Filter(func(c *Column) bool { return c.Tp.IsPartitionType() }).Rand()
-	ePartitionDef, err := PartitionDefinition.Eval(state)
+	eColDefs, err := ColumnDefinitions.Eval(state)
 	if err != nil {
 		return NoneBecauseOf(err)
 	}
-	eTableOption, err := TableOptions.Eval(state)
+	state.env.PartColumns = partitionableColumns(tbl)
+	ePartitionDef, err := PartitionDefinition.Eval(state)
 	if err != nil {
 		return NoneBecauseOf(err)
 	}
@@ -116,26 +162,121 @@ var CreateTable = NewFn(func(state *State) Fn {
 	if err != nil && !strings.Contains(err.Error(), "<nil>") {
 		return NoneBecauseOf(err)
 	}
+	if col := tbl.AutoColumn(); col != nil && !col.LeadsIndex(tbl) {
+		// The AUTO_INCREMENT column must be the first column of a key.
+		idx := &Index{ID: state.alloc.AllocIndexID(), Tp: IndexTypeNonUnique}
+		idx.Name = fmt.Sprintf("idx_%d", idx.ID)
+		idx.AppendColumn(col, 0)
+		tbl.AppendIndex(idx)
+		eIdxDefs = joinDefinitions(eIdxDefs, fmt.Sprintf("key %s (%s)", idx.Name, col.Name))
+	}
+	eConstraintDefs, err := ConstraintDefinitions.Eval(state)
+	if err != nil && !strings.Contains(err.Error(), "<nil>") {
+		return NoneBecauseOf(err)
+	}
+	eIdxDefs = joinDefinitions(eIdxDefs, eConstraintDefs)
+	eTableOption, err := TableOptions.Eval(state)
+	if err != nil {
+		return NoneBecauseOf(err)
+	}
+	eCreate, eOnCommit := "create table", ""
+	if eTemporary != "" {
+		eCreate = "create " + eTemporary + " table"
+	}
+	if tbl.Temporary == TempTableGlobal {
+		eOnCommit = "on commit delete rows"
+	}
 	if len(strings.Trim(eIdxDefs, " ")) != 0 {
-		return Strs("create table", tbl.Name, "(", eColDefs, ",", eIdxDefs, ")",
-			eTableOption, ePartitionDef)
+		return Strs(eCreate, tbl.Name, "(", eColDefs, ",", eIdxDefs, ")",
+			eTableOption, ePartitionDef, eOnCommit)
 	}
-	return Strs("create table", tbl.Name, "(", eColDefs, ")",
-		eTableOption, ePartitionDef)
+	return Strs(eCreate, tbl.Name, "(", eColDefs, ")",
+		eTableOption, ePartitionDef, eOnCommit)
+})
+
+// TemporaryTableOpt makes env.Table a local or a global temporary table in CREATE TABLE. The temporary tables
+// cannot be partitioned or referenced by foreign keys, and do not support AUTO_RANDOM and SHARD_ROW_ID_BITS.
+var TemporaryTableOpt = NewFn(func(state *State) Fn {
+	return Or(
+		Empty.W(8),
+		LocalTemporaryTable,
+		GlobalTemporaryTable,
+	)
+})
+
+// LocalTemporaryTable is only visible in the current session, e.g. create temporary table tbl_1 (...).
+var LocalTemporaryTable = NewFn(func(state *State) Fn {
+	state.env.Table.Temporary = TempTableLocal
+	return Str(TempTableLocal.String())
+})
+
+// GlobalTemporaryTable keeps its rows until the transaction ends,
+// e.g. create global temporary table tbl_1 (...) on commit delete rows.
+var GlobalTemporaryTable = NewFn(func(state *State) Fn {
+	state.env.Table.Temporary = TempTableGlobal
+	return Str(TempTableGlobal.String())
 })
 
+// joinDefinitions joins the non-empty definitions in CREATE TABLE by commas.
+func joinDefinitions(defs ...string) string {
+	nonEmpty := make([]string, 0, len(defs))
+	for _, def := range defs {
+		if len(strings.Trim(def, " ")) != 0 {
+			nonEmpty = append(nonEmpty, def)
+		}
+	}
+	return strings.Join(nonEmpty, " ,")
+}
+
 var TableOptions = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
-	return Strs("charset", tbl.Collate.CharsetName, "collate", tbl.Collate.CollationName)
+	autoCol := tbl.AutoColumn()
+	isAutoRandom := autoCol != nil && autoCol.AutoRandomBits > 0
+	isTemporary := tbl.Temporary != TempTableNone
+	return And(
+		Strs("charset", tbl.Collate.CharsetName, "collate", tbl.Collate.CollationName),
+		If(!isAutoRandom, Opt(TableOptionAutoIncrement)),
+		If(!isAutoRandom && !isTemporary, Opt(TableOptionAutoIDCache)),
+		If(isAutoRandom, Opt(TableOptionAutoRandomBase)),
+		// The row IDs cannot be sharded if the rows are clustered by the primary key.
+		If(!tbl.Clustered && !isTemporary, Opt(TableOptionShardRowIDBits)),
+	)
+})
+
+var TableOptionAutoIncrement = NewFn(func(state *State) Fn {
+	return Strs("auto_increment =", RandomNum(1, 100000))
+})
+
+var TableOptionAutoIDCache = NewFn(func(state *State) Fn {
+	return Strs("/*T![auto_id_cache] auto_id_cache =", []string{"1", "100", "30000"}[rand.Intn(3)], "*/")
+})
+
+var TableOptionAutoRandomBase = NewFn(func(state *State) Fn {
+	return Strs("/*T![auto_rand_base] auto_random_base =", RandomNum(1, 100000), "*/")
+})
+
+// TableOptionShardRowIDBits scatters the implicit row IDs, and optionally splits the regions in advance.
+var TableOptionShardRowIDBits = NewFn(func(state *State) Fn {
+	bits := 1 + rand.Intn(4)
+	opts := []string{"/*T! shard_row_id_bits =", Num(bits)}
+	if RandomBool() {
+		opts = append(opts, "pre_split_regions =", Num(1+rand.Intn(bits)))
+	}
+	return Strs(append(opts, "*/")...)
 })
 
 var InsertInto = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
-	vals := tbl.GenRandValues(tbl.Columns)
-	tbl.AppendRow(vals)
+	cols := tbl.WritableColumns()
+	vals := tbl.GenRandValues(cols)
+	if state.KeepsRows(tbl) {
+		tbl.AppendRow(tbl.RowOfWritableValues(vals))
+	}
 	return And(
 		Str("insert into"),
 		Str(tbl.Name),
+		// The generated columns cannot be written, so the columns are listed explicitly.
+		If(len(cols) < len(tbl.Columns), Str(PrintColumnNamesWithPar(cols, ""))),
 		Str("values"),
 		Str("("),
 		Str(PrintRandValues(vals)),
@@ -146,19 +287,30 @@ var InsertInto = NewFn(func(state *State) Fn {
 var CommonInsertOrReplace = NewFn(func(state *State) Fn {
 	tbl := state.Tables.Rand()
 	state.env.Table = tbl
+	writable := tbl.WritableColumns()
 	if RandomBool() {
-		cWithDef, cWithoutDef := tbl.Columns.Span(func(c *Column) bool {
-			return c.DefaultVal != ""
+		// The columns with default values or allocated values can be omitted.
+		cWithDef, cWithoutDef := writable.Span(func(c *Column) bool {
+			return c.DefaultVal != "" || c.DefaultSeq != nil || c.IsAutoAllocated()
 		})
 		state.env.Columns = cWithoutDef.Concat(cWithDef.RandN())
+		// The omitted columns take the values of their sequences for an unknown number of rows.
+		for _, c := range writable {
+			if c.DefaultSeq != nil && !state.env.Columns.Contain(c) {
+				c.DefaultSeq.SkipValues()
+			}
+		}
+	} else if len(writable) < len(tbl.Columns) {
+		// The generated columns cannot be written, so the columns are listed explicitly.
+		state.env.Columns = writable
 	}
-	// TODO: insert into t partition(p1) values(xxx)
-	// TODO: insert ... select... , it's hard to make the selected columns match the inserted columns.
 	return Or(
 		CommonInsertValues,
 		CommonInsertSet,
 		CommonReplaceValues,
 		CommonReplaceSet,
+		CommonInsertSelect,
+		CommonReplaceSelect,
 	)
 })
 
@@ -169,9 +321,9 @@ var CommonInsertSet = NewFn(func(state *State) Fn {
 		cols = tbl.Columns
 	}
 	return And(
-		Str("insert"), Opt(Str("ignore")), Str("into"), Str(tbl.Name),
+		Str("insert"), Opt(Str("ignore")), Str("into"), Str(tbl.Name), PartitionSelectionOpt,
 		Str("set"),
-		Str(PrintRandomAssignments(cols)),
+		Str(PrintAssignments(cols, tbl.GenRandValues(cols))),
 		Opt(OnDuplicateUpdate),
 	)
 })
@@ -180,7 +332,7 @@ var CommonInsertValues = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
 	cols := state.env.Columns
 	return And(
-		Str("insert"), Opt(Str("ignore")), Str("into"), Str(tbl.Name),
+		Str("insert"), Opt(Str("ignore")), Str("into"), Str(tbl.Name), PartitionSelectionOpt,
 		Str(PrintColumnNamesWithPar(cols, "")),
 		Str("values"),
 		MultipleRowVals,
@@ -199,7 +351,7 @@ var CommonReplaceValues = NewFn(func(state *State) Fn {
 		sb.WriteString(c.String())
 	}
 	return And(
-		Str("replace into"), Str(tbl.Name),
+		Str("replace into"), Str(tbl.Name), PartitionSelectionOpt,
 		Str(PrintColumnNamesWithPar(cols, "")),
 		Str("values"),
 		MultipleRowVals,
@@ -213,12 +365,145 @@ var CommonReplaceSet = NewFn(func(state *State) Fn {
 		cols = tbl.Columns
 	}
 	return And(
-		Str("replace into"), Str(tbl.Name),
+		Str("replace into"), Str(tbl.Name), PartitionSelectionOpt,
 		Str("set"),
-		Str(PrintRandomAssignments(cols)),
+		Str(PrintAssignments(cols, tbl.GenRandValues(cols))),
 	)
 })
 
+// CommonInsertSelect inserts the rows of a table. Each inserted column is fed by a selected
+// column of the same type, or by a constant if the selected table has no such column.
+var CommonInsertSelect = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	cols := withSequenceColumns(tbl, state.env.Columns.Or(tbl.WritableColumns()))
+	src := state.Tables.Rand()
+	fields, rows := insertSelectFields(tbl, cols, src)
+	if rows != nil && state.KeepsRows(tbl) && RandomBool() {
+		// All the selected rows are inserted, so the rows of the table are still known.
+		for _, row := range rows {
+			tbl.AppendRow(row)
+		}
+		return Strs("insert into", tbl.Name, PrintColumnNamesWithPar(cols, ""), "select", fields, "from", src.Name)
+	}
+	return And(
+		Str("insert"), Opt(Str("ignore")), Str("into"), Str(tbl.Name), PartitionSelectionOpt,
+		Str(PrintColumnNamesWithPar(cols, "")),
+		insertSelectQuery(fields, src),
+		// The columns in ON DUPLICATE KEY UPDATE are ambiguous if the table is inserted from itself.
+		If(src.ID != tbl.ID, Opt(OnDuplicateUpdateValues)),
+	)
+})
+
+// CommonReplaceSelect replaces the rows of a table by the selected rows. The replaced rows are unknown,
+// so the rows are not tracked.
+var CommonReplaceSelect = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	cols := withSequenceColumns(tbl, state.env.Columns.Or(tbl.WritableColumns()))
+	src := state.Tables.Rand()
+	fields, _ := insertSelectFields(tbl, cols, src)
+	return And(
+		Str("replace into"), Str(tbl.Name), PartitionSelectionOpt,
+		Str(PrintColumnNamesWithPar(cols, "")),
+		insertSelectQuery(fields, src),
+	)
+})
+
+// withSequenceColumns appends the columns of tbl whose default values are taken from the sequences to cols.
+// They are never omitted when the rows are selected, so that the sequences are not evaluated in an unknown order.
+func withSequenceColumns(tbl *Table, cols Columns) Columns {
+	for _, c := range tbl.Columns {
+		if c.DefaultSeq != nil && !cols.Contain(c) {
+			cols = append(cols.Copy(), c)
+		}
+	}
+	return cols
+}
+
+// insertSelectFields returns the fields which select the values of the columns cols of tbl from src,
+// and the rows of tbl inserted from all the rows of src. The rows are nil if they are not known exactly,
+// e.g. the values are allocated or generated by the server, or some rows may be rejected by the keys,
+// the constraints or the column types.
+func insertSelectFields(tbl *Table, cols Columns, src *Table) (string, [][]string) {
+	fields := make([]string, len(cols))
+	srcIdx := make([]int, len(cols))
+	known := insertedRowsKnown(tbl)
+	for i, c := range cols {
+		_, srcCol := RandomCompatibleColumnPair(Columns{c}, src.Columns)
+		if known {
+			// The columns of the same type are preferred, so that the inserted values are known.
+			exact := src.Columns.Filter(func(sc *Column) bool {
+				return sc.SameFullTypeAs(c) && (sc.IsNotNull || !c.IsNotNull)
+			})
+			if len(exact) > 0 {
+				srcCol = exact.Rand()
+			}
+		}
+		if c.AutoRandomBits > 0 {
+			fields[i], srcIdx[i] = c.RandomInsertValue(), -1
+			continue
+		}
+		if !srcCol.Tp.SameTypeAs(c.Tp) {
+			fields[i], srcIdx[i] = c.RandomValue(), -1
+			continue
+		}
+		fields[i] = fmt.Sprintf("%s.%s", src.Name, srcCol.Name)
+		srcIdx[i] = src.Columns.ByID(srcCol.ID)
+		known = known && srcCol.SameFullTypeAs(c)
+	}
+	if !known {
+		return strings.Join(fields, ", "), nil
+	}
+	rows := make([][]string, 0, len(src.Values))
+	for _, srcRow := range src.Values {
+		row := make([]string, len(tbl.Columns))
+		for j, c := range tbl.Columns {
+			row[j] = c.DefaultVal
+		}
+		for i, c := range cols {
+			v := fields[i]
+			if srcIdx[i] >= 0 {
+				v = srcRow[srcIdx[i]]
+			}
+			if c.IsNotNull && strings.EqualFold(v, "null") {
+				return strings.Join(fields, ", "), nil
+			}
+			row[tbl.Columns.ByID(c.ID)] = v
+		}
+		rows = append(rows, row)
+	}
+	return strings.Join(fields, ", "), rows
+}
+
+// insertedRowsKnown means every column of tbl takes the inserted value or its default value, and no inserted row
+// can be rejected by a unique key or a constraint.
+func insertedRowsKnown(tbl *Table) bool {
+	if len(tbl.ForeignKeys) > 0 || len(tbl.Checks) > 0 || tbl.Indexes.Found(func(idx *Index) bool {
+		return idx.Tp == IndexTypePrimary || idx.Tp == IndexTypeUnique
+	}) {
+		return false
+	}
+	return !tbl.Columns.Found(func(c *Column) bool {
+		return c.Generated != nil || c.IsAutoAllocated()
+	})
+}
+
+// insertSelectQuery returns the query which selects the fields from some rows of src.
+func insertSelectQuery(fields string, src *Table) Fn {
+	var orderBy []string
+	for _, c := range src.Columns {
+		orderBy = append(orderBy, fmt.Sprintf("%s.%s", src.Name, c.Name))
+	}
+	return NewFn(func(state *State) Fn {
+		state.env.Table = src
+		state.env.QState = nil
+		return And(
+			Strs("select", fields, "from", src.Name),
+			WhereClause,
+			Opt(Strs("order by", strings.Join(orderBy, ", "), "limit", RandomNum(1, 10))),
+		)
+	})
+}
+
 var MultipleRowVals = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
 	cols := state.env.Columns
@@ -231,25 +516,47 @@ var MultipleRowVals = NewFn(func(state *State) Fn {
 
 var AssignClause = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
-	col := tbl.Columns.Rand()
-	return Strs(fmt.Sprintf("%s.%s", tbl.Name, col.Name), "=", col.RandomValue())
+	col := tbl.UpdatableColumns().Rand()
+	colName := fmt.Sprintf("%s.%s", tbl.Name, col.Name)
+	return Or(
+		Strs(colName, "=", col.RandomValue()).W(3),
+		And(Strs(colName, "="), ExprOfType(col.Tp)),
+	)
 })
 
 var OnDuplicateUpdate = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
-	cols := tbl.Columns.RandNNotNil()
+	cols := tbl.UpdatableColumns().RandNNotNil()
 	return Strs(
 		"on duplicate key update",
 		PrintRandomAssignments(cols),
 	)
 })
 
+// OnDuplicateUpdateValues references the inserted values by VALUES() in ON DUPLICATE KEY UPDATE.
+var OnDuplicateUpdateValues = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	updatable := tbl.UpdatableColumns()
+	cols := updatable.RandNNotNil()
+	assigns := make([]string, len(cols))
+	for i, c := range cols {
+		colName := fmt.Sprintf("%s.%s", tbl.Name, c.Name)
+		_, other := RandomCompatibleColumnPair(Columns{c}, updatable)
+		if !other.Tp.SameTypeAs(c.Tp) {
+			other = c
+		}
+		assigns[i] = fmt.Sprintf("%s = values(%s.%s)", colName, tbl.Name, other.Name)
+	}
+	return Strs("on duplicate key update", strings.Join(assigns, ", "))
+})
+
 var CommonUpdate = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
-	state.env.Table = tbl
+	tbl := state.env.Table
+	NotNil(tbl)
 	return And(
 		Str("update"),
 		Str(tbl.Name),
+		PartitionSelectionOpt,
 		Str("set"),
 		Repeat(AssignClause.R(1, 3), Str(",")),
 		Str("where"),
@@ -258,8 +565,82 @@ var CommonUpdate = NewFn(func(state *State) Fn {
 	)
 })
 
+// CommonMultiUpdate updates two joined tables. The assignments to a table only reference the table
+// itself, so the updated rows do not depend on the order of the joined rows.
+var CommonMultiUpdate = NewFn(func(state *State) Fn {
+	tbls := multiTableDMLTargets(state)
+	targets := tbls
+	if tbls[1].AliasOf != nil {
+		// A table cannot be updated through both names in a self-join.
+		targets = tbls[:1]
+	}
+	var assignment = NewFn(func(state *State) Fn {
+		state.env.Table = targets[rand.Intn(len(targets))]
+		state.env.QState = nil
+		return AssignClause
+	})
+	return And(
+		Str("update"),
+		multiTableDMLReference(tbls),
+		Str("set"),
+		Repeat(assignment.R(1, 3), Str(",")),
+		Str("where"),
+		Predicates,
+	)
+}).P(HasTables)
+
+// CommonMultiDelete deletes the rows from one or both of two joined tables.
+var CommonMultiDelete = NewFn(func(state *State) Fn {
+	tbls := multiTableDMLTargets(state)
+	targets := tbls[:1]
+	if tbls[1].AliasOf == nil && RandomBool() {
+		targets = tbls
+	}
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.Name
+	}
+	return And(
+		Or(
+			Strs("delete", strings.Join(names, ", "), "from"),
+			Strs("delete from", strings.Join(names, ", "), "using"),
+		),
+		multiTableDMLReference(tbls),
+		Str("where"),
+		Predicates,
+	)
+}).P(HasTables)
+
+// multiTableDMLTargets picks two tables for a multi-table UPDATE or DELETE. The second table is an
+// alias if both are the same. The predicates over them are put into the env of the caller.
+func multiTableDMLTargets(state *State) []*Table {
+	t1, t2 := state.Tables.Rand(), state.Tables.Rand()
+	if t1.ID == t2.ID {
+		t2 = newTableAlias(state, t2)
+	}
+	state.env.Table = nil
+	state.env.QState = &QueryState{SelectedCols: map[*Table]QueryStateColumns{
+		t1: {Columns: t1.Columns, Attr: make([]string, len(t1.Columns))},
+		t2: {Columns: t2.Columns, Attr: make([]string, len(t2.Columns))},
+	}}
+	// The updated and deleted tables cannot be read in the subqueries.
+	disableSubQuery(state)
+	return []*Table{t1, t2}
+}
+
+func multiTableDMLReference(tbls []*Table) Fn {
+	left, right := tbls[:1], tbls[1:]
+	return And(
+		tableReference(tbls[0]),
+		Or(
+			And(JoinType, tableReference(tbls[1]), Str("on"), joinOnPredicate(left, right)).W(3),
+			And(Str(","), tableReference(tbls[1])),
+		),
+	)
+}
+
 var AnalyzeTable = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.PersistentTables().Rand()
 	return And(Str("analyze table"), Str(tbl.Name))
 })
 
@@ -320,8 +701,8 @@ var NonTransactionalDelete = NewFn(func(state *State) Fn {
 })
 
 var CommonDelete = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
-	state.env.Table = tbl
+	tbl := state.env.Table
+	NotNil(tbl)
 	col := tbl.Columns.Rand()
 	var randRowVal = NewFn(func(state *State) Fn {
 		return Str(col.RandomValue())
@@ -330,6 +711,7 @@ var CommonDelete = NewFn(func(state *State) Fn {
 		Str("delete"),
 		Str("from"),
 		Str(tbl.Name),
+		PartitionSelectionOpt,
 		Str("where"),
 		Or(
 			And(Predicates),
@@ -362,6 +744,21 @@ var DropIndex = NewFn(func(state *State) Fn {
 			return index.Tp != IndexTypePrimary
 		})
 	}
+	if autoCol := tbl.AutoColumn(); autoCol != nil {
+		// The AUTO_INCREMENT column must be the first column of a key.
+		autoKeys := tbl.Indexes.Filter(func(index *Index) bool {
+			return index.Columns[0].ID == autoCol.ID
+		})
+		if len(autoKeys) == 1 {
+			idxes = idxes.Filter(func(index *Index) bool {
+				return index.ID != autoKeys[0].ID
+			})
+		}
+	}
+	// The indexes needed by the foreign keys cannot be dropped.
+	idxes = idxes.Filter(func(index *Index) bool {
+		return !state.IsForeignKeyIndex(tbl, index)
+	})
 	if len(idxes) == 0 {
 		return None("no indexes can be dropped")
 	}
@@ -374,6 +771,17 @@ var DropIndex = NewFn(func(state *State) Fn {
 })
 
 var AddColumn = NewFn(func(state *State) Fn {
+	return Or(
+		AddBaseColumn.W(4),
+		AddGeneratedColumn,
+	)
+})
+
+var AddGeneratedColumn = NewFn(func(state *State) Fn {
+	return And(Str("add column"), GeneratedColumnDefinition)
+})
+
+var AddBaseColumn = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
 	newCol := &Column{ID: state.alloc.AllocColumnID()}
 	state.env.Column = newCol
@@ -405,6 +813,8 @@ var DropColumn = NewFn(func(state *State) Fn {
 		return len(index.Columns) > 1
 	})
 	pk := tbl.Indexes.Primary()
+	constraintCols := state.ConstraintColumns(tbl)
+	updatable := tbl.UpdatableColumns()
 	cols := tbl.Columns.Filter(func(c *Column) bool {
 		// Not support operate the same object in multi-schema change.
 		if state.env.MultiObjs.SameObject(c.Name) {
@@ -420,7 +830,24 @@ var DropColumn = NewFn(func(state *State) Fn {
 		if pk != nil && pk.HasColumn(c) {
 			return false
 		}
-		return true
+		// The partitioning columns cannot be dropped.
+		if tbl.PartitionColumns().Contain(c) {
+			return false
+		}
+		// The columns referenced by the generated columns or the expression indexes cannot be dropped.
+		if tbl.ExprDepColumns().Contain(c) {
+			return false
+		}
+		// Not support drop the AUTO_INCREMENT or AUTO_RANDOM column.
+		if c.IsAutoAllocated() {
+			return false
+		}
+		// Leave some columns to UPDATE, because the AUTO_RANDOM column cannot be updated.
+		if len(updatable) == 1 && updatable.Contain(c) {
+			return false
+		}
+		// The columns in the foreign keys or the CHECK constraints cannot be dropped.
+		return !constraintCols.Contain(c)
 	})
 	if len(cols) == 0 {
 		return None("no column can be dropped")
@@ -441,6 +868,15 @@ var AlterColumn = NewFn(func(state *State) Fn {
 		// Not support modify/change primary key columns.
 		cols = cols.Diff(pk.Columns)
 	}
+	// Not support modify/change the partitioning columns.
+	cols = cols.Diff(tbl.PartitionColumns())
+	// Not support modify/change the generated columns and the columns they reference.
+	// Not support modify/change the AUTO_INCREMENT or AUTO_RANDOM column, which removes the attribute.
+	cols = cols.Diff(tbl.ExprDepColumns()).Filter(func(c *Column) bool {
+		return c.Generated == nil && !c.IsAutoAllocated()
+	})
+	// Not support modify/change the columns in the foreign keys or the CHECK constraints.
+	cols = cols.Diff(state.ConstraintColumns(tbl))
 	if len(cols) == 0 {
 		return None("no columns can be modified")
 	}
@@ -453,7 +889,7 @@ var AlterColumn = NewFn(func(state *State) Fn {
 		AlterColumnModify,
 		AlterColumnSet,
 	)
-})
+}).P(HasModifiableColumn)
 
 var AlterIndex = NewFn(func(state *State) Fn {
 	tbl := state.Env().Table
@@ -488,6 +924,12 @@ var RenameColumn = NewFn(func(state *State) Fn {
 		// Not support operate the same object in multi-schema change.
 		return !state.Env().MultiObjs.SameObject(c.Name)
 	})
+	// Not support renaming the partitioning columns.
+	cols = cols.Diff(tbl.PartitionColumns())
+	// Not support renaming the columns referenced by the generated columns or the expression indexes.
+	cols = cols.Diff(tbl.ExprDepColumns())
+	// Not support renaming the columns in the foreign keys or the CHECK constraints.
+	cols = cols.Diff(state.ConstraintColumns(tbl))
 	if len(cols) == 0 {
 		return None("no suitable column to rename")
 	}
@@ -591,13 +1033,13 @@ var AlterColumnSet = NewFn(func(state *State) Fn {
 
 var AlterColumnSetDefault = NewFn(func(state *State) Fn {
 	col := state.env.Column
-	col.DefaultVal = col.RandomValue()
+	col.DefaultVal, col.DefaultSeq = col.RandomValue(), nil
 	return Strs("set default", col.DefaultVal)
 })
 
 var AlterColumnDropDefault = NewFn(func(state *State) Fn {
 	col := state.env.Column
-	col.DefaultVal = ""
+	col.DefaultVal, col.DefaultSeq = "", nil
 	return Str("drop default")
 })
 
@@ -643,8 +1085,15 @@ var AndOr = NewFn(func(state *State) Fn {
 	)
 })
 
+// CreateTableLike copies the structure of a table. The tables with foreign keys or CHECK constraints are not copied,
+// because the names of the constraints must be unique. The temporary tables are not copied either.
 var CreateTableLike = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.PersistentTables().Filter(func(t *Table) bool {
+		return len(t.ForeignKeys) == 0 && len(t.Checks) == 0
+	}).Rand()
+	if tbl == nil {
+		return None("all tables have constraints or are temporary")
+	}
 	newTbl := tbl.CloneCreateTableLike(state)
 	state.Tables = state.Tables.Append(newTbl)
 	return Strs("create table", newTbl.Name, "like", tbl.Name)
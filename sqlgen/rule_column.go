@@ -13,6 +13,16 @@ var ColumnDefinitions = NewFn(func(state *State) Fn {
 })
 
 var ColumnDefinition = NewFn(func(state *State) Fn {
+	return Or(
+		BaseColumnDefinition.W(10),
+		GeneratedColumnDefinition,
+		AutoIncrementColumnDefinition.P(HasNoAutoColumn, CanDefineIndexes),
+		AutoRandomColumnDefinition.P(HasNoAutoColumn, HasNoPrimaryKey, CanDefineIndexes, IsNotTemporary),
+		SequenceColumnDefinition.P(HasSequences, IsNotTemporary),
+	)
+})
+
+var BaseColumnDefinition = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
 	partialCol := &Column{ID: state.alloc.AllocColumnID()}
 	state.env.Column = partialCol
@@ -34,6 +44,109 @@ var ColumnDefinition = NewFn(func(state *State) Fn {
 	return Str(ret)
 })
 
+// GeneratedColumnDefinition defines a column computed from the other columns of the table,
+// e.g. col_3 varchar(12) collate utf8mb4_bin generated always as (lower(col_1)) virtual.
+var GeneratedColumnDefinition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	col, ok := randGeneratedColumn(state, tbl)
+	if !ok {
+		return None("no column to generate from")
+	}
+	// Adding a stored generated column is not supported.
+	col.Generated.Stored = !state.env.IsIn("AddColumn") && RandomBool()
+	tbl.AppendColumn(col)
+	if state.env.MultiObjs != nil {
+		state.env.MultiObjs.AddName(col.Name)
+	}
+	base := *col
+	base.Generated = nil
+	def := []string{base.String()}
+	if col.IsUnsigned {
+		def = append(def, "unsigned")
+	}
+	if col.Collation != nil {
+		def = append(def, "collate", col.Collation.CollationName)
+	}
+	return Strs(append(def, col.Generated.String())...)
+})
+
+// randGeneratedColumn returns a new column generated from a random writable column of tbl,
+// or false if no column can be used to generate one.
+func randGeneratedColumn(state *State, tbl *Table) (*Column, bool) {
+	deps := tbl.WritableColumns().Filter(func(c *Column) bool {
+		if c.IsAutoAllocated() {
+			return false
+		}
+		return (c.Tp.IsIntegerType() || c.Tp.IsFloatingType() || c.Tp == ColumnTypeChar || c.Tp == ColumnTypeVarchar ||
+			c.Tp == ColumnTypeDate || c.Tp == ColumnTypeDatetime || c.Tp == ColumnTypeTimestamp) &&
+			!state.env.MultiObjs.SameObject(c.Name)
+	})
+	if len(deps) == 0 {
+		return nil, false
+	}
+	dep := deps.Rand()
+	col := &Column{ID: state.alloc.AllocColumnID()}
+	col.Name = fmt.Sprintf("col_%d", col.ID)
+	var expr string
+	switch {
+	case dep.Tp.IsIntegerType():
+		col.Tp, col.IsUnsigned = ColumnTypeBigInt, dep.IsUnsigned
+		expr = []string{"%s div 2", "%s mod 7"}[rand.Intn(2)]
+	case dep.Tp.IsFloatingType():
+		col.Tp = ColumnTypeDouble
+		expr = []string{"%s / 2", "floor(%s)"}[rand.Intn(2)]
+	case dep.Tp.IsStringType():
+		col.Tp, col.Arg1, col.Collation = ColumnTypeVarchar, dep.Arg1+2, dep.Collation
+		expr = []string{"lower(%s)", "upper(%s)", "reverse(%s)", "concat(%s, '_g')"}[rand.Intn(4)]
+	default:
+		col.Tp = ColumnTypeInt
+		expr = []string{"year(%s)", "to_days(%s)", "dayofweek(%s)"}[rand.Intn(3)]
+	}
+	col.Generated = &Generated{Expr: expr, Deps: Columns{dep}}
+	return col, true
+}
+
+// AutoIncrementColumnDefinition defines an integer column whose values can be allocated,
+// e.g. col_1 bigint unsigned not null auto_increment. CreateTable adds a key for it if necessary.
+var AutoIncrementColumnDefinition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	col := &Column{ID: state.alloc.AllocColumnID(), IsAutoIncrement: true}
+	col.Name = fmt.Sprintf("col_%d", col.ID)
+	col.Tp = []ColumnType{ColumnTypeInt, ColumnTypeBigInt}[rand.Intn(2)]
+	col.IsUnsigned, col.IsNotNull = RandomBool(), RandomBool()
+	tbl.AppendColumn(col)
+	def := []string{col.Name, col.Tp.String()}
+	if col.IsUnsigned {
+		def = append(def, "unsigned")
+	}
+	if col.IsNotNull {
+		def = append(def, "not null")
+	}
+	return Strs(append(def, "auto_increment")...)
+})
+
+// AutoRandomColumnDefinition defines a bigint clustered primary key whose values are allocated randomly,
+// e.g. col_1 bigint auto_random(5) primary key clustered.
+var AutoRandomColumnDefinition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	if len(tbl.UpdatableColumns()) == 0 {
+		// Leave some columns to UPDATE, because the AUTO_RANDOM column cannot be updated.
+		return None("no column defined before the auto random column")
+	}
+	col := &Column{ID: state.alloc.AllocColumnID(), Tp: ColumnTypeBigInt, IsNotNull: true}
+	col.Name = fmt.Sprintf("col_%d", col.ID)
+	col.AutoRandomBits = 1 + rand.Intn(15)
+	tbl.AppendColumn(col)
+	pk := &Index{ID: state.alloc.AllocIndexID(), Tp: IndexTypePrimary}
+	pk.Name = fmt.Sprintf("idx_%d", pk.ID)
+	pk.AppendColumn(col, 0)
+	tbl.AppendIndex(pk)
+	tbl.Clustered = true
+	return Strs(col.Name, col.Tp.String(),
+		"/*T![auto_rand] auto_random(", Num(col.AutoRandomBits), ") */",
+		"primary key /*T![clustered_index] clustered */")
+})
+
 var ColumnDefinitionName = NewFn(func(state *State) Fn {
 	col := state.env.Column
 	col.Name = fmt.Sprintf("col_%d", col.ID)
@@ -0,0 +1,283 @@
+package sqlgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// ConstraintDefinitions defines the foreign keys and the CHECK constraints in CREATE TABLE.
+var ConstraintDefinitions = NewFn(func(state *State) Fn {
+	return Repeat(ConstraintDefinition.R(0, 2), Str(","))
+})
+
+var ConstraintDefinition = NewFn(func(state *State) Fn {
+	return Or(
+		ForeignKeyDefinition.W(4).P(CanReferenceTables, CanDefineIndexes),
+		CheckDefinition,
+	)
+})
+
+// ForeignKeyDefinition references a unique key of another table by new columns of the same types, which are
+// indexed explicitly, e.g. col_5 int, key idx_3 (col_5), constraint fk_1 foreign key (col_5) references tbl_1 (col_1)
+// on delete cascade on update restrict. The full types are copied, including the collations and the elements,
+// though the referable keys only consist of the numeric and time columns.
+var ForeignKeyDefinition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	parent := referableTables(state, tbl).Rand()
+	key := parent.ReferableKeys().Rand()
+	fk := &ForeignKey{
+		Name:       fmt.Sprintf("fk_%d", state.alloc.AllocConstraintID()),
+		RefTable:   parent,
+		RefColumns: key.Columns,
+	}
+	idx := &Index{ID: state.alloc.AllocIndexID(), Tp: IndexTypeNonUnique}
+	idx.Name = fmt.Sprintf("idx_%d", idx.ID)
+	defs := make([]string, 0, len(key.Columns)+2)
+	for _, refCol := range key.Columns {
+		col := &Column{
+			ID:         state.alloc.AllocColumnID(),
+			Tp:         refCol.Tp,
+			Arg1:       refCol.Arg1,
+			Arg2:       refCol.Arg2,
+			Args:       cloneStrings(refCol.Args),
+			Collation:  refCol.Collation,
+			IsUnsigned: refCol.IsUnsigned,
+		}
+		col.Name = fmt.Sprintf("col_%d", col.ID)
+		tbl.AppendColumn(col)
+		fk.Columns = append(fk.Columns, col)
+		idx.AppendColumn(col, 0)
+		def := col.String()
+		if col.IsUnsigned {
+			def += " unsigned"
+		}
+		if col.Tp.IsStringType() && col.Collation != nil {
+			def += " collate " + col.Collation.CollationName
+		}
+		defs = append(defs, def)
+	}
+	tbl.AppendIndex(idx)
+	fk.OnDelete, fk.OnUpdate = randReferOption(true), randReferOption(true)
+	tbl.ForeignKeys = append(tbl.ForeignKeys, fk)
+	defs = append(defs, fmt.Sprintf("key %s %s", idx.Name, PrintColumnNamesWithPar(idx.Columns, "")), fk.String())
+	return Str(strings.Join(defs, ", "))
+})
+
+// CheckDefinition defines a CHECK constraint on a column, e.g. constraint chk_2 check (col_1 <> 10).
+var CheckDefinition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	chk, ok := randCheck(state, tbl)
+	if !ok || state.checkDisabled {
+		return Empty
+	}
+	tbl.Checks = append(tbl.Checks, chk)
+	return Str(chk.String())
+})
+
+// AlterConstraint adds or drops a foreign key or a CHECK constraint of env.Table.
+// It cannot be combined with the other changes in a statement.
+var AlterConstraint = NewFn(func(state *State) Fn {
+	return Or(
+		AddForeignKey.P(HasForeignKeyCandidates),
+		DropForeignKey.P(HasForeignKeys),
+		AddCheck.P(HasCheckableColumns, IsCheckEnabled),
+		DropCheck.P(HasChecks, IsCheckEnabled),
+	)
+}).P(func(state *State) bool {
+	return HasForeignKeyCandidates(state) || HasForeignKeys(state) ||
+		(IsCheckEnabled(state) && (HasCheckableColumns(state) || HasChecks(state)))
+})
+
+// AddForeignKey references a unique key of another table by the existing columns of the same types.
+// The columns are indexed implicitly by an index named after the foreign key if no index is led by them.
+var AddForeignKey = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	fk := foreignKeyCandidates(state, tbl)[0]
+	fk.Name = fmt.Sprintf("fk_%d", state.alloc.AllocConstraintID())
+	nullable := !fk.Columns.Found(func(c *Column) bool {
+		return c.IsNotNull
+	})
+	fk.OnDelete, fk.OnUpdate = randReferOption(nullable), randReferOption(nullable)
+	tbl.ForeignKeys = append(tbl.ForeignKeys, fk)
+	if !tbl.Indexes.Found(func(i *Index) bool {
+		return i.LedBy(fk.Columns)
+	}) {
+		idx := &Index{ID: state.alloc.AllocIndexID(), Name: fk.Name, Tp: IndexTypeNonUnique}
+		for _, c := range fk.Columns {
+			idx.AppendColumn(c, 0)
+		}
+		tbl.AppendIndex(idx)
+	}
+	return Strs("add", fk.String())
+})
+
+var DropForeignKey = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	i := rand.Intn(len(tbl.ForeignKeys))
+	fk := tbl.ForeignKeys[i]
+	tbl.ForeignKeys = append(tbl.ForeignKeys[:i], tbl.ForeignKeys[i+1:]...)
+	return Strs("drop foreign key", fk.Name)
+})
+
+var AddCheck = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	chk, _ := randCheck(state, tbl)
+	tbl.Checks = append(tbl.Checks, chk)
+	return Strs("add", chk.String())
+})
+
+var DropCheck = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	i := rand.Intn(len(tbl.Checks))
+	chk := tbl.Checks[i]
+	tbl.Checks = append(tbl.Checks[:i], tbl.Checks[i+1:]...)
+	return Strs("drop constraint", chk.Name)
+})
+
+// ViolateConstraint inserts or updates a row of env.Table with the values which violate a foreign key
+// or a CHECK constraint deliberately. The statement is expected to fail, so the row is not recorded.
+// The CHECK constraints are not violated while they are disabled.
+var ViolateConstraint = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	cols, vals := tbl.ViolatingValues(IsCheckEnabled(state))
+	writable := tbl.WritableColumns()
+	row := tbl.GenRandValues(writable)
+	for i, c := range cols {
+		row[writable.ByID(c.ID)] = vals[i]
+	}
+	return Or(
+		Strs("insert into", tbl.Name, PrintColumnNamesWithPar(writable, ""), "values (", PrintRandValues(row), ")"),
+		And(Strs("update", tbl.Name, "set", PrintAssignments(cols, vals), "where"), Predicates),
+	)
+})
+
+// DeleteReferencedRows deletes the rows of env.Table by the key referenced by a foreign key.
+// The referential action is applied to the rows of the child table.
+var DeleteReferencedRows = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	fk, key := randReferencedKey(state, tbl)
+	if containsNull(key) {
+		return None("the referenced key is null")
+	}
+	state.DeleteRows(tbl, fk.RefColumns, key)
+	return Strs("delete from", tbl.Name, "where", PrintColumnNamesWithPar(fk.RefColumns, ""), "= (", PrintRandValues(key), ")")
+})
+
+// UpdateReferencedRows updates a column of the key referenced by a foreign key in the rows of env.Table.
+// The referential action is applied to the rows of the child table.
+var UpdateReferencedRows = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	fk, key := randReferencedKey(state, tbl)
+	col := fk.RefColumns.Rand()
+	newVal := col.RandomValuesAsc(1)[0]
+	if containsNull(key) || tbl.HasRow(Columns{col}, []string{newVal}) {
+		return None("the referenced key is null or the new value exists")
+	}
+	state.UpdateRows(tbl, fk.RefColumns, key, col, newVal)
+	return Strs("update", tbl.Name, "set", PrintAssignments(Columns{col}, []string{newVal}),
+		"where", PrintColumnNamesWithPar(fk.RefColumns, ""), "= (", PrintRandValues(key), ")")
+})
+
+// randReferencedKey returns a random foreign key referencing tbl, and a key of tbl. The key is taken from
+// a row of the child table if possible, so that the referential action is likely to take effect.
+func randReferencedKey(state *State, tbl *Table) (*ForeignKey, []string) {
+	fks, children := state.ReferencingKeys(tbl)
+	i := rand.Intn(len(fks))
+	if key := children[i].GetRandRow(fks[i].Columns); key != nil && RandomBool() {
+		return fks[i], key
+	}
+	return fks[i], tbl.GetRandRow(fks[i].RefColumns)
+}
+
+// referableTables returns the tables which can be referenced by the foreign keys of tbl.
+// The temporary tables are not in any foreign key.
+func referableTables(state *State, tbl *Table) Tables {
+	return state.PersistentTables().Filter(func(t *Table) bool {
+		return t.ID != tbl.ID && len(t.ReferableKeys()) > 0
+	})
+}
+
+// foreignKeyCandidates returns the foreign keys which can be added to tbl in random order. Only the tables
+// created earlier can be referenced, so that the foreign keys never form a cycle.
+func foreignKeyCandidates(state *State, tbl *Table) []*ForeignKey {
+	if tbl.Partition != nil || tbl.Temporary != TempTableNone {
+		return nil
+	}
+	cols := tbl.WritableColumns().Filter(func(c *Column) bool {
+		return !c.IsAutoAllocated()
+	})
+	var fks []*ForeignKey
+	for _, parent := range referableTables(state, tbl) {
+		if parent.ID > tbl.ID {
+			continue
+		}
+		for _, key := range parent.ReferableKeys() {
+			fk := &ForeignKey{RefTable: parent, RefColumns: key.Columns}
+			for _, refCol := range key.Columns {
+				same := cols.Filter(func(c *Column) bool {
+					return c.SameFullTypeAs(refCol) && !fk.Columns.Contain(c)
+				})
+				if len(same) == 0 {
+					break
+				}
+				fk.Columns = append(fk.Columns, same.Rand())
+			}
+			if len(fk.Columns) == len(key.Columns) {
+				fks = append(fks, fk)
+			}
+		}
+	}
+	rand.Shuffle(len(fks), func(i, j int) {
+		fks[i], fks[j] = fks[j], fks[i]
+	})
+	return fks
+}
+
+// randCheck returns a new CHECK constraint on a random column of tbl, which is satisfied by the known rows,
+// or false if no column can be checked.
+func randCheck(state *State, tbl *Table) (*Check, bool) {
+	cols := checkableColumns(tbl)
+	if len(cols) == 0 {
+		return nil, false
+	}
+	col := cols.Rand()
+	chk := &Check{Name: fmt.Sprintf("chk_%d", state.alloc.AllocConstraintID()), Column: col}
+	if !col.IsNotNull && col.DefaultVal != "null" && !tbl.HasRow(Columns{col}, []string{"null"}) && RandomBool() {
+		chk.Expr, chk.Violation = "%s is not null", "null"
+		return chk, true
+	}
+	v := col.RandomValuesAsc(1)[0]
+	for retry := 0; retry < 10 && (v == col.DefaultVal || tbl.HasRow(Columns{col}, []string{v})); retry++ {
+		v = col.RandomValuesAsc(1)[0]
+	}
+	chk.Expr, chk.Violation = "%s <> "+strings.ReplaceAll(v, "%", "%%"), v
+	return chk, true
+}
+
+// checkableColumns returns the columns which can be used in CHECK constraints. The columns in foreign keys
+// are not checked, so that their values are always taken from the referenced rows.
+func checkableColumns(tbl *Table) Columns {
+	var fkCols Columns
+	for _, fk := range tbl.ForeignKeys {
+		fkCols = append(fkCols, fk.Columns...)
+	}
+	return tbl.WritableColumns().Diff(fkCols).Filter(func(c *Column) bool {
+		switch c.Tp {
+		case ColumnTypeChar, ColumnTypeVarchar, ColumnTypeDecimal, ColumnTypeDate, ColumnTypeDatetime:
+		default:
+			if !c.Tp.IsIntegerType() {
+				return false
+			}
+		}
+		return !c.IsAutoAllocated()
+	})
+}
+
+// randReferOption returns a random referential action. SET NULL is only used if the columns are nullable.
+func randReferOption(nullable bool) ReferOption {
+	if nullable {
+		return ReferOption(rand.Intn(4))
+	}
+	return []ReferOption{ReferOptionRestrict, ReferOptionCascade, ReferOptionNoAction}[rand.Intn(3)]
+}
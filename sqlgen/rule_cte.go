@@ -6,230 +6,125 @@ import (
 	"strings"
 )
 
-// a replacement to avoid initialization loop
-var CTEQueryStatementReplacement Fn
-
+// CTEQueryStatement is a query with a WITH clause. The CTEs are referenced like the tables,
+// e.g. in the joins, the derived tables and the subqueries.
 var CTEQueryStatement = NewFn(func(state *State) Fn {
-	return And(WithClause, SimpleCTEQuery)
-})
+	return And(WithClause(state, state.ReadableTables()), Query)
+}).P(HasTables)
 
+// CTEDMLStatement is an UPDATE or a DELETE with a WITH clause. The CTEs are referenced in the subqueries.
 var CTEDMLStatement = NewFn(func(state *State) Fn {
-	state.ctes = state.ctes[:0]
-	return And(
-		WithClause,
-		DMLStmt,
-	)
-})
-
-var SimpleCTEQuery = NewFn(func(state *State) Fn {
-	parentCTE := state.ParentCTE()
-	ctes := state.PopCTE()
-	if rand.Intn(10) == 0 {
-		c := rand.Intn(len(ctes))
-		for i := 0; i < c; i++ {
-			ctes = append(ctes, ctes[rand.Intn(len(ctes))])
-		}
-	}
-
-	rand.Shuffle(len(ctes), func(i, j int) {
-		ctes[j], ctes[i] = ctes[i], ctes[j]
+	tbl := state.Tables.Rand()
+	srcs := state.Tables.Filter(func(t *Table) bool {
+		return t.ID != tbl.ID
 	})
-
-	//ctes = ctes[:rand.Intn(mathutil.Min(len(ctes), 2))+1]
-
-	cteNames := make([]string, 0, len(ctes))
-	colsInfo := make(map[ColumnType][]string)
-	colNames := make([]string, 0)
-	colNames = append(colNames, "1")
-	for i := range ctes {
-		ctes[i].AsName = fmt.Sprintf("cte_as_%d", state.alloc.AllocCTEID())
-		cteNames = append(cteNames, fmt.Sprintf("%s as %s", ctes[i].Name, ctes[i].AsName))
-		for _, col := range ctes[i].Columns {
-			if _, ok := colsInfo[col.Tp]; !ok {
-				colsInfo[col.Tp] = make([]string, 0)
-			}
-			colsInfo[col.Tp] = append(colsInfo[col.Tp], fmt.Sprintf("%s.%s", ctes[i].AsName, col.Name))
-			colNames = append(colNames, fmt.Sprintf("%s.%s", ctes[i].AsName, col.Name))
-		}
+	if len(srcs) == 0 {
+		return None("no table for the CTEs")
 	}
-
-	// todo: it can infer the cte or the common table
-	if parentCTE != nil {
-		colNames = colNames[:1]
-		for _, c := range parentCTE.Columns[1:] {
-			if _, ok := colsInfo[c.Tp]; ok {
-				colNames = append(colNames, colsInfo[c.Tp][rand.Intn(len(colsInfo[c.Tp]))])
-			} else {
-				colNames = append(colNames, PrintConstantWithFunction(c.Tp))
+	state.env.Table = tbl
+	return And(WithClause(state, srcs), Or(CommonUpdate, CommonDelete))
+}).P(HasTables)
+
+// WithClause defines 1..3 CTEs over the tables srcs or the CTEs defined before. The CTEs can be
+// referenced in the rest of the statement, because they are put into the env of the caller.
+func WithClause(state *State, srcs Tables) Fn {
+	n := 1 + rand.Intn(3)
+	defs := make([]Fn, 0, n)
+	recursive := false
+	for i := 0; i < n; i++ {
+		visible := state.env.CTEs
+		src := srcs.Rand()
+		if len(visible) > 0 && rand.Intn(3) == 0 {
+			src = visible.Rand()
+		}
+		cte, srcCols := newCTE(state, src)
+		isRecursive := rand.Intn(3) == 0
+		if isRecursive {
+			counter := state.GenNewColumnWithType(ColumnTypeInt)
+			cte.Columns = append(Columns{counter}, cte.Columns...)
+			for j, row := range cte.Values {
+				cte.Values[j] = append([]string{"0"}, row...)
 			}
+			recursive = true
 		}
-	}
-	orderByFields := make([]string, len(colNames))
-	for i := range orderByFields {
-		orderByFields[i] = fmt.Sprintf("%d", i+1)
+		defs = append(defs, cteDefinition(cte, src, srcCols, isRecursive, visible))
+		state.env.CTEs = append(visible[:len(visible):len(visible)], cte)
 	}
-	return And(
-		Str("("),
-		Str("select"),
-		Str(strings.Join(colNames, ",")),
-		Str("from"),
-		Str(strings.Join(cteNames, ",")),
-		If(rand.Intn(10) == 0,
-			And(
-				Str("where exists ("),
-				Query,
-				Str(")"),
-			),
-		),
-		If(parentCTE == nil,
-			And(
-				Str("order by"),
-				Str(strings.Join(orderByFields, ",")),
-			),
-		),
-		And(Str("limit"), Str(RandomNum(0, 20))),
-		Str(")"),
-	)
-})
-
-var WithClause = NewFn(func(state *State) Fn {
-	validSQLPercent := 75
-	state.IncCTEDeep()
 	return And(
 		Str("with"),
-		Or(
-			If(ShouldValid(validSQLPercent), Str("recursive")),
-			Str("recursive"),
-		),
-		Repeat(CTEDefinition.R(1, 3), Str(",")),
+		If(recursive || rand.Intn(4) == 0, Str("recursive")),
+		Join(defs, Str(",")),
 	)
-})
+}
 
-var CTEDefinition = NewFn(func(state *State) Fn {
-	validSQLPercent := 75
-	cte := state.GenNewCTE()
-	colCnt := state.ParentCTEColCount()
-	if colCnt == 0 {
-		colCnt = 2
-	}
-	cte.AppendColumn(state.GenNewColumnWithType(ColumnTypeInt))
-	for i := 0; i < colCnt+rand.Intn(2); i++ {
-		cte.AppendColumn(state.GenNewColumnWithType(ColumnTypeInt, ColumnTypeChar))
+// newCTE returns a CTE whose columns are of the types of the columns srcCols of src.
+func newCTE(state *State, src *Table) (cte *Table, srcCols Columns) {
+	cte = state.GenNewCTE()
+	idx := rand.Perm(len(src.Columns))
+	idx = idx[:1+rand.Intn(len(idx))]
+	for _, i := range idx {
+		srcCols = append(srcCols, src.Columns[i])
+		col := *src.Columns[i]
+		col.ID = state.alloc.AllocColumnID()
+		col.Name = fmt.Sprintf("col_%d", col.ID)
+		col.Generated = nil
+		cte.Columns = append(cte.Columns, &col)
 	}
-	if !ShouldValid(validSQLPercent) {
-		if RandomBool() && state.GetCTECount() != 0 {
-			cte.Name = state.GetRandomCTE().Name
-		} else {
-			cte.Name = state.Tables.Rand().Name
+	for _, row := range src.Values {
+		vals := make([]string, 0, len(idx))
+		for _, i := range idx {
+			vals = append(vals, row[i])
 		}
+		cte.Values = append(cte.Values, vals)
 	}
-	state.PushCTE(cte)
-
-	return And(
-		Str(cte.Name),
-		Strs("(", PrintColumnNamesWithoutPar(cte.Columns, ""), ")"),
-		Str("AS"),
-		CTEExpressionParens,
-	)
-})
+	return cte, srcCols
+}
 
-var CTESeedPart = NewFn(func(state *State) Fn {
-	validSQLPercent := 75
-	tbl := state.Tables.Rand()
-	currentCTE := state.CurrentCTE()
-	fields := make([]string, len(currentCTE.Columns)-1)
-	for i := range fields {
-		switch rand.Intn(4) {
-		case 0, 3:
-			cols := tbl.Columns.Filter(func(column *Column) bool {
-				return column.Tp == currentCTE.Columns[i+1].Tp
-			})
-			if len(cols) != 0 {
-				fields[i] = cols[rand.Intn(len(cols))].Name
-				continue
-			}
-			fallthrough
-		case 1:
-			fields[i] = currentCTE.Columns[i+1].RandomValue()
-		case 2:
-			if ShouldValid(validSQLPercent) {
-				fields[i] = PrintConstantWithFunction(currentCTE.Columns[i+1].Tp)
-			} else {
-				fields[i] = fmt.Sprintf("a") // for unknown column
+// cteDefinition returns a Fn which generates the definition of cte, which only references the CTEs in visible.
+// A recursive CTE counts the iterations in its first column, so the recursion always terminates.
+func cteDefinition(cte, src *Table, srcCols Columns, recursive bool, visible Tables) Fn {
+	ret := defaultFn()
+	ret.Info = "CTEDefinition"
+	ret.Gen = func(state *State) (string, error) {
+		state.env.CTEs = visible
+		state.env.Table = src
+		state.env.QState = nil
+		if state.env.IsIn("CTEDMLStatement") {
+			// The target table of UPDATE and DELETE cannot be read in the subqueries of the CTEs.
+			disableSubQuery(state)
+		}
+		fields := make([]string, 0, len(cte.Columns))
+		if recursive {
+			fields = append(fields, "0")
+		}
+		for _, c := range srcCols {
+			fields = append(fields, fmt.Sprintf("%s.%s", src.Name, c.Name))
+		}
+		seed := And(Strs("select", strings.Join(fields, ", "), "from", src.Name), WhereClause)
+		body := seed
+		if recursive {
+			counter := fmt.Sprintf("%s.%s", cte.Name, cte.Columns[0].Name)
+			recFields := []string{counter + " + 1"}
+			for _, c := range cte.Columns[1:] {
+				recFields = append(recFields, fmt.Sprintf("%s.%s", cte.Name, c.Name))
 			}
+			body = And(seed, Or(Str("union all"), Str("union")),
+				Strs("select", strings.Join(recFields, ", "), "from", cte.Name,
+					"where", counter, "<", RandomNum(1, 5)))
 		}
+		return And(
+			Strs(cte.Name, "(", PrintColumnNamesWithoutPar(cte.Columns, ""), ") as ("),
+			body,
+			Str(")"),
+		).Eval(state)
 	}
+	return ret
+}
 
-	if !ShouldValid(validSQLPercent) {
-		fields = append(fields, "1")
-	}
-
-	return Or(
-		And(
-			Str("select 1,"),
-			Str(strings.Join(fields, ",")),
-			Str("from"),
-			Str(tbl.Name), // todo: it can refer the exist cte and the common table
-		).W(5),
-		CTEQueryStatementReplacement,
-	)
-})
-
-var CTERecursivePart = NewFn(func(state *State) Fn {
-	validSQLPercent := 75
-	lastCTE := state.CurrentCTE()
-	if !ShouldValid(validSQLPercent) {
-		lastCTE = state.GetRandomCTE()
-	}
-	fields := append(make([]string, 0, len(lastCTE.Columns)), fmt.Sprintf("%s + 1", lastCTE.Columns[0].Name))
-	for _, col := range lastCTE.Columns[1:] {
-		fields = append(fields, PrintColumnWithFunction(col))
-	}
-	if !ShouldValid(validSQLPercent) {
-		rand.Shuffle(len(fields[1:]), func(i, j int) {
-			fields[1+i], fields[1+j] = fields[1+j], fields[1+i]
-		})
-		if rand.Intn(20) == 0 {
-			fields = append(fields, "1")
-		}
+// randQueryTable returns a random table or view, or a CTE which can be referenced in the current scope.
+func randQueryTable(state *State) *Table {
+	if len(state.env.CTEs) > 0 && rand.Intn(2) == 0 {
+		return state.env.CTEs.Rand()
 	}
-
-	// todo: recursive part can be a function, const
-	return Or(
-		And(
-			Str("select"),
-			Str(strings.Join(fields, ",")),
-			Str("from"),
-			Str(lastCTE.Name), // todo: it also can be a cte
-			Str("where"),
-			Str(fmt.Sprintf("%s < %d", lastCTE.Columns[0].Name, 5)),
-			Opt(And(Str("limit"), Str(RandomNum(0, 20)))),
-		),
-	)
-})
-
-var CTEExpressionParens = NewFn(func(state *State) Fn {
-	return And(
-		Str("("),
-		CTESeedPart,
-		Opt(
-			And(
-				Str("UNION"),
-				UnionOption,
-				CTERecursivePart,
-			),
-		),
-		Str(")"))
-})
-
-var UnionOption = NewFn(func(state *State) Fn {
-	return Or(
-		Empty,
-		Str("DISTINCT"),
-		Str("ALL"),
-	)
-})
-
-func init() {
-	CTEQueryStatementReplacement = CTEQueryStatement
+	return state.ReadableTables().Rand()
 }
@@ -11,7 +11,7 @@ var BuiltinFunction = NewFn(func(state *State) Fn {
 	strCols := cols.Filter(func(c *Column) bool {
 		return c.Tp.IsStringType()
 	}).Or(cols.Columns)
-	intCols := tbl.Columns.Filter(func(c *Column) bool {
+	intCols := cols.Filter(func(c *Column) bool {
 		return c.Tp.IsIntegerType()
 	}).Or(cols.Columns)
 	mk := func(colName string) Fn {
@@ -81,12 +81,6 @@ var AggFunction = NewFn(func(state *State) Fn {
 		return c.Tp.IsIntegerType()
 	}).Or(cols.Columns)
 	col := intCols.Rand()
-	for i, c := range cols.Columns {
-		if c.ID == col.ID {
-			cols.Attr[i] = QueryAggregation // group by clause needs this.
-			break
-		}
-	}
 	c1 := Str(fmt.Sprintf("%s.%s", tbl.Name, col.Name))
 	distinctOpt := Opt(Str("distinct"))
 	return Or(
@@ -103,7 +97,10 @@ var AggFunction = NewFn(func(state *State) Fn {
 		Strf("var_samp([%fn])", c1),
 		Strf("stddev_pop([%fn])", c1),
 		Strf("stddev_samp([%fn])", c1),
-		// Strf("json_objectagg([%fn], [%fn])", c1, c2),
+		// The order of the elements is undefined, so only the length of json_arrayagg is compared.
+		Strf("json_length(json_arrayagg([%fn]))", c1),
+		// The values of the duplicated keys are the same, so the result is deterministic.
+		Strf("json_objectagg(ifnull([%fn], 'null'), [%fn])", c1, c1),
 		Strf("approx_count_distinct([%fn])", c1),
 		Strf("approx_percentile([%fn], [%fn])", c1, Str(RandomNum(0, 100))),
 	)
@@ -120,3 +117,399 @@ var CompareSymbol = NewFn(func(state *State) Fn {
 		Str("!="),
 	)
 })
+
+// ExprOfType returns a Fn which generates an expression of the type tp.
+func ExprOfType(tp ColumnType) Fn {
+	ret := defaultFn()
+	ret.Info = "ExprOfType"
+	ret.Gen = func(state *State) (string, error) {
+		state.env.ExprTp = tp
+		return Expr2.Eval(state)
+	}
+	return ret
+}
+
+// Expr2 refers to Expr to break the initialization cycle.
+var Expr2 Fn
+
+func init() {
+	Expr2 = Expr
+}
+
+// Expr generates an expression of the type state.env.ExprTp recursively.
+// The columns are picked from the tables in state.env.QState, or state.env.Table if it is absent.
+var Expr = NewFn(func(state *State) Fn {
+	state.env.ExprDepth++
+	tp := state.env.ExprTp
+	return Or(
+		ExprColumn.W(4),
+		ExprConstant.W(2),
+		ExprPredicate.W(3).P(NoTooDeepExpr, func(state *State) bool {
+			return tp == ColumnTypeBoolean
+		}),
+		ExprArithmetic.W(2).P(NoTooDeepExpr, func(state *State) bool {
+			return tp.IsNumericType()
+		}),
+		ExprNumericFunction.W(2).P(NoTooDeepExpr, func(state *State) bool {
+			return tp.IsNumericType()
+		}),
+		ExprFunctionCall.W(2).P(NoTooDeepExpr),
+		ExprTimeFunction.W(2).P(NoTooDeepExpr),
+		ExprJSONFunction.W(2).P(NoTooDeepExpr),
+		ExprControlFlow.P(NoTooDeepExpr),
+		ExprCast.P(NoTooDeepExpr),
+		ExprSubQuery.P(NoTooDeepExpr, NoTooDeepSubQuery),
+	)
+})
+
+// ExprOfRandColumnType generates an expression of the type of a random column.
+// JSON is excluded because its order is not comparable between different databases.
+var ExprOfRandColumnType = NewFn(func(state *State) Fn {
+	cols := exprColumns(state, exprTable(state)).Filter(func(c *Column) bool {
+		return c.Tp != ColumnTypeJSON
+	})
+	if len(cols) == 0 {
+		return None("no column of comparable type")
+	}
+	return ExprOfType(cols.Rand().Tp)
+})
+
+// ExprOfExactColumnType generates an expression of the type of a random column which is not FLOAT or DOUBLE,
+// so that its values are compared exactly, e.g. in ORDER BY ... LIMIT.
+var ExprOfExactColumnType = NewFn(func(state *State) Fn {
+	cols := exprColumns(state, exprTable(state)).Filter(func(c *Column) bool {
+		return c.Tp != ColumnTypeJSON && c.Tp != ColumnTypeFloat && c.Tp != ColumnTypeDouble
+	})
+	if len(cols) == 0 {
+		return None("no column of exact type")
+	}
+	return ExprOfType(cols.Rand().Tp)
+})
+
+var ExprColumn = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	tbl := exprTable(state)
+	cols := exprColumns(state, tbl).Filter(func(c *Column) bool {
+		return tp.CompatibleWith(c.Tp)
+	})
+	if len(cols) == 0 {
+		return None("no column of compatible type")
+	}
+	return Str(fmt.Sprintf("%s.%s", tbl.Name, cols.Rand().Name))
+})
+
+var ExprConstant = NewFn(func(state *State) Fn {
+	return Str(RandConstantOfType(state.env.ExprTp))
+})
+
+var ExprPredicate = NewFn(func(state *State) Fn {
+	operandTp := exprColumns(state, exprTable(state)).Rand().Tp
+	e1, e2, e3 := ExprOfType(operandTp), ExprOfType(operandTp), ExprOfType(operandTp)
+	b1, b2 := ExprOfType(ColumnTypeBoolean), ExprOfType(ColumnTypeBoolean)
+	return Or(
+		Strf("([%fn]) [%fn] ([%fn])", e1, CompareSymbol, e2).W(3),
+		Strf("([%fn]) <=> ([%fn])", e1, e2),
+		Strf("([%fn]) is null", e1),
+		Strf("([%fn]) is not null", e1),
+		Strf("([%fn]) between ([%fn]) and ([%fn])", e1, e2, e3),
+		Strf("([%fn]) in ([%fn], [%fn])", e1, e2, e3),
+		Strf("([%fn]) and ([%fn])", b1, b2),
+		Strf("([%fn]) or ([%fn])", b1, b2),
+		Strf("([%fn]) xor ([%fn])", b1, b2),
+		Strf("not ([%fn])", b1),
+	)
+})
+
+// ExprArithmetic generates arithmetic over mixed signed, unsigned, decimal and floating operands.
+var ExprArithmetic = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	opTp1, opTp2 := tp, tp
+	if tp.IsFloatingType() {
+		// The result of the mixed operands is a decimal or a double.
+		opTp1, opTp2 = RandNumericType(), RandNumericType()
+	}
+	e1, e2 := ExprOfType(opTp1), ExprOfType(opTp2)
+	return Or(
+		Strf("([%fn]) + ([%fn])", e1, e2),
+		Strf("([%fn]) - ([%fn])", e1, e2),
+		Strf("([%fn]) * ([%fn])", e1, e2),
+		Strf("([%fn]) / ([%fn])", e1, e2).P(func(state *State) bool {
+			return tp.IsFloatingType()
+		}),
+		Strf("([%fn]) div ([%fn])", e1, e2),
+		Strf("([%fn]) % ([%fn])", e1, e2),
+		Strf("([%fn]) mod ([%fn])", e1, e2),
+		Strf("mod(([%fn]), ([%fn]))", e1, e2),
+		Strf("-([%fn])", e1),
+		// Subtracting from an unsigned value overflows if the result is negative.
+		Strf("cast([%fn] as unsigned) - ([%fn])", e1, e2).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+	)
+})
+
+// ExprNumericFunction generates rounding functions with precision arguments and bit operations.
+var ExprNumericFunction = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	e1 := ExprOfType(RandNumericType())
+	prec := Str(RandomNum(-3, 6))
+	b1, b2 := ExprOfType(ColumnTypeBit), ExprOfType(ColumnTypeBit)
+	shift := Str(RandomNum(0, 64))
+	return Or(
+		Strf("round([%fn])", e1),
+		Strf("round([%fn], [%fn])", e1, prec).W(2),
+		Strf("truncate([%fn], [%fn])", e1, prec).W(2),
+		Strf("ceil([%fn])", e1),
+		Strf("ceiling([%fn])", e1),
+		Strf("floor([%fn])", e1),
+		Strf("([%fn]) & ([%fn])", b1, b2).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		Strf("([%fn]) | ([%fn])", b1, b2).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		Strf("([%fn]) ^ ([%fn])", b1, b2).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		Strf("~([%fn])", b1).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		Strf("([%fn]) << [%fn]", b1, shift).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		Strf("([%fn]) >> [%fn]", b1, shift).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		Strf("bit_count([%fn])", b1).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+	)
+})
+
+var ExprFunctionCall = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	e1, e2 := ExprOfType(tp), ExprOfType(tp)
+	s1, s2 := ExprOfType(ColumnTypeVarchar), ExprOfType(ColumnTypeVarchar)
+	n := Str(RandomNum(0, 10))
+	switch {
+	case tp.IsIntegerType() || tp == ColumnTypeBoolean:
+		return Or(
+			Strf("length([%fn])", s1),
+			Strf("char_length([%fn])", s1),
+			Strf("locate([%fn], [%fn])", s1, s2),
+			Strf("strcmp([%fn], [%fn])", s1, s2),
+			Strf("abs([%fn])", e1),
+			Strf("sign([%fn])", e1),
+			Strf("greatest([%fn], [%fn])", e1, e2),
+			Strf("least([%fn], [%fn])", e1, e2),
+			Strf("isnull([%fn])", e1),
+		)
+	case tp.IsFloatingType():
+		return Or(
+			Strf("abs([%fn])", e1),
+			Strf("greatest([%fn], [%fn])", e1, e2),
+			Strf("least([%fn], [%fn])", e1, e2),
+		)
+	case tp.IsStringType() || tp == ColumnTypeEnum || tp == ColumnTypeSet:
+		return Or(
+			Strf("concat([%fn], [%fn])", s1, s2),
+			Strf("concat_ws(',', [%fn], [%fn])", s1, s2),
+			Strf("lower([%fn])", s1),
+			Strf("upper([%fn])", s1),
+			Strf("substring([%fn], [%fn])", s1, n),
+			Strf("left([%fn], [%fn])", s1, n),
+			Strf("right([%fn], [%fn])", s1, n),
+			Strf("replace([%fn], [%fn], [%fn])", s1, s2, s1),
+			Strf("trim([%fn])", s1),
+			Strf("reverse([%fn])", s1),
+			Strf("lpad([%fn], [%fn], [%fn])", s1, n, s2),
+			Strf("hex([%fn])", s1),
+		)
+	}
+	return None("no function returns the type")
+})
+
+// ExprTimeFunction generates a date and time function call whose arguments are typed against the time columns.
+var ExprTimeFunction = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	t1, t2 := ExprOfType(ColumnTypeDatetime), ExprOfType(ColumnTypeDatetime)
+	d1 := ExprOfType(ColumnTypeDate)
+	tm := ExprOfType(ColumnTypeTime)
+	fmtStr := Str(RandTimeFormat())
+	switch {
+	case tp == ColumnTypeDate || tp == ColumnTypeDatetime || tp == ColumnTypeTimestamp:
+		return Or(
+			Strf("date_add([%fn], [%fn])", t1, Str(RandInterval())).W(3),
+			Strf("date_sub([%fn], [%fn])", t1, Str(RandInterval())).W(3),
+			Strf("adddate([%fn], [%fn])", d1, Str(RandomNum(-1000, 1000))),
+			Strf("subdate([%fn], [%fn])", d1, Str(RandomNum(-1000, 1000))),
+			Strf("[%fn] + [%fn]", t1, Str(RandInterval())),
+			Strf("last_day([%fn])", t1),
+			Strf("makedate([%fn], [%fn])", Str(RandomNum(1970, 2037)), Str(RandomNum(0, 400))),
+			Strf("str_to_date(date_format([%fn], [%fn]), [%fn])", t1, fmtStr, fmtStr),
+			Strf("str_to_date([%fn], [%fn])", Str(RandDates(1)[0]), Str("'%Y-%m-%d'")),
+			Strf("from_unixtime([%fn])", Str(RandomNum(0, 2147483647))),
+			Strf("from_unixtime(unix_timestamp([%fn]))", t1),
+			Strf("convert_tz([%fn], [%fn], [%fn])", t1, Str(RandTimeZoneOffset()), Str(RandTimeZoneOffset())),
+			Strf("timestamp([%fn])", d1),
+			Strf("timestampadd([%fn], [%fn], [%fn])", Str(RandTimeUnit()), Str(RandomNum(-1000, 1000)), t1),
+		)
+	case tp == ColumnTypeTime:
+		return Or(
+			Strf("maketime([%fn], [%fn], [%fn])", Str(RandomNum(-838, 838)), Str(RandomNum(0, 59)), Str(RandomNum(0, 59))),
+			Strf("date_add([%fn], interval [%fn] [%fn])", tm, Str(RandomNum(-100, 100)), Or(Str("second"), Str("minute"), Str("hour"))),
+			Strf("timediff([%fn], [%fn])", t1, t2),
+			Strf("time([%fn])", t1),
+			Strf("sec_to_time([%fn])", Str(RandomNum(-3020399, 3020399))),
+		)
+	case tp.IsIntegerType():
+		return Or(
+			Strf("datediff([%fn], [%fn])", t1, t2),
+			Strf("timestampdiff([%fn], [%fn], [%fn])", Str(RandTimeUnit()), t1, t2).W(2),
+			Strf("extract([%fn] from [%fn])", Str(RandIntervalUnit()), t1).W(2),
+			Strf("extract([%fn] from [%fn])", Or(Str("hour"), Str("minute"), Str("second"), Str("hour_second")), tm),
+			Strf("unix_timestamp([%fn])", t1),
+			Strf("week([%fn], [%fn])", t1, Str(RandomNum(0, 7))),
+			Strf("yearweek([%fn], [%fn])", t1, Str(RandomNum(0, 7))),
+			Strf("dayofweek([%fn])", d1),
+			Strf("dayofyear([%fn])", d1),
+			Strf("to_days([%fn])", d1),
+			Strf("time_to_sec([%fn])", tm),
+		)
+	case tp.IsStringType():
+		return Or(
+			Strf("date_format([%fn], [%fn])", t1, fmtStr).W(3),
+			Strf("time_format([%fn], [%fn])", tm, Str("'%H:%i:%s'")),
+			Strf("from_unixtime([%fn], [%fn])", Str(RandomNum(0, 2147483647)), fmtStr),
+			Strf("dayname([%fn])", d1),
+			Strf("monthname([%fn])", d1),
+		)
+	}
+	return None("no time function returns the type")
+})
+
+// ExprJSONFunction generates a JSON function call. The paths are derived from the documents of RandJsons.
+var ExprJSONFunction = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	j1, j2 := ExprOfType(ColumnTypeJSON), ExprOfType(ColumnTypeJSON)
+	p1, p2 := Str(RandJSONPath(true)), Str(RandJSONPath(true))
+	// The paths of the modifying functions may not contain wildcards.
+	m1 := Str(RandJSONPath(false))
+	doc := Str(RandJsons(1)[0])
+	val := Or(
+		Str(RandomNum(-100, 100)),
+		Str(RandConstantOfType(ColumnTypeVarchar)),
+		Strf("cast([%fn] as json)", doc),
+	)
+	switch {
+	case tp == ColumnTypeJSON:
+		return Or(
+			Strf("json_extract([%fn], [%fn])", j1, p1).W(3),
+			Strf("json_extract([%fn], [%fn], [%fn])", j1, p1, p2),
+			ExprJSONColumnPath.W(2),
+			Strf("json_set([%fn], [%fn], [%fn])", j1, m1, val),
+			Strf("json_insert([%fn], [%fn], [%fn])", j1, m1, val),
+			Strf("json_replace([%fn], [%fn], [%fn])", j1, m1, val),
+			Strf("json_remove([%fn], [%fn])", j1, Str(RandJSONPath(false))),
+			Strf("json_keys([%fn])", j1),
+			Strf("json_keys([%fn], [%fn])", j1, m1),
+			Strf("json_array([%fn], [%fn])", j1, val),
+			Strf("json_object('k1', [%fn], 'k2', [%fn])", j1, val),
+		)
+	case tp.IsIntegerType() || tp == ColumnTypeBoolean:
+		return Or(
+			Strf("json_contains([%fn], [%fn])", j1, doc).W(2),
+			Strf("json_contains([%fn], [%fn], [%fn])", j1, doc, m1),
+			Strf("json_contains_path([%fn], [%fn], [%fn], [%fn])", j1, Or(Str("'one'"), Str("'all'")), p1, p2),
+			Strf("json_overlaps([%fn], [%fn])", j1, j2),
+			Strf("json_length([%fn])", j1),
+			Strf("json_length([%fn], [%fn])", j1, m1),
+			Strf("json_depth([%fn])", j1),
+			ExprJSONMemberOf,
+		)
+	case tp.IsStringType():
+		return Or(
+			ExprJSONColumnPath.W(2),
+			Strf("json_unquote(json_extract([%fn], [%fn]))", j1, p1),
+			Strf("json_type([%fn])", j1),
+			Strf("json_quote([%fn])", Str(RandConstantOfType(ColumnTypeVarchar))),
+		)
+	}
+	return None("no JSON function returns the type")
+})
+
+// ExprJSONColumnPath generates `col->path` for JSON expressions, or `col->>path` for string expressions.
+var ExprJSONColumnPath = NewFn(func(state *State) Fn {
+	tbl := exprTable(state)
+	cols := exprColumns(state, tbl).Filter(func(c *Column) bool {
+		return c.Tp == ColumnTypeJSON
+	})
+	if len(cols) == 0 {
+		return None("no JSON column")
+	}
+	op := "->"
+	if state.env.ExprTp != ColumnTypeJSON {
+		op = "->>"
+	}
+	return Str(fmt.Sprintf("%s.%s%s%s", tbl.Name, cols.Rand().Name, op, RandJSONPath(true)))
+})
+
+// ExprJSONMemberOf generates `value MEMBER OF(json_array)`, which is supported since TiDB v6.3 and MySQL 8.0.17.
+// Disable it by state.SetWeight(ExprJSONMemberOf, 0) for the older versions.
+var ExprJSONMemberOf = NewFn(func(state *State) Fn {
+	return Strf("[%fn] member of ([%fn])", Str(RandomNum(-5, 5)), ExprOfType(ColumnTypeJSON))
+})
+
+var ExprControlFlow = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	e1, e2, e3 := ExprOfType(tp), ExprOfType(tp), ExprOfType(tp)
+	b1, b2 := ExprOfType(ColumnTypeBoolean), ExprOfType(ColumnTypeBoolean)
+	return Or(
+		Strf("case when [%fn] then [%fn] else [%fn] end", b1, e1, e2),
+		Strf("case when [%fn] then [%fn] when [%fn] then [%fn] end", b1, e1, b2, e2),
+		Strf("if([%fn], [%fn], [%fn])", b1, e1, e2),
+		Strf("ifnull([%fn], [%fn])", e1, e2),
+		Strf("coalesce([%fn], [%fn], [%fn])", e1, e2, e3),
+		Strf("nullif([%fn], [%fn])", e1, e2),
+	)
+})
+
+// ExprCast generates CAST and CONVERT. The source types and the target types are taken
+// from the cast matrix in turn, so that every pair is covered in a long run.
+var ExprCast = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	pair, ok := state.NextCastPair(func(p CastPair) bool {
+		return tp.CompatibleWith(p.Target.Tp)
+	})
+	if !ok {
+		return None("the type cannot be a cast target")
+	}
+	e := ExprOfType(pair.Src)
+	target := Str(pair.Target.Name)
+	if pair.Target.Tp == ColumnTypeVarchar && pair.Src.IsStringType() {
+		return Or(
+			Strf("cast([%fn] as [%fn])", e, target),
+			Strf("convert([%fn] using [%fn])", e, Str(Collations[CollationType(rand.Intn(int(CollationTypeMax)-1)+1)].CharsetName)),
+		)
+	}
+	return Or(
+		Strf("cast([%fn] as [%fn])", e, target),
+		Strf("convert([%fn], [%fn])", e, target),
+	)
+})
+
+func exprTable(state *State) *Table {
+	if state.env.QState != nil && len(state.env.QState.SelectedCols) > 0 {
+		return state.env.QState.GetRandTable()
+	}
+	return state.env.Table
+}
+
+func exprColumns(state *State, tbl *Table) Columns {
+	if state.env.QState != nil {
+		if cols, ok := state.env.QState.SelectedCols[tbl]; ok {
+			return cols.Columns
+		}
+	}
+	return tbl.Columns
+}
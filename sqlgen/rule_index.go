@@ -18,8 +18,13 @@ var IndexDefinition = NewFn(func(state *State) Fn {
 	// Example:
 	//   unique key idx_1 (a, b, c)
 	//   primary key (a(2), b(3), c)
+	tp, err := IndexDefinitionType.Eval(state)
+	if err != nil {
+		// No index type is available, e.g. the only type is the primary key, which is defined by the AUTO_RANDOM column.
+		return Empty
+	}
 	ret, err := And(
-		IndexDefinitionType,
+		Str(tp),
 		IndexDefinitionName,
 		IndexDefinitionColumns,
 		IndexDefinitionClustered,
@@ -56,28 +61,34 @@ var IndexDefinitionName = NewFn(func(state *State) Fn {
 })
 
 var IndexDefinitionColumns = NewFn(func(state *State) Fn {
-	return And(Str("("), Repeat(IndexDefinitionColumn.R(1, 3), Str(",")), Str(")"))
+	minCnt := 1
+	if state.env.Index.IsUnique() {
+		// Leave room for all the partitioning columns.
+		minCnt = mathutil.Max(minCnt, len(state.env.Table.PartitionColumns()))
+	}
+	return And(Str("("), Repeat(IndexDefinitionColumn.R(minCnt, mathutil.Max(minCnt, 3)), Str(",")), Str(")"))
 })
 
 var IndexDefinitionColumn = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
 	idx := state.env.Index
-	partCol := state.env.PartColumn
-	if partCol != nil && idx.IsUnique() && !idx.Columns.Contain(partCol) {
-		state.env.IdxColumn = partCol
-		return Or(
-			IndexDefinitionColumnNoPrefix,
-			IndexDefinitionColumnPrefix.P(IndexColumnPrefixable),
-		)
+	if idx.IsUnique() {
+		// A unique key must include all the partitioning columns, without the prefix.
+		for _, partCol := range tbl.PartitionColumns() {
+			if !idx.Columns.Contain(partCol) {
+				state.env.IdxColumn = partCol
+				return IndexDefinitionColumnNoPrefix
+			}
+		}
 	}
 	totalCols := tbl.Columns.Filter(func(c *Column) bool {
 		// json column can't be used as index column.
 		return !idx.HasColumn(c) && c.Tp != ColumnTypeJSON && !state.env.MultiObjs.SameObject(c.Name)
 	})
 	if idx.Tp == IndexTypePrimary {
-		// All parts of a PRIMARY KEY must be NOT NULL.
+		// All parts of a PRIMARY KEY must be NOT NULL, and cannot be generated.
 		totalCols = totalCols.Filter(func(c *Column) bool {
-			return c.DefaultVal != "null"
+			return c.DefaultVal != "null" && c.Generated == nil
 		})
 	}
 	if len(totalCols) == 0 {
@@ -100,9 +111,19 @@ var IndexDefinitionColumnCheckLen = NewFn(func(state *State) Fn {
 	return Or(
 		IndexDefinitionColumnNoPrefix.P(IndexColumnCanHaveNoPrefix),
 		IndexDefinitionColumnPrefix.P(IndexColumnPrefixable),
+		IndexDefinitionColumnExpr.P(IndexColumnExpressible),
 	)
 })
 
+// IndexDefinitionColumnExpr defines a key part of an expression index, e.g. (lower(a)).
+var IndexDefinitionColumnExpr = NewFn(func(state *State) Fn {
+	idx := state.env.Index
+	col := state.env.IdxColumn
+	fn := []string{"lower", "upper", "md5", "reverse"}[rand.Intn(4)]
+	idx.AppendExprColumn(col, fn)
+	return Strs("(", idx.KeyPart(len(idx.Columns)-1, ""), ")")
+})
+
 var IndexDefinitionColumnNoPrefix = NewFn(func(state *State) Fn {
 	idx := state.env.Index
 	col := state.env.IdxColumn
@@ -1,55 +1,397 @@
 package sqlgen
 
-import "math/rand"
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/mathutil"
+)
 
 var PartitionDefinition = NewFn(func(state *State) Fn {
-	if state.env.PartColumn == nil {
+	if len(state.env.PartColumns) == 0 {
 		return Empty
 	}
 	return Or(
 		Empty,
 		PartitionDefinitionHash,
+		PartitionDefinitionKey,
 		PartitionDefinitionRange,
+		PartitionDefinitionRangeColumns,
 		PartitionDefinitionList,
+		PartitionDefinitionListColumns,
 	)
 })
 
 var PartitionDefinitionHash = NewFn(func(state *State) Fn {
-	partitionedCol := state.env.PartColumn
-	partitionNum := RandomNum(1, 6)
-	return And(
-		Str("partition by hash ("),
-		Str(partitionedCol.Name),
-		Str(")"),
-		Str("partitions"),
-		Str(partitionNum),
-	)
+	part := newExprPartition(state, PartitionTypeHash)
+	if part == nil {
+		return None("no column can be partitioned by hash")
+	}
+	part.ResizeHash(1 + rand.Intn(6))
+	state.env.Table.Partition = part
+	return Str(part.String())
+})
+
+var PartitionDefinitionKey = NewFn(func(state *State) Fn {
+	part := &Partition{Tp: PartitionTypeKey, Columns: randPartitionColumns(state)}
+	part.ResizeHash(1 + rand.Intn(6))
+	state.env.Table.Partition = part
+	return Str(part.String())
 })
 
 var PartitionDefinitionRange = NewFn(func(state *State) Fn {
-	partitionedCol := state.env.PartColumn
-	partitionCount := rand.Intn(5) + 1
-	vals := partitionedCol.RandomValuesAsc(partitionCount)
+	part := newExprPartition(state, PartitionTypeRange)
+	if part == nil {
+		return None("no column can be partitioned by range")
+	}
+	appendRangeDefs(part)
+	state.env.Table.Partition = part
+	return Str(part.String())
+})
+
+var PartitionDefinitionRangeColumns = NewFn(func(state *State) Fn {
+	part := &Partition{Tp: PartitionTypeRangeColumns, Columns: randPartitionColumns(state)}
+	appendRangeDefs(part)
+	state.env.Table.Partition = part
+	return Str(part.String())
+})
+
+var PartitionDefinitionList = NewFn(func(state *State) Fn {
+	part := newExprPartition(state, PartitionTypeList)
+	if part == nil {
+		return None("no column can be partitioned by list")
+	}
+	appendListDefs(part)
+	state.env.Table.Partition = part
+	return Str(part.String())
+})
+
+var PartitionDefinitionListColumns = NewFn(func(state *State) Fn {
+	part := &Partition{Tp: PartitionTypeListColumns, Columns: randPartitionColumns(state)}
+	appendListDefs(part)
+	state.env.Table.Partition = part
+	return Str(part.String())
+})
+
+// newExprPartition returns a HASH, RANGE or LIST partitioning over an integer column, or over an integer
+// function of a column, e.g. year(d). It returns nil if no column in env.PartColumns can be used.
+func newExprPartition(state *State, tp PartitionType) *Partition {
+	var candidates []*Partition
+	for _, c := range state.env.PartColumns {
+		switch {
+		case c.Tp.IsPartitionType():
+			candidates = append(candidates,
+				&Partition{Tp: tp, Columns: Columns{c}},
+				&Partition{Tp: tp, Columns: Columns{c}, Func: "floor"})
+		case c.Tp == ColumnTypeDate || c.Tp == ColumnTypeDatetime:
+			candidates = append(candidates,
+				&Partition{Tp: tp, Columns: Columns{c}, Func: "year"},
+				&Partition{Tp: tp, Columns: Columns{c}, Func: "to_days"})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// randPartitionColumns returns 1 or 2 columns for KEY, RANGE COLUMNS and LIST COLUMNS.
+func randPartitionColumns(state *State) Columns {
+	cols := state.env.PartColumns
+	return gRandN(cols, 1+rand.Intn(mathutil.Min(2, len(cols))))
+}
+
+func appendRangeDefs(part *Partition) {
+	for _, bound := range partitionKeyValues(part, 1+rand.Intn(5)) {
+		part.AppendDef(bound)
+	}
 	if rand.Intn(2) == 0 {
-		partitionCount++
-		vals = append(vals, "maxvalue")
-	}
-	return Strs(
-		"partition by range (",
-		partitionedCol.Name, ") (",
-		PrintRangePartitionDefs(vals),
-		")",
+		part.AppendDef(maxValues(len(part.Columns)))
+	}
+}
+
+func appendListDefs(part *Partition) {
+	var items []string
+	for _, v := range partitionKeyValues(part, 20) {
+		items = append(items, partitionListItem(v))
+	}
+	for _, g := range RandomGroups(items, rand.Intn(3)+1) {
+		part.AppendDef(g)
+	}
+}
+
+// partitionKeyValues returns at most n distinct values of the partitioning key. A value has an element
+// for each partitioning column, and the values are in ascending order of the first elements.
+func partitionKeyValues(part *Partition, n int) [][]string {
+	firsts := uniqueValues(partitionColumnValues(part.Columns[0], part.Func, n))
+	ret := make([][]string, len(firsts))
+	for i, v := range firsts {
+		ret[i] = []string{v}
+		for _, c := range part.Columns[1:] {
+			ret[i] = append(ret[i], partitionColumnValues(c, "", 1)[0])
+		}
+	}
+	return ret
+}
+
+// partitionColumnValues returns n values of fn(col) in ascending order.
+func partitionColumnValues(col *Column, fn string, n int) []string {
+	switch {
+	case fn == "year":
+		return RandomNums(1970, 2037, n)
+	case fn == "to_days":
+		return RandomNums(719528, 744000, n)
+	case col.Tp.IsStringType():
+		// The lowercase letters are in the same order and distinct in all the collations.
+		idx := rand.Perm(26)[:mathutil.Min(n, 26)]
+		sort.Ints(idx)
+		vals := make([]string, len(idx))
+		for i, j := range idx {
+			vals[i] = fmt.Sprintf("'%c'", 'a'+j)
+		}
+		return vals
+	}
+	return col.RandomValuesAsc(n)
+}
+
+// partitionListItem prints a value of LIST, which is a tuple if there are multiple partitioning columns.
+func partitionListItem(vals []string) string {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return "(" + strings.Join(vals, ", ") + ")"
+}
+
+func maxValues(n int) []string {
+	vals := make([]string, n)
+	for i := range vals {
+		vals[i] = "maxvalue"
+	}
+	return vals
+}
+
+// AlterPartition changes the partitions or the partitioning of env.Table.
+// It cannot be combined with the other changes in a statement.
+var AlterPartition = NewFn(func(state *State) Fn {
+	return Or(
+		AddPartition.P(IsPartitioned),
+		DropPartition.P(HasDroppablePartitions),
+		TruncatePartition.P(IsPartitioned),
+		CoalescePartition.P(HasCoalescablePartitions),
+		ReorganizePartition.P(HasDroppablePartitions),
+		ExchangePartition.P(IsPartitioned),
+		PartitionBy.P(HasPartitionableColumn),
+		RemovePartitioning.P(IsPartitioned),
 	)
+}).P(func(state *State) bool {
+	return IsPartitioned(state) || HasPartitionableColumn(state)
 })
 
-var PartitionDefinitionList = NewFn(func(state *State) Fn {
-	partitionedCol := state.env.PartColumn
-	listVals := partitionedCol.RandomValuesAsc(20)
-	listGroups := RandomGroups(listVals, rand.Intn(3)+1)
-	return Strs(
-		"partition by list (",
-		partitionedCol.Name, ") (",
-		PrintListPartitionDefs(listGroups),
-		")",
+var AddPartition = NewFn(func(state *State) Fn {
+	part := state.env.Table.Partition
+	switch {
+	case part.Tp.IsHash():
+		n := 1 + rand.Intn(3)
+		part.ResizeHash(len(part.Defs) + n)
+		return Strs("add partition partitions", Num(n))
+	case part.Tp.IsRange():
+		last := part.Defs[len(part.Defs)-1].Values[0]
+		bound, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || bound > math.MaxInt64-1000 {
+			return None("no value is greater than the last partition")
+		}
+		newBound := maxValues(len(part.Columns))
+		if rand.Intn(3) != 0 {
+			newBound[0] = strconv.FormatInt(bound+1+rand.Int63n(1000), 10)
+		}
+		def := part.AppendDef(newBound)
+		return Strs("add partition (", PrintRangePartitionDefs([]*PartitionDef{def}), ")")
+	default:
+		var items []string
+		for _, v := range partitionKeyValues(part, 5) {
+			if item := partitionListItem(v); part.DefOfValue(item) == nil {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return None("no value is out of the partitions")
+		}
+		def := part.AppendDef(items)
+		return Strs("add partition (", PrintListPartitionDefs([]*PartitionDef{def}), ")")
+	}
+})
+
+// DropPartition drops some partitions with their rows. The partition of a row is not tracked,
+// so none of the rows is known to be kept.
+var DropPartition = NewFn(func(state *State) Fn {
+	part := state.env.Table.Partition
+	defs := randPartitionDefs(part, len(part.Defs)-1)
+	part.RemoveDefs(defs)
+	state.env.Table.Values = nil
+	return Strs("drop partition", strings.Join(partitionNames(defs), ", "))
+})
+
+// TruncatePartition removes the rows of some partitions. Like DropPartition, the rows are forgotten.
+var TruncatePartition = NewFn(func(state *State) Fn {
+	part := state.env.Table.Partition
+	state.env.Table.Values = nil
+	return Or(
+		Strs("truncate partition", strings.Join(partitionNames(randPartitionDefs(part, len(part.Defs))), ", ")).W(3),
+		Str("truncate partition all"),
+	)
+})
+
+var CoalescePartition = NewFn(func(state *State) Fn {
+	part := state.env.Table.Partition
+	n := 1 + rand.Intn(len(part.Defs)-1)
+	part.ResizeHash(len(part.Defs) - n)
+	return Strs("coalesce partition", Num(n))
+})
+
+// ReorganizePartition merges two partitions into one, or splits a LIST partition into two.
+// The rows are always kept, because the values covered by the partitions do not change.
+var ReorganizePartition = NewFn(func(state *State) Fn {
+	part := state.env.Table.Partition
+	var olds, news []*PartitionDef
+	if part.Tp.IsRange() {
+		// Only the adjacent RANGE partitions can be merged.
+		i := rand.Intn(len(part.Defs) - 1)
+		olds = part.Defs[i : i+2 : i+2]
+		news = []*PartitionDef{part.NewDef(olds[1].Values)}
+	} else {
+		splittable := make([]*PartitionDef, 0, len(part.Defs))
+		for _, def := range part.Defs {
+			if len(def.Values) > 1 {
+				splittable = append(splittable, def)
+			}
+		}
+		if len(splittable) > 0 && RandomBool() {
+			old := splittable[rand.Intn(len(splittable))]
+			pos := 1 + rand.Intn(len(old.Values)-1)
+			olds = []*PartitionDef{old}
+			news = []*PartitionDef{part.NewDef(old.Values[:pos:pos]), part.NewDef(old.Values[pos:])}
+		} else {
+			perm := rand.Perm(len(part.Defs))
+			olds = []*PartitionDef{part.Defs[perm[0]], part.Defs[perm[1]]}
+			vals := append(append([]string{}, olds[0].Values...), olds[1].Values...)
+			news = []*PartitionDef{part.NewDef(vals)}
+		}
+	}
+	oldNames := partitionNames(olds)
+	part.ReplaceDefs(olds, news)
+	return Strs("reorganize partition", strings.Join(oldNames, ", "),
+		"into (", PrintPartitionDefs(part.Tp, news), ")")
+})
+
+// ExchangePartition exchanges a partition with a table which is not partitioned, and has the same structure,
+// e.g. the table created by CREATE TABLE LIKE whose partitioning is removed.
+// The rows of both tables are forgotten, because the rows in the partition are unknown.
+var ExchangePartition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	others := state.Tables.Filter(func(t *Table) bool {
+		return t.ID != tbl.ID && t.Partition == nil && !state.InForeignKey(t) && t.SameStructureAs(tbl)
+	})
+	if len(others) == 0 {
+		return None("no table can be exchanged with the partition")
+	}
+	def := tbl.Partition.Defs[rand.Intn(len(tbl.Partition.Defs))]
+	other := others.Rand()
+	tbl.Values, other.Values = nil, nil
+	return Strs("exchange partition", def.Name, "with table", other.Name)
+})
+
+// PartitionBy repartitions env.Table by the columns, which must be a part of every unique key.
+var PartitionBy = NewFn(func(state *State) Fn {
+	state.env.PartColumns = partitionableColumns(state.env.Table)
+	return Or(
+		PartitionDefinitionHash,
+		PartitionDefinitionKey,
+		PartitionDefinitionRange,
+		PartitionDefinitionRangeColumns,
+		PartitionDefinitionList,
+		PartitionDefinitionListColumns,
 	)
 })
+
+var RemovePartitioning = NewFn(func(state *State) Fn {
+	state.env.Table.Partition = nil
+	return Str("remove partitioning")
+})
+
+// PartitionSelection selects some partitions of env.Table explicitly, e.g. partition (p0, p2).
+var PartitionSelection = NewFn(func(state *State) Fn {
+	part := state.env.Table.Partition
+	if part == nil {
+		return Empty
+	}
+	defs := randPartitionDefs(part, len(part.Defs))
+	return Strs("partition (", strings.Join(partitionNames(defs), ", "), ")")
+})
+
+var PartitionSelectionOpt = NewFn(func(state *State) Fn {
+	return Or(
+		Empty.W(3),
+		PartitionSelection,
+	)
+})
+
+// partitionableColumns returns the columns which can be the partitioning columns of tbl.
+// The temporary tables cannot be partitioned.
+func partitionableColumns(tbl *Table) Columns {
+	if tbl.Temporary != TempTableNone {
+		return nil
+	}
+	uniques := tbl.Indexes.Filter(func(i *Index) bool {
+		return i.IsUnique()
+	})
+	return tbl.Columns.Filter(func(c *Column) bool {
+		if !c.Tp.IsColumnsPartitionType() || c.Generated != nil {
+			return false
+		}
+		// The partitioning columns must be in every unique key, including the primary key,
+		// whose columns cannot be null. An expression key part does not count.
+		return c.DefaultVal != "null" && !uniques.Found(func(i *Index) bool {
+			pos := i.Columns.ByID(c.ID)
+			return pos < 0 || i.Funcs[pos] != ""
+		})
+	})
+}
+
+// randPartitionDefs returns 1..n random partitions in the order of definition.
+func randPartitionDefs(part *Partition, n int) []*PartitionDef {
+	perm := rand.Perm(len(part.Defs))[:1+rand.Intn(n)]
+	defs := make([]*PartitionDef, 0, len(perm))
+	for i, def := range part.Defs {
+		for _, j := range perm {
+			if i == j {
+				defs = append(defs, def)
+			}
+		}
+	}
+	return defs
+}
+
+func partitionNames(defs []*PartitionDef) []string {
+	names := make([]string, len(defs))
+	for i, def := range defs {
+		names[i] = def.Name
+	}
+	return names
+}
+
+// uniqueValues removes the duplicated values, because the values of partitions must be distinct.
+func uniqueValues(vals []string) []string {
+	seen := make(map[string]struct{}, len(vals))
+	ret := vals[:0]
+	for _, v := range vals {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
@@ -3,6 +3,7 @@ package sqlgen
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 
 	"github.com/cznic/mathutil"
@@ -22,45 +23,87 @@ var QueryAll = NewFn(func(state *State) Fn {
 	return Strs("select * from", tbl.Name, "order by", orderByAllCols)
 }).P(HasTables)
 
+// UnionSelect combines 2..N queries by the set operators. The fields of all the branches are of the same types.
 var UnionSelect = NewFn(func(state *State) Fn {
-	tbl1, tbl2 := state.Tables.Rand(), state.Tables.Rand()
-	fieldNum := mathutil.Min(len(tbl1.Columns), len(tbl2.Columns))
-	state.env.Table = tbl1
-	state.env.QState = &QueryState{FieldNumHint: fieldNum, SelectedCols: map[*Table]QueryStateColumns{
-		tbl1: {
-			Columns: tbl1.Columns,
-			Attr:    make([]string, len(tbl1.Columns)),
-		},
-	}}
-	firstSelect, err := CommonSelect.Eval(state)
+	n := 2 + rand.Intn(mathutil.Max(maxSetOpBranches-1, 1))
+	fieldTps := randFieldTypes(state)
+	query, err := setOpTree(state, n, fieldTps, true)
 	if err != nil {
 		return NoneBecauseOf(err)
 	}
+	positions := make([]string, 0, len(fieldTps))
+	for i := range fieldTps {
+		positions = append(positions, strconv.Itoa(i+1))
+	}
+	return Strs(query, "order by", strings.Join(positions, ","), "limit", RandomNum(1, 1000))
+})
+
+// setOpTree combines n branches. The inner operations are parenthesized randomly,
+// otherwise they are combined by the precedence of the set operators.
+func setOpTree(state *State, n int, fieldTps []ColumnType, root bool) (string, error) {
+	if n == 1 {
+		branch, err := setOpBranch(fieldTps).Eval(state)
+		return fmt.Sprintf("( %s )", branch), err
+	}
+	leftN := 1 + rand.Intn(n-1)
+	left, err := setOpTree(state, leftN, fieldTps, false)
+	if err != nil {
+		return "", err
+	}
 	setOpr, err := SetOperator.Eval(state)
 	if err != nil {
-		return NoneBecauseOf(err)
+		return "", err
 	}
-	state.env.Table = tbl2
-	state.env.QState = &QueryState{FieldNumHint: fieldNum, SelectedCols: map[*Table]QueryStateColumns{
-		tbl2: {
-			Columns: tbl2.Columns,
-			Attr:    make([]string, len(tbl2.Columns)),
-		},
-	}}
-	secondSelect, err := CommonSelect.Eval(state)
+	right, err := setOpTree(state, n-leftN, fieldTps, false)
 	if err != nil {
-		return NoneBecauseOf(err)
+		return "", err
 	}
-	return Strs(
-		"(", firstSelect, ")",
-		setOpr,
-		"(", secondSelect, ")",
-		"order by 1 limit", RandomNum(1, 1000),
-	)
-})
+	if !root && rand.Intn(2) == 0 {
+		return fmt.Sprintf("( %s %s %s )", left, setOpr, right), nil
+	}
+	return fmt.Sprintf("%s %s %s", left, setOpr, right), nil
+}
+
+// setOpBranch returns a Fn which generates a query whose fields are of the types fieldTps.
+func setOpBranch(fieldTps []ColumnType) Fn {
+	ret := defaultFn()
+	ret.Info = "setOpBranch"
+	ret.Gen = func(state *State) (string, error) {
+		tbl := randTableOrDerived(state)
+		state.env.Table = tbl
+		state.env.QState = &QueryState{FieldTypes: fieldTps, SelectedCols: map[*Table]QueryStateColumns{
+			tbl: {
+				Columns: tbl.Columns,
+				Attr:    make([]string, len(tbl.Columns)),
+			},
+		}}
+		return CommonSelect.Eval(state)
+	}
+	return ret
+}
+
+// randFieldTypes returns the types of the fields of a set operation, which are picked from the existing columns.
+func randFieldTypes(state *State) []ColumnType {
+	var tps []ColumnType
+	for _, t := range state.Tables {
+		for _, c := range t.Columns {
+			if c.Tp != ColumnTypeJSON {
+				tps = append(tps, c.Tp)
+			}
+		}
+	}
+	if len(tps) == 0 {
+		tps = append(tps, ColumnTypeInt)
+	}
+	fieldTps := make([]ColumnType, 1+rand.Intn(4))
+	for i := range fieldTps {
+		fieldTps[i] = tps[rand.Intn(len(tps))]
+	}
+	return fieldTps
+}
 
 var SingleSelect = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := randTableOrDerived(state)
 	state.env.QState = &QueryState{
 		SelectedCols: map[*Table]QueryStateColumns{
 			tbl: {
@@ -72,45 +115,119 @@ var SingleSelect = NewFn(func(state *State) Fn {
 	return CommonSelect
 })
 
+// MultiSelect joins 2..N tables.
 var MultiSelect = NewFn(func(state *State) Fn {
-	tbl1 := state.Tables.Rand()
-	tbl2 := state.Tables.Rand()
-	state.env.QState = &QueryState{
-		SelectedCols: map[*Table]QueryStateColumns{
-			tbl1: {
-				Columns: tbl1.Columns,
-				Attr:    make([]string, len(tbl1.Columns)),
-			},
-			tbl2: {
-				Columns: tbl2.Columns,
-				Attr:    make([]string, len(tbl2.Columns)),
-			},
-		},
-	}
+	state.env.QState = &QueryState{SelectedCols: randJoinedTables(state)}
 	return CommonSelect
 })
 
+// randJoinedTables picks 2..N tables to join. A table which is joined more than once is referenced by an alias.
+func randJoinedTables(state *State) map[*Table]QueryStateColumns {
+	n := 2 + rand.Intn(mathutil.Max(maxJoinTables-1, 1))
+	selected := make(map[*Table]QueryStateColumns, n)
+	joined := make(map[int]bool, n)
+	for i := 0; i < n; i++ {
+		tbl := randTableOrDerived(state)
+		if tbl.Derived == "" && joined[tbl.ID] {
+			tbl = newTableAlias(state, tbl)
+		}
+		joined[tbl.ID] = true
+		selected[tbl] = QueryStateColumns{
+			Columns: tbl.Columns,
+			Attr:    make([]string, len(tbl.Columns)),
+		}
+	}
+	return selected
+}
+
+// newTableAlias returns a table which references tbl by an alias, e.g. in a self-join.
+func newTableAlias(state *State, tbl *Table) *Table {
+	return &Table{
+		ID:             tbl.ID,
+		Name:           fmt.Sprintf("ta_%d", state.alloc.AllocTableAliasID()),
+		Columns:        tbl.Columns,
+		Collate:        tbl.Collate,
+		Values:         tbl.Values,
+		TiflashReplica: tbl.TiflashReplica,
+		AliasOf:        tbl,
+	}
+}
+
 var CommonSelect = NewFn(func(state *State) Fn {
 	NotNil(state.env.QState)
+	planAggregation(state, state.env.QState)
+	planWindows(state.env.QState)
 	return And(
-		Str("select"), HintTiFlash, Opt(HintIndexMerge), Opt(HintAggToCop), HintJoin,
+		Str("select"), Hints,
+		If(state.env.QState.IsDistinct, Str("distinct")),
 		SelectFields, Str("from"), TableReference,
-		WhereClause, GroupByColumnsOpt, WindowClause, Opt(OrderByLimit), ForUpdateOpt,
+		WhereClause, GroupByColumnsOpt, HavingOpt, WindowClause, Opt(OrderByLimit), ForUpdateOpt,
 	)
 })
 
+// planAggregation decides whether the query is aggregated and which columns are grouped.
+// As ONLY_FULL_GROUP_BY requires, only the grouped columns are referenced outside the aggregate functions.
+func planAggregation(state *State, queryState *QueryState) {
+	for _, scs := range queryState.SelectedCols {
+		for i := range scs.Attr {
+			scs.Attr[i] = ""
+		}
+	}
+	queryState.GroupedFields = nil
+	queryState.IsDistinct = rand.Intn(5) == 0
+	queryState.IsAggregated = rand.Intn(3) == 0
+	queryState.WithRollup = false
+	if !queryState.IsAggregated {
+		return
+	}
+	n := rand.Intn(4)
+	for _, scs := range queryState.SelectedCols {
+		for _, i := range rand.Perm(len(scs.Columns)) {
+			if n == 0 {
+				break
+			}
+			if scs.Columns[i].Tp != ColumnTypeJSON {
+				scs.Attr[i] = QueryGroupBy
+				n--
+			}
+		}
+	}
+	queryState.WithRollup = queryState.HasGroupBy() && state.GetWeight(GroupByWithRollup) > 0 && rand.Intn(2) == 0
+}
+
 var SelectFields = NewFn(func(state *State) Fn {
 	queryState := state.env.QState
+	if len(queryState.FieldTypes) > 0 {
+		queryState.FieldNumHint = len(queryState.FieldTypes)
+	}
 	if queryState.FieldNumHint == 0 {
 		queryState.FieldNumHint = 1 + rand.Intn(5)
 	}
 	var fns []Fn
 	for i := 0; i < queryState.FieldNumHint; i++ {
 		fieldID := fmt.Sprintf("r%d", i)
+		pos := i + 1
 		fns = append(fns, NewFn(func(state *State) Fn {
 			state.env.Table = queryState.GetRandTable()
 			state.env.QColumns = queryState.SelectedCols[state.env.Table]
-			return And(SelectField, Str("as"), Str(fieldID))
+			typed := len(queryState.FieldTypes) > 0
+			if typed {
+				state.env.ExprTp = queryState.FieldTypes[pos-1]
+			}
+			if !queryState.IsAggregated {
+				if typed {
+					return And(ExprOfType(state.env.ExprTp), Str("as"), Str(fieldID))
+				}
+				return And(SelectField, Str("as"), Str(fieldID))
+			}
+			if queryState.HasGroupBy() && rand.Intn(2) == 0 {
+				if !queryState.WithRollup {
+					// GROUPING() cannot be grouped, so the positions are only used without rollup.
+					queryState.GroupedFields = append(queryState.GroupedFields, pos)
+				}
+				return And(GroupedSelectField, Str("as"), Str(fieldID))
+			}
+			return And(AggSelectField, Str("as"), Str(fieldID))
 		}))
 		if i != queryState.FieldNumHint-1 {
 			fns = append(fns, Str(","))
@@ -123,13 +240,61 @@ var SelectField = NewFn(func(state *State) Fn {
 	NotNil(state.env.Table)
 	NotNil(state.env.QColumns)
 	return Or(
-		AggFunction,
 		BuiltinFunction,
 		SelectFieldName,
+		SelectFieldExpr,
 		WindowFunctionOverW,
 	)
 })
 
+var AggSelectField = NewFn(func(state *State) Fn {
+	if len(state.env.QState.FieldTypes) > 0 {
+		// The result of MAX() and MIN() is of the type of the argument.
+		e := ExprOfType(state.env.ExprTp)
+		return Or(
+			Strf("max([%fn])", e),
+			Strf("min([%fn])", e),
+			Str("count(*)").P(func(state *State) bool {
+				return state.env.ExprTp.IsIntegerType()
+			}),
+		)
+	}
+	return Or(
+		AggFunction.W(4),
+		Str("count(*)"),
+	)
+})
+
+// GroupedSelectField generates a field which only references the grouped columns.
+var GroupedSelectField = NewFn(func(state *State) Fn {
+	queryState := state.env.QState
+	view := queryState.GroupedView()
+	NotNil(view)
+	state.env.QState = view
+	state.env.Table = view.GetRandTable()
+	state.env.QColumns = view.SelectedCols[state.env.Table]
+	if len(queryState.FieldTypes) > 0 {
+		return ExprOfType(state.env.ExprTp)
+	}
+	return Or(
+		SelectFieldName.W(3),
+		BuiltinFunction,
+		SelectFieldExpr,
+		GroupingFunction.P(func(state *State) bool {
+			return queryState.WithRollup
+		}),
+	)
+})
+
+var GroupingFunction = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	return Strs("grouping(", fmt.Sprintf("%s.%s", tbl.Name, state.env.QColumns.Rand().Name), ")")
+})
+
+var SelectFieldExpr = NewFn(func(state *State) Fn {
+	return ExprOfType(state.env.QColumns.Rand().Tp)
+})
+
 var SelectFieldName = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
 	cols := state.env.QColumns
@@ -139,62 +304,212 @@ var SelectFieldName = NewFn(func(state *State) Fn {
 
 var TableReference = NewFn(func(state *State) Fn {
 	queryState := state.env.QState
-	tbNames := make([]Fn, 0, len(queryState.SelectedCols))
+	tbls := make([]*Table, 0, len(queryState.SelectedCols))
 	for t := range queryState.SelectedCols {
-		tbNames = append(tbNames, Str(t.Name))
+		tbls = append(tbls, t)
+	}
+	if len(tbls) == 1 {
+		return tableReference(tbls[0])
 	}
-	if len(tbNames) == 1 {
-		return tbNames[0]
+	refs := make([]Fn, 0, len(tbls))
+	for _, t := range tbls {
+		refs = append(refs, tableReference(t))
 	}
 	return Or(
-		Join(tbNames, Str(",")),
-		And(Join(tbNames, JoinType), Str("on"), JoinPredicate),
+		Join(refs, Str(",")),
+		joinTables(tbls).W(3),
 	)
 })
 
+// tableReference prints the table in the FROM clause, which may select some partitions explicitly.
+func tableReference(tbl *Table) Fn {
+	base := baseTable(tbl)
+	if tbl.Derived != "" || base.Partition == nil {
+		return Str(PrintTableReference(tbl))
+	}
+	return NewFn(func(state *State) Fn {
+		state.env.Table = base
+		return And(
+			Str(base.Name),
+			PartitionSelectionOpt,
+			If(tbl.AliasOf != nil, Strs("as", tbl.Name)),
+		)
+	})
+}
+
+// joinTables joins the tables from left to right. The right operand may be a parenthesized join of two tables.
+func joinTables(tbls []*Table) Fn {
+	fns := []Fn{tableReference(tbls[0])}
+	left := tbls[:1]
+	for i := 1; i < len(tbls); {
+		right := tbls[i : i+1]
+		rightRef := tableReference(tbls[i])
+		if i+1 < len(tbls) && rand.Intn(4) == 0 {
+			right = tbls[i : i+2]
+			rightRef = And(Str("("), rightRef, joinWith(right[:1], right[1:], tableReference(tbls[i+1])), Str(")"))
+		}
+		fns = append(fns, joinWith(left, right, rightRef))
+		left = tbls[:i+len(right)]
+		i += len(right)
+	}
+	return And(fns...)
+}
+
+// joinWith joins the right operand to the left tables.
+func joinWith(left, right []*Table, rightRef Fn) Fn {
+	common, unambiguous := commonColumnNames(left, right)
+	return Or(
+		And(JoinType, rightRef, Str("on"), joinOnPredicate(left, right)).W(6),
+		And(Str("cross join"), rightRef),
+		And(Or(Str("natural join"), Str("natural left join"), Str("natural right join")), rightRef).P(func(state *State) bool {
+			return unambiguous
+		}),
+		And(Or(Str("join"), Str("left join"), Str("right join")), rightRef,
+			Strs("using (", strings.Join(common, ","), ")")).W(2).P(func(state *State) bool {
+			return unambiguous && len(common) > 0
+		}),
+	)
+}
+
+// commonColumnNames returns the column names which appear on both sides, they are the join columns of
+// NATURAL JOIN and USING. The join is ambiguous if a column name appears in more than one table on either side.
+func commonColumnNames(left, right []*Table) ([]string, bool) {
+	count := func(tbls []*Table) map[string]int {
+		cnt := make(map[string]int)
+		for _, t := range tbls {
+			for _, c := range t.Columns {
+				cnt[c.Name]++
+			}
+		}
+		return cnt
+	}
+	leftCnt, rightCnt := count(left), count(right)
+	var common []string
+	for _, t := range right {
+		for _, c := range t.Columns {
+			if leftCnt[c.Name] > 1 || rightCnt[c.Name] > 1 {
+				return nil, false
+			}
+			if leftCnt[c.Name] == 1 {
+				common = append(common, c.Name)
+			}
+		}
+	}
+	return common, true
+}
+
 var JoinType = NewFn(func(state *State) Fn {
 	return Or(
 		Str("left join"),
+		Str("left outer join"),
 		Str("right join"),
 		Str("join"),
+		Str("inner join"),
+		Str("straight_join"),
 	)
 })
 
-var JoinPredicate = NewFn(func(state *State) Fn {
-	queryState := state.env.QState
-	var (
-		preds     []string
-		prevTable *Table
-		prevCol   *Column
-	)
-	for t, cols := range queryState.SelectedCols {
-		col := cols.Rand()
-		if prevTable != nil {
-			preds = append(preds,
-				fmt.Sprintf("%s.%s = %s.%s",
-					prevTable.Name, prevCol.Name,
-					t.Name, col.Name))
-		}
-		prevTable = t
-		prevCol = col
+// joinOnPredicate compares the columns of a table on the left and a table on the right.
+func joinOnPredicate(left, right []*Table) Fn {
+	pred := func() Fn {
+		l, r := left[rand.Intn(len(left))], right[rand.Intn(len(right))]
+		c1, c2 := RandomCompatibleColumnPair(l.Columns, r.Columns)
+		n1, n2 := fmt.Sprintf("%s.%s", l.Name, c1.Name), fmt.Sprintf("%s.%s", r.Name, c2.Name)
+		return Or(
+			Strs(n1, "=", n2).W(4),
+			And(Str(n1), CompareSymbol, Str(n2)),
+			Strs(n1, "<=>", n2),
+		)
 	}
-	return Str(strings.Join(preds, " and "))
-})
+	return Or(
+		pred().W(3),
+		And(pred(), Str("and"), pred()),
+	)
+}
 
 var GroupByColumnsOpt = NewFn(func(state *State) Fn {
 	queryState := state.env.QState
-	var groupByItems []string
+	if !queryState.IsAggregated {
+		return Empty
+	}
+	var items []Fn
 	for t, scs := range queryState.SelectedCols {
 		for i, c := range scs.Columns {
-			if scs.Attr[i] == QueryAggregation {
-				groupByItems = append(groupByItems, fmt.Sprintf("%s.%s", t.Name, c.Name))
+			if scs.Attr[i] == QueryGroupBy {
+				items = append(items, Str(fmt.Sprintf("%s.%s", t.Name, c.Name)))
 			}
 		}
 	}
-	if len(groupByItems) == 0 {
+	if len(items) == 0 {
+		return Empty
+	}
+	for _, pos := range queryState.GroupedFields {
+		if rand.Intn(2) == 0 {
+			items = append(items, Str(strconv.Itoa(pos)))
+		}
+	}
+	rand.Shuffle(len(items), func(i, j int) {
+		items[i], items[j] = items[j], items[i]
+	})
+	if rand.Intn(3) == 0 {
+		// Grouping by an extra expression splits the groups, but the fields are still determined.
+		// It is skipped if the chosen table only has JSON columns.
+		if e, err := ExprOfRandColumnType.Eval(state); err == nil {
+			items = append(items, Str(e))
+		}
+	}
+	return And(Str("group by"), Join(items, Str(",")), If(queryState.WithRollup, GroupByWithRollup))
+})
+
+// GroupByWithRollup adds the super-aggregate rows to a grouped query, which is supported since TiDB 7.4.
+// GROUPING() is only generated with it. Disable it by SetWeight for the older versions.
+var GroupByWithRollup = NewFn(func(state *State) Fn {
+	return Str("with rollup")
+})
+
+var HavingOpt = NewFn(func(state *State) Fn {
+	if !state.env.QState.IsAggregated {
 		return Empty
 	}
-	return Opt(Strs("group by", strings.Join(groupByItems, ",")))
+	return Opt(And(Str("having"), HavingPredicate, Opt(And(AndOr, HavingPredicate))))
+})
+
+// HavingPredicate compares an aggregate function, or only references the grouped columns.
+var HavingPredicate = NewFn(func(state *State) Fn {
+	queryState := state.env.QState
+	state.env.Table = queryState.GetRandTable()
+	state.env.QColumns = queryState.SelectedCols[state.env.Table]
+	return Or(
+		And(ComparableAggFunction, CompareSymbol, Str(RandomNum(0, 100))).W(3),
+		GroupedPredicate.P(func(state *State) bool {
+			return queryState.HasGroupBy()
+		}),
+	)
+})
+
+var GroupedPredicate = NewFn(func(state *State) Fn {
+	state.env.QState = state.env.QState.GroupedView()
+	return ExprOfType(ColumnTypeBoolean)
+})
+
+// ComparableAggFunction generates an aggregate function whose result is compared
+// in the same way by TiDB and MySQL, e.g. in HAVING and ORDER BY.
+var ComparableAggFunction = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	cols := state.env.QColumns.Filter(func(c *Column) bool {
+		return c.Tp != ColumnTypeJSON
+	})
+	if len(cols) == 0 {
+		return Str("count(*)")
+	}
+	c := Str(fmt.Sprintf("%s.%s", tbl.Name, cols.Rand().Name))
+	return Or(
+		Str("count(*)"),
+		Strf("count([%fn])", c),
+		Strf("count(distinct [%fn])", c),
+		Strf("max([%fn])", c),
+		Strf("min([%fn])", c),
+	)
 })
 
 var WhereClause = NewFn(func(state *State) Fn {
@@ -204,23 +519,46 @@ var WhereClause = NewFn(func(state *State) Fn {
 	)
 })
 
+// Hints generates the optimizer hints of a query in a single comment, e.g. /*+ use_index_merge(tbl_1) hash_agg() */.
+// Only the first hint comment after SELECT is recognized, so the hints are not in separate comments.
+var Hints = NewFn(func(state *State) Fn {
+	var hints []string
+	for _, fn := range []Fn{HintTiFlash, Opt(HintIndexMerge), Opt(HintAggToCop), HintJoin} {
+		hint, err := fn.Eval(state)
+		if err != nil {
+			return NoneBecauseOf(err)
+		}
+		if hint != "" {
+			hints = append(hints, hint)
+		}
+	}
+	if len(hints) == 0 {
+		return Empty
+	}
+	return Strs("/*+", strings.Join(hints, " "), "*/")
+})
+
 var HintJoin = NewFn(func(state *State) Fn {
 	queryState := state.env.QState
-	if len(queryState.SelectedCols) != 2 {
+	if len(queryState.SelectedCols) < 2 {
 		return Empty
 	}
-	var tbl []*Table
+	var names []string
 	for t := range queryState.SelectedCols {
-		tbl = append(tbl, t)
+		names = append(names, t.Name)
 	}
-	t1, t2 := tbl[0], tbl[1]
+	tbls := strings.Join(names, ", ")
+	rand.Shuffle(len(names), func(i, j int) {
+		names[i], names[j] = names[j], names[i]
+	})
 	return Or(
 		Empty,
-		Strs("/*+ merge_join(", t1.Name, ",", t2.Name, "*/"),
-		Strs("/*+ hash_join(", t1.Name, ",", t2.Name, "*/"),
-		Strs("/*+ inl_join(", t1.Name, ",", t2.Name, ") */"),
-		Strs("/*+ inl_hash_join(", t1.Name, ",", t2.Name, ") */"),
-		Strs("/*+ inl_merge_join(", t1.Name, ",", t2.Name, ") */"),
+		Strs("merge_join(", tbls, ")"),
+		Strs("hash_join(", tbls, ")"),
+		Strs("inl_join(", tbls, ")"),
+		Strs("inl_hash_join(", tbls, ")"),
+		Strs("inl_merge_join(", tbls, ")"),
+		Strs("leading(", strings.Join(names, ", "), ")"),
 	)
 })
 
@@ -229,74 +567,202 @@ var WindowClause = NewFn(func(state *State) Fn {
 	if !queryState.IsWindow {
 		return Empty
 	}
-	for t := range queryState.SelectedCols {
-		state.env.Table = t
+	defs := make([]string, 0, len(queryState.windows))
+	for _, w := range queryState.windows {
+		defs = append(defs, fmt.Sprintf("%s as ( %s )", w.name, w.spec))
 	}
-	return And(
-		Str("window w as"),
-		Str("("),
-		Opt(WindowPartitionBy),
-		WindowOrderBy,
-		Opt(WindowFrame),
-		Str(")"),
-	)
+	return Strs("window", strings.Join(defs, ", "))
 })
 
-var WindowPartitionBy = NewFn(func(state *State) Fn {
-	tbl := state.env.Table
-	cols := tbl.Columns.RandNNotNil()
-	return Strs("partition by", PrintColumnNamesWithoutPar(cols, ""))
-})
+// windowDef is a window specification. A named window can be referenced by the later ones.
+type windowDef struct {
+	name    string
+	spec    string
+	orderBy []*Column
+	// total means the rows are ordered by all the columns, so that the order-sensitive functions are deterministic.
+	total  bool
+	framed bool
+}
 
-var WindowOrderBy = NewFn(func(state *State) Fn {
-	tbl := state.env.Table
-	cols := tbl.Columns.RandNNotNil()
-	return Strs("order by", PrintColumnNamesWithoutPar(cols, ""))
-})
+// planWindows generates the named windows of the query before the fields reference them.
+func planWindows(queryState *QueryState) {
+	queryState.IsWindow = false
+	queryState.windows = nil
+	for i := 0; i < 1+rand.Intn(3); i++ {
+		w := newWindowDef(queryState, randWindowBase(queryState))
+		w.name = fmt.Sprintf("w%d", i)
+		queryState.windows = append(queryState.windows, w)
+	}
+}
 
-var WindowFrame = NewFn(func(state *State) Fn {
-	frames := []string{
-		fmt.Sprintf("%d preceding", rand.Intn(5)),
-		"current row",
-		fmt.Sprintf("%d following", rand.Intn(5)),
+// randWindowBase returns a named window which can be referenced, or nil.
+func randWindowBase(queryState *QueryState) *windowDef {
+	var bases []*windowDef
+	for _, w := range queryState.windows {
+		// A window with a frame cannot be inherited.
+		if !w.framed {
+			bases = append(bases, w)
+		}
 	}
-	get := func(idx int) interface{} { return frames[idx] }
-	set := func(idx int, v interface{}) { frames[idx] = v.(string) }
-	Move(rand.Intn(len(frames)), 0, get, set)
-	return Strs("rows between", frames[1], "and", frames[2])
-})
+	if len(bases) == 0 || rand.Intn(2) == 0 {
+		return nil
+	}
+	return bases[rand.Intn(len(bases))]
+}
+
+// newWindowDef generates a window specification. It only adds the clauses which the base window does not have.
+func newWindowDef(queryState *QueryState, base *windowDef) *windowDef {
+	var tbls []*Table
+	var cols []*Column
+	for t, scs := range queryState.SelectedCols {
+		for _, c := range scs.Columns {
+			tbls = append(tbls, t)
+			cols = append(cols, c)
+		}
+	}
+	names := func(idx []int) string {
+		items := make([]string, 0, len(idx))
+		for _, i := range idx {
+			items = append(items, fmt.Sprintf("%s.%s", tbls[i].Name, cols[i].Name))
+		}
+		return strings.Join(items, ", ")
+	}
+	w := &windowDef{}
+	var parts []string
+	if base != nil {
+		*w = *base
+		parts = append(parts, base.name)
+	}
+	// A window which references another one cannot define the partitioning.
+	if base == nil && rand.Intn(2) == 0 {
+		perm := rand.Perm(len(cols))
+		parts = append(parts, "partition by", names(perm[:1+rand.Intn(len(perm))]))
+	}
+	if len(w.orderBy) == 0 && rand.Intn(4) != 0 {
+		idx := rand.Perm(len(cols))
+		if rand.Intn(3) == 0 {
+			// A single column is required by the RANGE frames with offsets.
+			idx = idx[:1]
+		}
+		for _, i := range idx {
+			w.orderBy = append(w.orderBy, cols[i])
+		}
+		parts = append(parts, "order by", names(idx))
+		w.total = len(idx) == len(cols)
+	}
+	if rand.Intn(2) == 0 {
+		parts = append(parts, windowFrame(w))
+		w.framed = true
+	}
+	w.spec = strings.Join(parts, " ")
+	return w
+}
+
+// windowFrame generates a frame of the window. The ROWS frames are only used in the totally ordered windows,
+// and the RANGE frames only have offsets if the window is ordered by a single numeric or date column.
+func windowFrame(w *windowDef) string {
+	units := "range"
+	var offset func() string
+	if w.total && rand.Intn(2) == 0 {
+		units = "rows"
+		offset = func() string { return RandomNum(0, 5) }
+	} else if len(w.orderBy) == 1 {
+		switch tp := w.orderBy[0].Tp; {
+		case tp.IsIntegerType() || tp.IsFloatingType():
+			offset = func() string { return RandomNum(0, 10) }
+		case tp == ColumnTypeDate || tp == ColumnTypeDatetime || tp == ColumnTypeTimestamp:
+			offset = func() string { return fmt.Sprintf("interval %s %s", RandomNum(0, 10), RandTimeUnit()) }
+		}
+	}
+	bounds := []int{0, 2, 4}
+	if offset != nil {
+		bounds = []int{0, 1, 2, 3, 4}
+	}
+	bound := func(b int) string {
+		switch b {
+		case 0:
+			return "unbounded preceding"
+		case 1:
+			return offset() + " preceding"
+		case 2:
+			return "current row"
+		case 3:
+			return offset() + " following"
+		}
+		return "unbounded following"
+	}
+	// The start cannot be UNBOUNDED FOLLOWING, and the end cannot be before it.
+	start := bounds[rand.Intn(len(bounds)-1)]
+	if start <= 2 && rand.Intn(4) == 0 {
+		return fmt.Sprintf("%s %s", units, bound(start))
+	}
+	var ends []int
+	for _, b := range bounds {
+		if b >= start && b > 0 {
+			ends = append(ends, b)
+		}
+	}
+	return fmt.Sprintf("%s between %s and %s", units, bound(start), bound(ends[rand.Intn(len(ends))]))
+}
 
+// WindowFunctionOverW generates a window function over a named window or an inline window specification.
 var WindowFunctionOverW = NewFn(func(state *State) Fn {
-	NotNil(state.env.QState)
-	return And(WindowFunction, Str("over w"))
-}).P(func(state *State) bool {
 	queryState := state.env.QState
-	return len(queryState.SelectedCols) == 1
+	NotNil(queryState)
+	if len(queryState.windows) == 0 || rand.Intn(3) == 0 {
+		base := randWindowBase(queryState)
+		if base != nil {
+			queryState.IsWindow = true
+		}
+		w := newWindowDef(queryState, base)
+		return And(windowFunction(state, w), Strs("over (", w.spec, ")"))
+	}
+	queryState.IsWindow = true
+	w := queryState.windows[rand.Intn(len(queryState.windows))]
+	return And(windowFunction(state, w), Strs("over", w.name))
 })
 
-var WindowFunction = NewFn(func(state *State) Fn {
+// windowFunction returns the window functions whose results are determined over the window w.
+func windowFunction(state *State, w *windowDef) Fn {
 	queryState := state.env.QState
-	queryState.IsWindow = true
-	var tbl *Table
-	for t := range queryState.SelectedCols {
-		tbl = t
+	tbl := queryState.GetRandTable()
+	cols := queryState.SelectedCols[tbl].Filter(func(c *Column) bool {
+		return c.Tp != ColumnTypeJSON
+	})
+	if len(cols) == 0 {
+		return Or(Str("rank()"), Str("count(*)"))
 	}
-	col := Str(fmt.Sprintf("%s.%s", tbl.Name, tbl.Columns.Rand().Name))
+	col := Str(fmt.Sprintf("%s.%s", tbl.Name, cols.Rand().Name))
+	numCol := Str(fmt.Sprintf("%s.%s", tbl.Name, cols.Filter(func(c *Column) bool {
+		return c.Tp.IsNumericType()
+	}).Or(cols).Rand().Name))
 	num := Str(RandomNum(1, 6))
-	return Or(
-		Str("row_number()"),
+	// The peers are treated the same by the ranking functions and the RANGE frames.
+	fns := []Fn{
 		Str("rank()"),
 		Str("dense_rank()"),
 		Str("cume_dist()"),
 		Str("percent_rank()"),
-		Strf("ntile([%fn])", num),
-		Strf("lead([%fn],[%fn],NULL)", col, num),
-		Strf("lag([%fn],[%fn],NULL)", col, num),
-		Strf("first_value([%fn])", col),
-		Strf("last_value([%fn])", col),
-		Strf("nth_value([%fn],[%fn])", col, num),
-	)
-})
+		Str("count(*)"),
+		Strf("count([%fn])", col),
+		Strf("max([%fn])", col),
+		Strf("min([%fn])", col),
+		Strf("sum([%fn])", numCol),
+		Strf("avg([%fn])", numCol),
+	}
+	if w.total {
+		fns = append(fns,
+			Str("row_number()"),
+			Strf("ntile([%fn])", num),
+			Strf("lead([%fn],[%fn],NULL)", col, num),
+			Strf("lag([%fn],[%fn],NULL)", col, num),
+			Strf("first_value([%fn])", col),
+			Strf("last_value([%fn])", col),
+			Strf("nth_value([%fn],[%fn])", col, num),
+		)
+	}
+	return Or(fns...)
+}
 
 var Predicates = NewFn(func(state *State) Fn {
 	var pred []string
@@ -323,10 +789,11 @@ var Predicates = NewFn(func(state *State) Fn {
 	return Str(strings.Join(pred, " "))
 })
 
-var Predicates2 Fn
+var Predicates2, Predicate2 Fn
 
 func init() {
 	Predicates2 = Predicates
+	Predicate2 = Predicate
 }
 
 var Predicate = NewFn(func(state *State) Fn {
@@ -342,16 +809,65 @@ var Predicate = NewFn(func(state *State) Fn {
 	return Or(
 		pre,
 		And(Str("not("), pre, Str(")")),
+		ExprOfType(ColumnTypeBoolean),
+		ExprIndexPredicate.P(HasIndexedExprs),
 	)
 })
 
+// ExprIndexPredicate compares an indexed expression or the expression of a generated column with
+// the same expression over constants, so the expression indexes and the generated columns can be used.
+var ExprIndexPredicate = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	var preds []Fn
+	for _, idx := range baseTable(tbl).Indexes {
+		for i, c := range idx.Columns {
+			if idx.Funcs[i] == "" {
+				continue
+			}
+			key, fn := idx.KeyPart(i, tbl.Name), idx.Funcs[i]
+			preds = append(preds, Or(
+				Strs(key, "=", fn+"("+randColumnVal(tbl, c)+")"),
+				Strs(key, "in (", fn+"("+randColumnVal(tbl, c)+"),", fn+"("+randColumnVal(tbl, c)+")", ")"),
+			))
+		}
+	}
+	for _, c := range tbl.Columns {
+		if c.Generated == nil {
+			continue
+		}
+		vals := make([]interface{}, len(c.Generated.Deps))
+		for i, dep := range c.Generated.Deps {
+			vals[i] = randColumnVal(tbl, dep)
+		}
+		preds = append(preds, Strs(c.Generated.Print(tbl.Name), "=", fmt.Sprintf(c.Generated.Expr, vals...)))
+	}
+	return Or(preds...)
+})
+
+// baseTable returns the table referenced by the alias tbl, or tbl itself if it is not an alias.
+func baseTable(tbl *Table) *Table {
+	if tbl.AliasOf != nil {
+		return tbl.AliasOf
+	}
+	return tbl
+}
+
+// randColumnVal returns a value of the column col in tbl, or a random value if tbl has no rows.
+func randColumnVal(tbl *Table, col *Column) string {
+	if rand.Intn(3) == 0 || len(tbl.Values) == 0 {
+		return col.RandomValue()
+	}
+	return tbl.GetRandRowVal(col)
+}
+
 var InValues = NewFn(func(state *State) Fn {
 	if len(state.Tables) <= 1 {
 		return RandColVals
 	}
 	return Or(
 		RandColVals,
-		SubSelect,
+		SubSelect.P(NoTooDeepSubQuery),
+		SubSelectWithGivenTp.P(NoTooDeepSubQuery, HasSameColumnType),
 	)
 })
 
@@ -373,7 +889,7 @@ var RandVal = NewFn(func(state *State) Fn {
 
 var SubSelect = NewFn(func(state *State) Fn {
 	tbl := state.Env().Table
-	availableTbls := state.Tables
+	availableTbls := state.ReadableTables()
 	if state.Env().IsIn("CommonDelete") || state.Env().IsIn("CommonUpdate") {
 		availableTbls = availableTbls.Filter(func(t *Table) bool {
 			return t.ID != tbl.ID
@@ -381,6 +897,7 @@ var SubSelect = NewFn(func(state *State) Fn {
 	}
 	subTbl := availableTbls.Rand()
 	subCol := subTbl.Columns.Rand()
+	state.env.SubQueryDepth++
 	return And(
 		Str("select"), Str(subCol.Name), Str("from"), Str(subTbl.Name),
 		Str("where"), Predicates2,
@@ -388,11 +905,25 @@ var SubSelect = NewFn(func(state *State) Fn {
 })
 
 var SubSelectWithGivenTp = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
 	randCol := state.env.Column
-	subTbl, subCol := GetRandTableColumnWithTp(state.Tables, randCol.Tp)
+	inDML := state.env.IsIn("CommonDelete") || state.env.IsIn("CommonUpdate")
+	availableTbls := state.ReadableTables().Filter(func(t *Table) bool {
+		if inDML && t.ID == tbl.ID {
+			return false
+		}
+		return t.Columns.Found(func(c *Column) bool {
+			return c.Tp == randCol.Tp
+		})
+	})
+	if len(availableTbls) == 0 {
+		return None("no table for the subquery")
+	}
+	subTbl, subCol := GetRandTableColumnWithTp(availableTbls, randCol.Tp)
+	state.env.SubQueryDepth++
 	return And(
 		Str("select"), Str(subCol.Name), Str("from"), Str(subTbl.Name),
-		Str("where"), Predicate,
+		Str("where"), Predicate2,
 	)
 }).P(HasSameColumnType)
 
@@ -411,24 +942,37 @@ var HintTiFlash = NewFn(func(state *State) Fn {
 	if len(tbs) == 0 {
 		return Empty
 	}
-	return Strs("/*+ read_from_storage(tiflash[", strings.Join(tbs, ","), "]) */")
+	return Strs("read_from_storage(tiflash[", strings.Join(tbs, ","), "])")
 })
 
 var HintIndexMerge = NewFn(func(state *State) Fn {
 	queryState := state.env.QState
 	var tbs []string
 	for t := range queryState.SelectedCols {
-		tbs = append(tbs, t.Name)
+		if t.Derived == "" {
+			tbs = append(tbs, t.Name)
+		}
+	}
+	if len(tbs) == 0 {
+		return Empty
 	}
-	return Strs("/*+ use_index_merge(", strings.Join(tbs, ","), ") */")
+	return Strs("use_index_merge(", strings.Join(tbs, ","), ")")
+})
+
+var OrderByAggregate = NewFn(func(state *State) Fn {
+	queryState := state.env.QState
+	state.env.Table = queryState.GetRandTable()
+	state.env.QColumns = queryState.SelectedCols[state.env.Table]
+	return ComparableAggFunction
 })
 
 var HintAggToCop = NewFn(func(state *State) Fn {
-	return And(
-		Str("/*+"),
-		Opt(Str("agg_to_cop()")),
-		Or(Empty, Str("hash_agg()"), Str("stream_agg()")),
-		Str("*/"),
+	return Or(
+		Str("agg_to_cop()"),
+		Str("hash_agg()"),
+		Str("stream_agg()"),
+		Str("agg_to_cop() hash_agg()"),
+		Str("agg_to_cop() stream_agg()"),
 	)
 })
 
@@ -436,8 +980,11 @@ var SetOperator = NewFn(func(state *State) Fn {
 	return Or(
 		Str("union"),
 		Str("union all"),
+		Str("union distinct"),
 		Str("except"),
+		Str("except all"),
 		Str("intersect"),
+		Str("intersect all"),
 	)
 })
 
@@ -453,8 +1000,25 @@ var OrderByLimit = NewFn(func(state *State) Fn {
 		}
 		fields.WriteString(fmt.Sprintf("r%d", i))
 	}
+	orderBy := Str(fields.String())
+	switch {
+	case queryState.IsDistinct:
+		// The ORDER BY items of a DISTINCT query must be in the select list.
+	case queryState.IsAggregated:
+		orderBy = Or(
+			orderBy,
+			And(OrderByAggregate, Str(","), orderBy),
+		)
+	default:
+		// The expressions come first, so that the order is still determined by all the fields.
+		// The approximate values are not ordered, because the rows within LIMIT may differ by the rounding.
+		orderBy = Or(
+			orderBy,
+			And(ExprOfExactColumnType, Str(","), orderBy),
+		)
+	}
 	return And(
-		Str("order by"), Str(fields.String()),
+		Str("order by"), orderBy,
 		Opt(Strs("limit", RandomNum(1, 100))),
 	)
 })
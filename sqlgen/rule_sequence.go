@@ -0,0 +1,227 @@
+package sqlgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/mathutil"
+)
+
+// CreateSequence defines a new sequence, e.g. create sequence seq_1 increment by -2 minvalue -10 maxvalue 10 cycle nocache.
+var CreateSequence = NewFn(func(state *State) Fn {
+	seq := state.GenNewSequence()
+	opts := randSequenceOptions(seq, false)
+	seq.Restart()
+	state.Sequences = append(state.Sequences, seq)
+	return Strs(append([]string{"create sequence", seq.Name}, opts...)...)
+})
+
+// AlterSequence redefines all the options of a sequence and restarts it, so that its next value is known again.
+var AlterSequence = NewFn(func(state *State) Fn {
+	seq := state.Sequences.Rand()
+	opts := randSequenceOptions(seq, true)
+	seq.Restart()
+	return Strs(append(append([]string{"alter sequence", seq.Name}, opts...), "restart")...)
+}).P(HasSequences)
+
+// DropSequence drops a sequence which is not the default value of any column.
+var DropSequence = NewFn(func(state *State) Fn {
+	seq := state.Sequences.Filter(func(s *Sequence) bool {
+		return !state.IsSequenceInUse(s)
+	}).Rand()
+	if seq == nil {
+		return None("all sequences are in use")
+	}
+	state.RemoveSequence(seq)
+	return And(Str("drop sequence"), Opt(Str("if exists")), Str(seq.Name))
+}).P(HasSequences)
+
+// randSequenceOptions sets the options of seq randomly and returns them, e.g. increment by 2 minvalue 1
+// maxvalue 21 start with 5 cache 5 cycle. The options left out take the default values, unless all is true.
+func randSequenceOptions(seq *Sequence, all bool) []string {
+	var opts []string
+	seq.Increment = []int64{1, 1, 2, 3, -1, -2}[rand.Intn(6)]
+	step := mathutil.MaxInt64(seq.Increment, -seq.Increment)
+	if all || seq.Increment != 1 || RandomBool() {
+		opts = append(opts, "increment by", strconv.FormatInt(seq.Increment, 10))
+	}
+	// The explicit bounds are aligned with the increment, so that a cycling sequence never skips a bound.
+	explicitBounds := all || RandomBool()
+	switch {
+	case explicitBounds:
+		seq.MinValue = int64(rand.Intn(101) - 50)
+		seq.MaxValue = seq.MinValue + step*int64(5+rand.Intn(50))
+		opts = append(opts, "minvalue", strconv.FormatInt(seq.MinValue, 10),
+			"maxvalue", strconv.FormatInt(seq.MaxValue, 10))
+	case seq.Increment > 0:
+		seq.MinValue, seq.MaxValue = 1, math.MaxInt64-1
+	default:
+		seq.MinValue, seq.MaxValue = math.MinInt64+1, -1
+	}
+	if !explicitBounds && RandomBool() {
+		opts = append(opts, "nominvalue", "nomaxvalue")
+	}
+	k := rand.Int63n(mathutil.MinInt64((seq.MaxValue-seq.MinValue)/step, 20) + 1)
+	if seq.Increment > 0 {
+		seq.Start = seq.MinValue + k*step
+	} else {
+		seq.Start = seq.MaxValue - k*step
+	}
+	if all || k > 0 || RandomBool() {
+		opts = append(opts, "start with", strconv.FormatInt(seq.Start, 10))
+	}
+	// The cached values of a cycling sequence cannot exceed the values in a cycle.
+	seq.Cycle = explicitBounds && rand.Intn(3) == 0
+	switch {
+	case RandomBool():
+		seq.Cache = 0
+		opts = append(opts, "nocache")
+	case seq.Cycle || all || RandomBool():
+		seq.Cache = []int64{2, 5}[rand.Intn(2)]
+		opts = append(opts, "cache", strconv.FormatInt(seq.Cache, 10))
+	default:
+		seq.Cache = 1000
+	}
+	if seq.Cycle {
+		opts = append(opts, "cycle")
+	} else if all || RandomBool() {
+		opts = append(opts, "nocycle")
+	}
+	return opts
+}
+
+// SequenceColumnDefinition defines a column whose default value is taken from a sequence,
+// e.g. col_2 bigint default nextval(seq_1).
+var SequenceColumnDefinition = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	col := &Column{ID: state.alloc.AllocColumnID(), Tp: ColumnTypeBigInt, DefaultSeq: state.Sequences.Rand()}
+	col.Name = fmt.Sprintf("col_%d", col.ID)
+	tbl.AppendColumn(col)
+	if state.env.MultiObjs != nil {
+		state.env.MultiObjs.AddName(col.Name)
+	}
+	return Strs(col.Name, col.Tp.String(), fmt.Sprintf("default nextval(%s)", col.DefaultSeq.Name))
+})
+
+// nextValColumns returns the columns of t which can be written by NEXTVAL, i.e. the signed INT and BIGINT columns
+// which are neither allocated by the server nor in the foreign keys.
+func nextValColumns(t *Table) Columns {
+	return t.UpdatableColumns().Filter(func(c *Column) bool {
+		if c.IsAutoAllocated() || c.IsUnsigned || (c.Tp != ColumnTypeInt && c.Tp != ColumnTypeBigInt) {
+			return false
+		}
+		for _, fk := range t.ForeignKeys {
+			if fk.Columns.Contain(c) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// InsertNextVal inserts the rows whose column takes the next values of a sequence, e.g.
+// insert into tbl_1 (col_1, col_2) values (nextval(seq_1), 'a'), (nextval(seq_1), 'b').
+// The rows may fail before all values are taken, so the next value becomes unknown.
+var InsertNextVal = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	col := nextValColumns(tbl).Rand()
+	seq := state.Sequences.Rand()
+	cols := tbl.WritableColumns()
+	rows := make([]string, 1+rand.Intn(3))
+	for i := range rows {
+		vals := tbl.GenRandValues(cols)
+		vals[cols.ByID(col.ID)] = fmt.Sprintf("nextval(%s)", seq.Name)
+		rows[i] = "(" + PrintRandValues(vals) + ")"
+	}
+	seq.SkipValues()
+	return Strs("insert ignore into", tbl.Name, PrintColumnNamesWithPar(cols, ""), "values", strings.Join(rows, ", "))
+}).P(HasNextValColumns)
+
+// UpdateNextVal sets a column to the next value of a sequence in the row identified by a unique key, e.g.
+// update tbl_1 set col_2 = nextval(seq_1) where col_1 = 10. At most one row is updated, so the updated row
+// does not depend on the order of the rows, but whether a row matches is unknown.
+var UpdateNextVal = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	key := tbl.Indexes.Filter(func(idx *Index) bool {
+		for _, f := range idx.Funcs {
+			if f != "" {
+				return false
+			}
+		}
+		return idx.IsUnique()
+	}).Rand()
+	if key == nil {
+		return None("no unique key to identify a row")
+	}
+	vals := tbl.GetRandRow(key.Columns)
+	if vals == nil {
+		vals = tbl.GenRandValues(key.Columns)
+	}
+	conds := make([]string, len(key.Columns))
+	for i, c := range key.Columns {
+		conds[i] = fmt.Sprintf("%s = %s", c.Name, vals[i])
+	}
+	col := nextValColumns(tbl).Rand()
+	seq := state.Sequences.Rand()
+	seq.SkipValues()
+	return Strs("update", tbl.Name, "set", col.Name, "=", fmt.Sprintf("nextval(%s)", seq.Name),
+		"where", strings.Join(conds, " and "))
+}).P(HasNextValColumns)
+
+// SequenceQuery reads or changes a sequence by NEXTVAL, LASTVAL and SETVAL, e.g. select nextval(seq_1), lastval(seq_1).
+var SequenceQuery = NewFn(func(state *State) Fn {
+	seq := state.Sequences.Rand()
+	var nextVal = NewFn(func(state *State) Fn {
+		seq.NextVal()
+		return Or(
+			Strs(fmt.Sprintf("select nextval(%s)", seq.Name)),
+			Strs("select next value for", seq.Name),
+			Strs(fmt.Sprintf("select nextval(%s), lastval(%s)", seq.Name, seq.Name)),
+		)
+	})
+	var lastVal = NewFn(func(state *State) Fn {
+		return Str(fmt.Sprintf("select lastval(%s)", seq.Name))
+	})
+	var setVal = NewFn(func(state *State) Fn {
+		v := randSetValArg(seq)
+		seq.SetVal(v)
+		return Str(fmt.Sprintf("select setval(%s, %d)", seq.Name, v))
+	})
+	return Or(
+		nextVal.W(3),
+		lastVal.W(1),
+		setVal.W(1),
+	)
+}).P(HasSequences)
+
+// randSetValArg returns a value of the sequence for SETVAL, which is likely to be ahead of the next value.
+func randSetValArg(seq *Sequence) int64 {
+	base := seq.Start
+	if seq.NextKnown && seq.Next >= seq.MinValue && seq.Next <= seq.MaxValue && RandomBool() {
+		base = seq.Next
+	}
+	v := base + rand.Int63n(4)*seq.Increment
+	if v < seq.MinValue || v > seq.MaxValue {
+		return base
+	}
+	return v
+}
+
+// SequenceOracle returns a query which takes the next value of a random predictable sequence, and the value
+// expected by the model. It returns false if no sequence is predictable or the values have run out.
+func SequenceOracle(state *State) (query string, expected string, ok bool) {
+	seq := state.Sequences.Filter(func(s *Sequence) bool {
+		return s.Predictable()
+	}).Rand()
+	if seq == nil {
+		return "", "", false
+	}
+	v, ok := seq.NextVal()
+	if !ok {
+		return "", "", false
+	}
+	return fmt.Sprintf("select nextval(%s) as v", seq.Name), strconv.FormatInt(v, 10), true
+}
@@ -0,0 +1,213 @@
+package sqlgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// ExprSubQuery generates a subquery in an expression of the type state.env.ExprTp.
+// The outer tables are referenced in the where clause of the subquery, so most of them are correlated.
+var ExprSubQuery = NewFn(func(state *State) Fn {
+	if state.env.ExprTp != ColumnTypeBoolean {
+		return ExprScalarSubQuery
+	}
+	return Or(
+		ExprScalarSubQuery,
+		ExprExistsSubQuery.W(2),
+		ExprInSubQuery.W(2),
+		ExprQuantifiedSubQuery.W(2),
+	)
+})
+
+// ExprScalarSubQuery generates a subquery which returns at most one row.
+var ExprScalarSubQuery = NewFn(func(state *State) Fn {
+	tp := state.env.ExprTp
+	if tp == ColumnTypeJSON {
+		return None("JSON values are not comparable")
+	}
+	subTbl, where, ok := enterSubQuery(state)
+	if !ok {
+		return None("no table for the subquery")
+	}
+	e := ExprOfType(tp)
+	from := Strs("from", PrintTableReference(subTbl))
+	orderable := len(subTbl.Columns.Filter(func(c *Column) bool {
+		return c.Tp == ColumnTypeJSON
+	})) == 0
+	return Or(
+		And(Str("(select max("), e, Str(")"), from, where, Str(")")),
+		And(Str("(select min("), e, Str(")"), from, where, Str(")")),
+		And(Str("(select count(*)"), from, where, Str(")")).P(func(state *State) bool {
+			return tp.IsIntegerType()
+		}),
+		// Ordering by all the columns makes the first row deterministic.
+		And(Str("(select"), e, from, where,
+			Strs("order by", PrintColumnNamesWithoutPar(subTbl.Columns, ""), "limit 1)")).P(func(state *State) bool {
+			return orderable
+		}),
+	)
+})
+
+var ExprExistsSubQuery = NewFn(func(state *State) Fn {
+	subTbl, where, ok := enterSubQuery(state)
+	if !ok {
+		return None("no table for the subquery")
+	}
+	return And(
+		Or(Str("exists"), Str("not exists")),
+		Strs("(select 1 from", PrintTableReference(subTbl)), where, Str(")"),
+	)
+})
+
+var ExprInSubQuery = NewFn(func(state *State) Fn {
+	opTp, lhs, err := subQueryOperand(state)
+	if err != nil {
+		return NoneBecauseOf(err)
+	}
+	subTbl, where, ok := enterSubQuery(state)
+	if !ok {
+		return None("no table for the subquery")
+	}
+	return And(
+		Strs("(", lhs, ")"), Or(Str("in"), Str("not in")),
+		Str("(select"), ExprOfType(opTp), Strs("from", PrintTableReference(subTbl)), where, Str(")"),
+	)
+})
+
+var ExprQuantifiedSubQuery = NewFn(func(state *State) Fn {
+	opTp, lhs, err := subQueryOperand(state)
+	if err != nil {
+		return NoneBecauseOf(err)
+	}
+	subTbl, where, ok := enterSubQuery(state)
+	if !ok {
+		return None("no table for the subquery")
+	}
+	return And(
+		Strs("(", lhs, ")"), CompareSymbol, Or(Str("any"), Str("some"), Str("all")),
+		Str("(select"), ExprOfType(opTp), Strs("from", PrintTableReference(subTbl)), where, Str(")"),
+	)
+})
+
+// subQueryOperand generates the left operand of IN and the quantified comparisons in the outer query.
+func subQueryOperand(state *State) (ColumnType, string, error) {
+	cols := exprColumns(state, exprTable(state)).Filter(func(c *Column) bool {
+		return c.Tp != ColumnTypeJSON
+	})
+	if len(cols) == 0 {
+		return 0, "", fmt.Errorf("no column of comparable type")
+	}
+	opTp := cols.Rand().Tp
+	lhs, err := ExprOfType(opTp).Eval(state)
+	return opTp, lhs, err
+}
+
+// enterSubQuery switches the env to a subquery over a table which is not in the outer query if possible,
+// or over an alias of an outer table otherwise.
+// It returns the table and the where clause of the subquery, which references a column of the outer query.
+// It must be called in the closure of NewFn, so that the env is restored after the subquery.
+func enterSubQuery(state *State) (*Table, Fn, bool) {
+	outerTbl := exprTable(state)
+	outerCols := exprColumns(state, outerTbl)
+	isOuter := func(t *Table) bool {
+		if state.env.QState != nil {
+			for ot := range state.env.QState.SelectedCols {
+				if ot.ID == t.ID {
+					return true
+				}
+			}
+		}
+		return t.ID == outerTbl.ID
+	}
+	readable := append(state.ReadableTables(), state.env.CTEs...)
+	candidates := readable.Filter(func(t *Table) bool {
+		return !isOuter(t)
+	})
+	if len(candidates) == 0 {
+		if state.env.IsIn("CommonDelete") || state.env.IsIn("CommonUpdate") {
+			// The target table of DELETE and UPDATE cannot be read in a subquery.
+			return nil, Empty, false
+		}
+		candidates = readable
+	}
+	subTbl := candidates.Rand()
+	if isOuter(subTbl) {
+		// The inner table is aliased, so that the correlation references the outer table.
+		subTbl = newTableAlias(state, subTbl)
+	}
+
+	var corr Fn
+	correlated := false
+	for _, i := range rand.Perm(len(outerCols)) {
+		oc := outerCols[i]
+		if oc.Tp == ColumnTypeJSON {
+			continue
+		}
+		ics := subTbl.Columns.Filter(func(c *Column) bool {
+			return oc.Tp.CompatibleWith(c.Tp)
+		})
+		if len(ics) > 0 {
+			inner := fmt.Sprintf("%s.%s", subTbl.Name, ics.Rand().Name)
+			outer := fmt.Sprintf("%s.%s", outerTbl.Name, oc.Name)
+			corr = Or(
+				Strs(inner, "=", outer).W(3),
+				And(Str(inner), CompareSymbol, Str(outer)),
+			)
+			correlated = true
+			break
+		}
+	}
+
+	state.env.SubQueryDepth++
+	state.env.Table = subTbl
+	state.env.QState = &QueryState{SelectedCols: map[*Table]QueryStateColumns{
+		subTbl: {
+			Columns: subTbl.Columns,
+			Attr:    make([]string, len(subTbl.Columns)),
+		},
+	}}
+	if !correlated {
+		return subTbl, Opt(And(Str("where"), Predicates)), true
+	}
+	return subTbl, And(Str("where"), corr, Opt(And(Str("and ("), Predicates, Str(")")))), true
+}
+
+// DerivedTable generates the subquery of a derived table over state.env.Table, which may be a set operation.
+var DerivedTable = NewFn(func(state *State) Fn {
+	tbl := state.env.Table
+	state.env.QState = nil
+	state.env.SubQueryDepth++
+	return Or(
+		And(Strs("(select * from", tbl.Name), WhereClause, Str(")")).W(3),
+		And(Strs("(select * from", tbl.Name), WhereClause, SetOperator,
+			Strs("select * from", tbl.Name), WhereClause, Str(")")),
+	)
+})
+
+// randTableOrDerived returns a random table or CTE, or a derived table over it if the subqueries are not too deep.
+// The columns of a derived table are referenced by its alias.
+func randTableOrDerived(state *State) *Table {
+	tbl := randQueryTable(state)
+	if rand.Intn(5) != 0 || !NoTooDeepSubQuery(state) {
+		return tbl
+	}
+	state.env.Table = tbl
+	query, err := DerivedTable.Eval(state)
+	if err != nil {
+		return tbl
+	}
+	return &Table{
+		ID:      tbl.ID,
+		Name:    fmt.Sprintf("dt_%d", state.alloc.AllocDerivedTableID()),
+		Columns: tbl.Columns,
+		Collate: tbl.Collate,
+		Values:  tbl.Values,
+		Derived: query,
+	}
+}
+
+// disableSubQuery stops generating the subqueries in the current scope.
+func disableSubQuery(state *State) {
+	state.env.SubQueryDepth = math.MaxInt32
+}
@@ -1,11 +1,15 @@
 package sqlgen_test
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/PingCAP-QE/clustered-index-rand-test/sqlgen"
 	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/mysql"
 	_ "github.com/pingcap/tidb/parser/test_driver"
 	"github.com/stretchr/testify/require"
 )
@@ -37,24 +41,71 @@ func TestCreateColumnTypes(t *testing.T) {
 
 	state.ReplaceRule(sqlgen.ColumnDefinitionType, sqlgen.ColumnDefinitionTypesIntegerInt)
 	state.SetRepeat(sqlgen.ColumnDefinition, 5, 5)
-	intColCount := 0
+	colCount, intColCount := 0, 0
 	for i := 0; i < 100; i++ {
 		res, err := sqlgen.CreateTable.Eval(state)
 		require.NoError(t, err)
 		require.Greater(t, len(res), 0, i)
-		intColCount += strings.Count(res, "int")
+		defs, n := parseColumnDefs(t, res, state.Tables[len(state.Tables)-1])
+		colCount += n
+		for _, def := range defs {
+			require.Equal(t, mysql.TypeLong, def.Tp.GetType(), res)
+			intColCount++
+		}
+	}
+	require.Equal(t, 100*5, colCount)
+	require.Greater(t, intColCount, 0)
+}
+
+// parseColumnDefs parses the CREATE TABLE statement of tbl, and returns the definitions of the columns defined by
+// BaseColumnDefinition, whose types are taken from ColumnDefinitionType, and the number of the columns defined by
+// ColumnDefinitions. The columns of the foreign keys are defined by the constraints instead.
+func parseColumnDefs(t *testing.T, query string, tbl *sqlgen.Table) ([]*ast.ColumnDef, int) {
+	stmts, _, err := parser.New().ParseSQL(query)
+	require.Nilf(t, err, "sql: %s", query)
+	stmt := stmts[0].(*ast.CreateTableStmt)
+	require.Len(t, stmt.Cols, len(tbl.Columns), query)
+	var defs []*ast.ColumnDef
+	n := 0
+	for _, def := range stmt.Cols {
+		col := tbl.Columns.Filter(func(c *sqlgen.Column) bool {
+			return c.Name == def.Name.Name.L
+		})
+		require.Len(t, col, 1, query)
+		c := col[0]
+		inForeignKey := false
+		for _, fk := range tbl.ForeignKeys {
+			inForeignKey = inForeignKey || fk.Columns.Contain(c)
+		}
+		if inForeignKey {
+			continue
+		}
+		n++
+		if c.Generated == nil && !c.IsAutoAllocated() && c.DefaultSeq == nil {
+			defs = append(defs, def)
+		}
 	}
-	require.Equal(t, 100*5, intColCount)
+	return defs, n
 }
 
 func TestCreateTableLike(t *testing.T) {
 	state := sqlgen.NewState()
 	defer state.CheckIntegrity()
-	_, err := sqlgen.CreateTable.Eval(state)
-	require.NoError(t, err)
+	// The temporary tables and the tables with constraints are not copied.
+	copyable := func(t *sqlgen.Table) bool {
+		return t.Temporary == sqlgen.TempTableNone && len(t.ForeignKeys) == 0 && len(t.Checks) == 0
+	}
+	for len(state.Tables.Filter(copyable)) == 0 {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
 	for i := 0; i < 100; i++ {
-		_, err = sqlgen.CreateTableLike.Eval(state)
+		query, err := sqlgen.CreateTableLike.Eval(state)
 		require.NoError(t, err)
+		names := strings.Fields(query)
+		src, dst := state.Tables.ByName(names[4]), state.Tables.ByName(names[2])
+		require.True(t, copyable(src), query)
+		require.True(t, dst.SameStructureAs(src), query)
 		state.Env().Table = state.Tables.Rand()
 		_, err = sqlgen.AddColumn.Eval(state)
 		require.NoError(t, err)
@@ -106,8 +157,9 @@ func TestConfigKeyUnitAvoidAlterPKColumn(t *testing.T) {
 	_, err := sqlgen.CreateTable.Eval(state)
 	require.NoError(t, err)
 	tbl := state.Tables.Rand()
-	pk := tbl.Indexes.Rand()
-	require.Equal(t, sqlgen.IndexTypePrimary, pk.Tp)
+	// The auto columns and the foreign keys may be indexed by the other keys.
+	pk := tbl.Indexes.Primary()
+	require.NotNil(t, pk)
 	pkCols := tbl.Columns.Filter(func(c *sqlgen.Column) bool {
 		return pk.HasColumn(c)
 	})
@@ -135,3 +187,1144 @@ func TestSyntax(t *testing.T) {
 		require.Nilf(t, err, "sql: %s", sql)
 	}
 }
+
+func TestExprOfType(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.SetRepeat(sqlgen.ColumnDefinition, 10, 10)
+	_, err := sqlgen.CreateTable.Eval(state)
+	require.NoError(t, err)
+	tbl := state.Tables.Rand()
+	tidbParser := parser.New()
+	for _, tp := range sqlgen.ColumnTypeAllTypes {
+		for i := 0; i < 30; i++ {
+			state.Env().Table = tbl
+			expr, err := sqlgen.ExprOfType(tp).Eval(state)
+			require.NoError(t, err)
+			query := fmt.Sprintf("select %s from %s", expr, tbl.Name)
+			_, warn, err := tidbParser.ParseSQL(query)
+			require.Lenf(t, warn, 0, "sql: %s", query)
+			require.Nilf(t, err, "sql: %s", query)
+		}
+	}
+
+	state.Config().SetMaxExprDepth(1)
+	defer state.Config().SetMaxExprDepth(3)
+	for i := 0; i < 100; i++ {
+		state.Env().Table = tbl
+		expr, err := sqlgen.ExprOfType(sqlgen.ColumnTypeBoolean).Eval(state)
+		require.NoError(t, err)
+		require.NotContains(t, expr, "(", expr)
+	}
+}
+
+func TestExprJSONFunction(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		require.NotContains(t, sqlgen.RandJSONPath(false), "*")
+	}
+
+	state := sqlgen.NewState()
+	state.SetRepeat(sqlgen.ColumnDefinition, 10, 10)
+	_, err := sqlgen.CreateTable.Eval(state)
+	require.NoError(t, err)
+	tbl := state.Tables.Rand()
+	tidbParser := parser.New()
+	var memberOf bool
+	for i := 0; i < 200; i++ {
+		state.Env().Table = tbl
+		state.Env().ExprTp = []sqlgen.ColumnType{sqlgen.ColumnTypeJSON, sqlgen.ColumnTypeBoolean}[i%2]
+		expr, err := sqlgen.ExprJSONFunction.Eval(state)
+		require.NoError(t, err)
+		query := fmt.Sprintf("select %s from %s", expr, tbl.Name)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		memberOf = memberOf || strings.Contains(expr, "member of")
+	}
+	require.True(t, memberOf)
+
+	// MEMBER OF is not generated if it is disabled, e.g. for the TiDB versions before 6.3.
+	state.SetWeight(sqlgen.ExprJSONMemberOf, 0)
+	for i := 0; i < 100; i++ {
+		state.Env().Table = tbl
+		state.Env().ExprTp = sqlgen.ColumnTypeBoolean
+		expr, err := sqlgen.ExprJSONFunction.Eval(state)
+		require.NoError(t, err)
+		require.NotContains(t, expr, "member of")
+	}
+}
+
+func TestCastMatrix(t *testing.T) {
+	state := sqlgen.NewState()
+	require.Len(t, sqlgen.CastMatrix, len(sqlgen.ColumnTypeAllTypes)*len(sqlgen.CastTargets))
+	visited := make(map[sqlgen.CastPair]struct{})
+	for range sqlgen.CastMatrix {
+		pair, ok := state.NextCastPair(func(sqlgen.CastPair) bool { return true })
+		require.True(t, ok)
+		visited[pair] = struct{}{}
+	}
+	require.Len(t, visited, len(sqlgen.CastMatrix))
+
+	tidbParser := parser.New()
+	for _, target := range sqlgen.CastTargets {
+		pair, ok := state.NextCastPair(func(p sqlgen.CastPair) bool { return p.Target == target })
+		require.True(t, ok)
+		query := fmt.Sprintf("select cast(%s as %s), convert(%s, %s)", sqlgen.RandConstantOfType(pair.Src),
+			target.Name, sqlgen.RandConstantOfType(pair.Src), target.Name)
+		_, _, err := tidbParser.ParseSQL(query)
+		require.NoError(t, err, query)
+	}
+	_, ok := state.NextCastPair(func(p sqlgen.CastPair) bool { return p.Target.Tp == sqlgen.ColumnTypeBit })
+	require.False(t, ok)
+}
+
+func TestExprSubQuery(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	// The outer table has a column which can be compared with a column of another table.
+	correlatable := func(t *sqlgen.Table) bool {
+		return t.Columns.Found(func(c *sqlgen.Column) bool {
+			return c.Tp != sqlgen.ColumnTypeJSON && len(state.Tables.Filter(func(other *sqlgen.Table) bool {
+				return other.ID != t.ID && other.Columns.Found(func(oc *sqlgen.Column) bool {
+					return c.Tp.CompatibleWith(oc.Tp)
+				})
+			})) > 0
+		})
+	}
+	for len(state.Tables) < 3 || len(state.Tables.Filter(correlatable)) == 0 {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	tbl := state.Tables.Filter(correlatable).Rand()
+	var correlated bool
+	for i := 0; i < 100; i++ {
+		state.Env().Table = tbl
+		state.Env().ExprTp = sqlgen.ColumnTypeBoolean
+		expr, err := sqlgen.ExprSubQuery.Eval(state)
+		require.NoError(t, err)
+		query := fmt.Sprintf("select * from %s where %s", tbl.Name, expr)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		correlated = correlated || strings.Contains(expr, "= "+tbl.Name+".")
+	}
+	require.True(t, correlated)
+
+	// The subquery reads an alias of the outer table if there is no other table.
+	single := sqlgen.NewState()
+	_, err := sqlgen.CreateTable.Eval(single)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		single.Env().Table = single.Tables[0]
+		single.Env().ExprTp = sqlgen.ColumnTypeBoolean
+		expr, err := sqlgen.ExprSubQuery.Eval(single)
+		require.NoError(t, err)
+		require.Contains(t, expr, single.Tables[0].Name+" as ta_", expr)
+		require.NotRegexp(t, "from "+single.Tables[0].Name+" (where|\\))", expr)
+	}
+
+	// No subquery is generated if the depth limit is reached.
+	state.Config().SetMaxSubQueryDepth(0)
+	defer state.Config().SetMaxSubQueryDepth(2)
+	for i := 0; i < 100; i++ {
+		query, err := sqlgen.SingleSelect.Eval(state)
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(query, "select"), query)
+	}
+}
+
+func TestMultiSelectJoin(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.Config().SetMaxJoinTables(5)
+	defer state.Config().SetMaxJoinTables(4)
+	_, err := sqlgen.CreateTable.Eval(state)
+	require.NoError(t, err)
+	tidbParser := parser.New()
+	var selfJoin, using, natural bool
+	for i := 0; i < 200; i++ {
+		query, err := sqlgen.MultiSelect.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		selfJoin = selfJoin || strings.Contains(query, " as ta_")
+		using = using || strings.Contains(query, " using (")
+		natural = natural || strings.Contains(query, "natural ")
+	}
+	require.True(t, selfJoin)
+	require.True(t, using)
+	require.True(t, natural)
+}
+
+func TestAggregation(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	for i := 0; i < 2; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	var groupBy, having, distinct, rollup, grouping bool
+	for i := 0; i < 500; i++ {
+		query, err := sqlgen.SingleSelect.Eval(state)
+		require.NoError(t, err)
+		stmts, _, err := tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		stmt, ok := stmts[0].(*ast.SelectStmt)
+		if !ok || stmt.GroupBy == nil {
+			require.NotContains(t, query, "grouping(", query)
+			continue
+		}
+		groupBy = true
+		if strings.Contains(query, "grouping(") {
+			// GROUPING() is only generated with rollup.
+			require.True(t, stmt.GroupBy.Rollup, query)
+			grouping = true
+		}
+		rollup = rollup || stmt.GroupBy.Rollup
+		having = having || stmt.Having != nil
+		distinct = distinct || stmt.Distinct
+	}
+	require.True(t, groupBy)
+	require.True(t, having)
+	require.True(t, distinct)
+	require.True(t, rollup)
+	require.True(t, grouping)
+
+	// WITH ROLLUP is not generated if it is disabled, e.g. for the TiDB versions before 7.4.
+	state.SetWeight(sqlgen.GroupByWithRollup, 0)
+	for i := 0; i < 100; i++ {
+		query, err := sqlgen.SingleSelect.Eval(state)
+		require.NoError(t, err)
+		require.NotContains(t, query, "with rollup", query)
+		require.NotContains(t, query, "grouping(", query)
+	}
+}
+
+var rangeOffsetRe = regexp.MustCompile(
+	`range (between )?((unbounded preceding|current row) and )?(interval )?\d+ (\w+ )?(preceding|following)`)
+
+func TestWindowFunction(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.SetRepeat(sqlgen.ColumnDefinition, 5, 10)
+	for i := 0; i < 3; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	var named, inherited, inline, rangeOffset, joined bool
+	for i := 0; i < 500; i++ {
+		query, err := sqlgen.Query.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		named = named || strings.Contains(query, " w1 as (")
+		inherited = inherited || strings.Contains(query, "as ( w0")
+		inline = inline || strings.Contains(query, " over ( ")
+		rangeOffset = rangeOffset || rangeOffsetRe.MatchString(query)
+		joined = joined || (strings.Contains(query, " join ") && strings.Contains(query, " over "))
+	}
+	require.True(t, named)
+	require.True(t, inherited)
+	require.True(t, inline)
+	require.True(t, rangeOffset)
+	require.True(t, joined)
+}
+
+var orderByLimitRe = regexp.MustCompile(`^order by (.*?)\s*r0(,r\d+)*\s*(limit \d+)?\s*(for update)?\s*$`)
+
+func TestOrderByLimit(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	// The columns are all approximate, so no expression is ordered before the fields.
+	state.Tables = append(state.Tables, &sqlgen.Table{ID: 1, Name: "tbl_1", Columns: sqlgen.Columns{
+		{ID: 1, Name: "col_1", Tp: sqlgen.ColumnTypeFloat},
+		{ID: 2, Name: "col_2", Tp: sqlgen.ColumnTypeDouble},
+	}})
+	tidbParser := parser.New()
+	var ordered bool
+	for i := 0; i < 300; i++ {
+		query, err := sqlgen.SingleSelect.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		// The ORDER BY clause of the query is the last one, after those of the windows.
+		pos := strings.LastIndex(query, "order by")
+		if pos < 0 {
+			continue
+		}
+		m := orderByLimitRe.FindStringSubmatch(query[pos:])
+		if m == nil {
+			continue
+		}
+		ordered = true
+		if m[1] != "" {
+			require.Regexp(t, `^(count|max|min)\(`, m[1], query)
+		}
+	}
+	require.True(t, ordered)
+}
+
+var setOpOrderByRe = regexp.MustCompile(`order by ([\d,]+) limit \d+$`)
+
+func TestUnionSelect(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.Config().SetMaxSetOpBranches(5)
+	defer state.Config().SetMaxSetOpBranches(4)
+	for i := 0; i < 3; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	var moreBranches, nested bool
+	for i := 0; i < 200; i++ {
+		query, err := sqlgen.UnionSelect.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		// All the branches have the same number of fields.
+		m := setOpOrderByRe.FindStringSubmatch(query)
+		require.NotNil(t, m, query)
+		fieldNum := len(strings.Split(m[1], ","))
+		branches := strings.Count(query, " as r0 ")
+		require.Equal(t, branches, strings.Count(query, fmt.Sprintf(" as r%d ", fieldNum-1)), query)
+		require.NotContains(t, query, fmt.Sprintf(" as r%d ", fieldNum), query)
+		moreBranches = moreBranches || branches > 2
+		nested = nested || strings.Contains(query, "( ( select")
+	}
+	require.True(t, moreBranches)
+	require.True(t, nested)
+}
+
+var cteRecursiveRe = regexp.MustCompile(`select (cte_\d+\.col_\d+) \+ 1, .*from cte_\d+ where (cte_\d+\.col_\d+) < \d`)
+
+func TestCTE(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	for i := 0; i < 3; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	var recursive, joined, inSubQuery bool
+	for i := 0; i < 200; i++ {
+		query, err := sqlgen.CTEQueryStatement.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		// The recursion is bounded by the counter column.
+		recursive = recursive || cteRecursiveRe.MatchString(query)
+		joined = joined || regexp.MustCompile(`join cte_\d+`).MatchString(query)
+		inSubQuery = inSubQuery || regexp.MustCompile(`\(select .* from cte_\d+ where`).MatchString(query)
+	}
+	require.True(t, recursive)
+	require.True(t, joined)
+	require.True(t, inSubQuery)
+
+	for i := 0; i < 100; i++ {
+		query, err := sqlgen.CTEDMLStatement.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		require.Regexp(t, `^with .* (update|delete from) tbl_\d+`, query)
+	}
+}
+
+func TestInsertSelect(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	for i := 0; i < 3; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		state.Env().Table = state.Tables[i]
+		_, err = sqlgen.InsertInto.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	var onDup, tracked bool
+	for i := 0; i < 200; i++ {
+		tbl := state.Tables.Rand()
+		state.Env().Table = tbl
+		for _, fn := range []sqlgen.Fn{sqlgen.CommonInsertSelect, sqlgen.CommonReplaceSelect} {
+			rowCnt := len(tbl.Values)
+			srcRowCnt := make(map[string]int)
+			for _, src := range state.Tables {
+				srcRowCnt[src.Name] = len(src.Values)
+			}
+			query, err := fn.Eval(state)
+			require.NoError(t, err)
+			stmts, _, err := tidbParser.ParseSQL(query)
+			require.Nilf(t, err, "sql: %s", query)
+			insert := stmts[0].(*ast.InsertStmt)
+			sel := insert.Select.(*ast.SelectStmt)
+			require.Equal(t, len(insert.Columns), len(sel.Fields.Fields), query)
+			onDup = onDup || strings.Contains(query, "= values(")
+			// The rows are only tracked if all the selected rows are inserted.
+			if len(tbl.Values) != rowCnt {
+				src := sel.From.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.L
+				require.Equal(t, rowCnt+srcRowCnt[src], len(tbl.Values), query)
+				require.False(t, insert.IsReplace || insert.IgnoreErr || insert.OnDuplicate != nil, query)
+				require.True(t, sel.Where == nil && sel.Limit == nil && len(insert.PartitionNames) == 0, query)
+				tracked = true
+			}
+		}
+		for _, row := range tbl.Values {
+			require.Len(t, row, len(tbl.Columns))
+		}
+	}
+	require.True(t, onDup)
+
+	// The rows inserted into a table without keys, constraints and allocated or generated values are known.
+	state = sqlgen.NewState()
+	for _, fn := range []sqlgen.Fn{sqlgen.IndexDefinitions, sqlgen.ConstraintDefinitions, sqlgen.GeneratedColumnDefinition,
+		sqlgen.AutoIncrementColumnDefinition, sqlgen.AutoRandomColumnDefinition, sqlgen.GlobalTemporaryTable} {
+		state.SetWeight(fn, 0)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		state.Env().Table = state.Tables[i]
+		for j := 0; j < 5; j++ {
+			_, err = sqlgen.InsertInto.Eval(state)
+			require.NoError(t, err)
+		}
+	}
+	for i := 0; i < 100 && !tracked; i++ {
+		tbl := state.Tables[0]
+		state.Env().Table = tbl
+		rowCnt := len(tbl.Values)
+		query, err := sqlgen.CommonInsertSelect.Eval(state)
+		require.NoError(t, err)
+		tracked = len(tbl.Values) > rowCnt
+		if tracked {
+			require.Regexp(t, `^insert into tbl_1 \(.*\) select .* from tbl_\d+$`, query)
+		}
+	}
+	require.True(t, tracked)
+}
+
+func TestMultiTableDML(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	for i := 0; i < 2; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	var selfJoin, multiDelete bool
+	for i := 0; i < 100; i++ {
+		for _, fn := range []sqlgen.Fn{sqlgen.CommonMultiUpdate, sqlgen.CommonMultiDelete} {
+			query, err := fn.Eval(state)
+			require.NoError(t, err)
+			stmts, _, err := tidbParser.ParseSQL(query)
+			require.Nilf(t, err, "sql: %s", query)
+			switch stmt := stmts[0].(type) {
+			case *ast.UpdateStmt:
+				require.NotNil(t, stmt.TableRefs.TableRefs.Right, query)
+			case *ast.DeleteStmt:
+				require.True(t, stmt.IsMultiTable, query)
+				multiDelete = multiDelete || len(stmt.Tables.Tables) == 2
+			}
+			// ORDER BY and LIMIT are not allowed in the multi-table statements.
+			require.NotContains(t, query, " limit ", query)
+			selfJoin = selfJoin || strings.Contains(query, " as ta_")
+		}
+	}
+	require.True(t, selfJoin)
+	require.True(t, multiDelete)
+}
+
+func TestAlterPartition(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	tidbParser := parser.New()
+	// Create a partitioned table, and a table of the same structure which is not partitioned.
+	// The tables with constraints cannot be copied.
+	var tbl *sqlgen.Table
+	for tbl == nil || tbl.Partition == nil || len(tbl.ForeignKeys) > 0 || len(tbl.Checks) > 0 {
+		state.Tables = nil
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		tbl = state.Tables[0]
+	}
+	_, err := sqlgen.CreateTableLike.Eval(state)
+	require.NoError(t, err)
+	other := state.Tables[1]
+	require.Equal(t, tbl.Partition.String(), other.Partition.String())
+	state.Env().Table = other
+	_, err = sqlgen.RemovePartitioning.Eval(state)
+	require.NoError(t, err)
+	_, err = sqlgen.InsertInto.Eval(state)
+	require.NoError(t, err)
+	require.NotEmpty(t, other.Values)
+	state.Env().Table = tbl
+	_, err = sqlgen.InsertInto.Eval(state)
+	require.NoError(t, err)
+	require.NotEmpty(t, tbl.Values)
+	res, err := sqlgen.ExchangePartition.Eval(state)
+	require.NoError(t, err)
+	require.Regexp(t, `^exchange partition p\d+ with table `+other.Name+`$`, res)
+	// The rows in the exchanged partition are unknown.
+	require.Empty(t, tbl.Values)
+	require.Empty(t, other.Values)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 500; i++ {
+		state.Env().Table = tbl
+		if tbl.Partition != nil && len(tbl.Values) == 0 {
+			_, err = sqlgen.InsertInto.Eval(state)
+			require.NoError(t, err)
+		}
+		res, err := sqlgen.AlterPartition.Eval(state)
+		if err != nil {
+			// It is possible that no partition DDL is valid, e.g. no column can be the partitioning column.
+			continue
+		}
+		query := fmt.Sprintf("alter table %s %s", tbl.Name, res)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		kind := strings.Join(strings.Fields(res)[:2], " ")
+		seen[kind] = true
+		if kind == "drop partition" || kind == "truncate partition" {
+			require.Emptyf(t, tbl.Values, "sql: %s", query)
+		}
+		if tbl.Partition == nil {
+			continue
+		}
+		// The partitions recorded in the table are still valid.
+		query = fmt.Sprintf("create table t (a int) %s", tbl.Partition.String())
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		names := make(map[string]bool)
+		for _, def := range tbl.Partition.Defs {
+			require.False(t, names[def.Name], query)
+			names[def.Name] = true
+		}
+	}
+	for _, kind := range []string{"add partition", "drop partition", "truncate partition", "coalesce partition",
+		"reorganize partition", "partition by", "remove partitioning"} {
+		require.True(t, seen[kind], kind)
+	}
+}
+
+func TestPartitionSelection(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	for len(state.Tables) < 3 {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		if tbl := state.Tables[len(state.Tables)-1]; tbl.Partition == nil {
+			state.Tables = state.Tables[:len(state.Tables)-1]
+		}
+	}
+	tidbParser := parser.New()
+	selected := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		state.Env().Table = state.Tables.Rand()
+		for _, fn := range []sqlgen.Fn{sqlgen.Query, sqlgen.CommonInsertOrReplace, sqlgen.CommonUpdate, sqlgen.CommonDelete} {
+			query, err := fn.Eval(state)
+			require.NoError(t, err)
+			_, _, err = tidbParser.ParseSQL(query)
+			require.Nilf(t, err, "sql: %s", query)
+			if strings.Contains(query, " partition ( p") {
+				selected[strings.Fields(query)[0]] = true
+			}
+		}
+	}
+	for _, kind := range []string{"select", "insert", "replace", "update", "delete"} {
+		require.True(t, selected[kind], kind)
+	}
+}
+
+func TestPartitionKinds(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	tidbParser := parser.New()
+	kinds := make(map[string]bool)
+	kindRe := regexp.MustCompile(`partition by (hash|key|range columns|range|list columns|list) \( ?(year|to_days|floor)?`)
+	for i := 0; i < 300; i++ {
+		state.Tables = nil
+		query, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		for _, m := range kindRe.FindAllStringSubmatch(query, -1) {
+			kinds[m[1]] = true
+			if m[2] != "" {
+				kinds[m[2]] = true
+			}
+		}
+		tbl := state.Tables[0]
+		for j := 0; j < 3; j++ {
+			state.Env().Table = tbl
+			// It is possible that no column can be indexed.
+			_, _ = sqlgen.AddIndex.Eval(state)
+		}
+		// Every unique key includes all the partitioning columns.
+		for _, idx := range tbl.Indexes {
+			if !idx.IsUnique() {
+				continue
+			}
+			for _, c := range tbl.PartitionColumns() {
+				require.Truef(t, idx.HasColumn(c), "%s: %s", tbl.String(), idx.String())
+			}
+		}
+	}
+	for _, kind := range []string{"hash", "key", "range", "range columns", "list", "list columns", "year", "to_days", "floor"} {
+		require.True(t, kinds[kind], kind)
+	}
+}
+
+func TestGeneratedColumnAndExprIndex(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.SetRepeat(sqlgen.ColumnDefinition, 5, 10)
+	tidbParser := parser.New()
+	var virtual, stored, exprIdx bool
+	for i := 0; i < 100 || !(virtual && stored && exprIdx); i++ {
+		query, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		virtual = virtual || strings.Contains(query, ") virtual")
+		stored = stored || strings.Contains(query, ") stored")
+		exprIdx = exprIdx || strings.Contains(query, "( lower(") || strings.Contains(query, "( upper(") ||
+			strings.Contains(query, "( md5(") || strings.Contains(query, "( reverse(")
+	}
+	generated := make(map[string]bool)
+	for _, tbl := range state.Tables {
+		for _, c := range tbl.Columns {
+			if c.Generated != nil {
+				generated[c.Name] = true
+			}
+		}
+	}
+	var exprPred bool
+	for i := 0; i < 300; i++ {
+		state.Env().Table = state.Tables.Rand()
+		for _, fn := range []sqlgen.Fn{sqlgen.CommonInsertOrReplace, sqlgen.CommonUpdate, sqlgen.InsertInto} {
+			query, err := fn.Eval(state)
+			require.NoError(t, err)
+			stmts, _, err := tidbParser.ParseSQL(query)
+			require.Nilf(t, err, "sql: %s", query)
+			// The generated columns are never written directly.
+			var written []*ast.ColumnName
+			switch stmt := stmts[0].(type) {
+			case *ast.InsertStmt:
+				written = append(written, stmt.Columns...)
+				// The columns of INSERT ... SET are parsed into Columns as well.
+				for _, a := range stmt.OnDuplicate {
+					written = append(written, a.Column)
+				}
+				if len(stmt.Columns) == 0 {
+					// The columns are listed explicitly if the table has generated columns.
+					name := stmt.Table.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.L
+					for _, c := range state.Tables.Filter(func(t *sqlgen.Table) bool { return t.Name == name })[0].Columns {
+						require.Falsef(t, generated[c.Name], "sql: %s", query)
+					}
+				}
+			case *ast.UpdateStmt:
+				for _, a := range stmt.List {
+					written = append(written, a.Column)
+				}
+			}
+			for _, c := range written {
+				require.Falsef(t, generated[c.Name.L], "sql: %s", query)
+			}
+		}
+		query, err := sqlgen.Query.Eval(state)
+		require.NoError(t, err)
+		exprPred = exprPred || regexp.MustCompile(`(lower|upper|md5|reverse)\(t[ab]l_\d+\.col_\d+\) (=|in)`).MatchString(query)
+	}
+	require.True(t, exprPred)
+	// The columns referenced by the generated columns and the expression indexes are kept by DDL.
+	for i := 0; i < 100; i++ {
+		query, err := sqlgen.AlterTable.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		state.CheckIntegrity()
+	}
+}
+
+func TestAutoIDColumns(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.SetRepeat(sqlgen.ColumnDefinition, 3, 6)
+	tidbParser := parser.New()
+	var autoInc, autoRand, shard, autoIDCache bool
+	for i := 0; i < 100 || !(autoInc && autoRand && shard && autoIDCache); i++ {
+		query, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		tbl := state.Tables[len(state.Tables)-1]
+		if strings.Contains(query, "shard_row_id_bits") {
+			require.False(t, tbl.Clustered, query)
+			shard = true
+		}
+		autoIDCache = autoIDCache || strings.Contains(query, "auto_id_cache")
+		if col := tbl.AutoColumn(); col != nil {
+			require.True(t, col.LeadsIndex(tbl), query)
+			autoInc = autoInc || col.IsAutoIncrement
+			autoRand = autoRand || col.AutoRandomBits > 0
+		}
+	}
+	var omitted, allocated bool
+	for i := 0; i < 300 || !(omitted && allocated); i++ {
+		tbl := state.Tables.Rand()
+		state.Env().Table = tbl
+		autoCol := tbl.AutoColumn()
+		for _, fn := range []sqlgen.Fn{sqlgen.CommonInsertOrReplace, sqlgen.CommonUpdate, sqlgen.AlterTable} {
+			query, err := fn.Eval(state)
+			require.NoError(t, err)
+			stmts, _, err := tidbParser.ParseSQL(query)
+			require.Nilf(t, err, "sql: %s", query)
+			state.CheckIntegrity()
+			switch stmt := stmts[0].(type) {
+			case *ast.InsertStmt:
+				// The inserted table is chosen by CommonInsertOrReplace.
+				name := stmt.Table.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.L
+				autoCol := state.Tables.Filter(func(t *sqlgen.Table) bool { return t.Name == name })[0].AutoColumn()
+				if autoCol != nil && len(stmt.Columns) > 0 && stmt.Select == nil {
+					listed := false
+					for j, c := range stmt.Columns {
+						if c.Name.L != autoCol.Name {
+							continue
+						}
+						listed = true
+						for _, row := range stmt.Lists {
+							if v, ok := row[j].(ast.ValueExpr); ok {
+								allocated = allocated || v.GetValue() == nil || fmt.Sprint(v.GetValue()) == "0"
+							}
+						}
+					}
+					omitted = omitted || !listed
+				}
+			case *ast.UpdateStmt:
+				// The AUTO_RANDOM column cannot be updated.
+				for _, a := range stmt.List {
+					require.Falsef(t, autoCol != nil && autoCol.AutoRandomBits > 0 && a.Column.Name.L == autoCol.Name,
+						"sql: %s", query)
+				}
+			}
+		}
+		// The AUTO_INCREMENT column is still the first column of a key after the DDL.
+		if autoCol != nil && tbl.Columns.Contain(autoCol) {
+			require.True(t, autoCol.LeadsIndex(tbl), tbl.String())
+		}
+	}
+}
+
+func TestForeignKeyAndCheck(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	// The partitioned tables cannot be referenced.
+	state.SetWeight(sqlgen.PartitionDefinition, 0)
+	tidbParser := parser.New()
+	var child *sqlgen.Table
+	var check bool
+	for child == nil || !check {
+		query, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		stmts, _, err := tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		tbl := state.Tables[len(state.Tables)-1]
+		var fkNames, checkNames []string
+		for _, cons := range stmts[0].(*ast.CreateTableStmt).Constraints {
+			switch cons.Tp {
+			case ast.ConstraintForeignKey:
+				fkNames = append(fkNames, cons.Name)
+				require.True(t, state.Tables.ByName(cons.Refer.Table.Name.L).ReferableKeys().Found(func(i *sqlgen.Index) bool {
+					return len(i.Columns) == len(cons.Refer.IndexPartSpecifications)
+				}), query)
+			case ast.ConstraintCheck:
+				checkNames = append(checkNames, cons.Name)
+			}
+		}
+		require.Len(t, fkNames, len(tbl.ForeignKeys), query)
+		require.Len(t, checkNames, len(tbl.Checks), query)
+		// The foreign key columns have the full types of the referenced columns.
+		for _, fk := range tbl.ForeignKeys {
+			for i, c := range fk.Columns {
+				require.True(t, c.Tp.IsForeignKeyType(), query)
+				require.True(t, c.SameFullTypeAs(fk.RefColumns[i]), query)
+			}
+		}
+		if len(tbl.ForeignKeys) > 0 {
+			child = tbl
+		}
+		check = check || len(tbl.Checks) > 0
+	}
+	fk := child.ForeignKeys[0]
+	parent := fk.RefTable
+	for i := 0; i < 10; i++ {
+		for _, tbl := range []*sqlgen.Table{parent, child} {
+			state.Env().Table = tbl
+			_, err := sqlgen.InsertInto.Eval(state)
+			require.NoError(t, err)
+		}
+	}
+	// The inserted rows of the child table reference the rows of the parent table.
+	for _, row := range child.Values {
+		if key := child.ValuesOf(row, fk.Columns); !strings.Contains(strings.Join(key, ","), "null") {
+			require.True(t, parent.HasRow(fk.RefColumns, key), key)
+		}
+	}
+	// The referential actions are applied to the rows of all the child tables.
+	fks, _ := state.ReferencingKeys(parent)
+	setReferOptions := func(onDelete, onUpdate sqlgen.ReferOption) {
+		for _, fk := range fks {
+			fk.OnDelete, fk.OnUpdate = onDelete, onUpdate
+		}
+	}
+	var key []string
+	for _, row := range child.Values {
+		if k := child.ValuesOf(row, fk.Columns); !strings.Contains(strings.Join(k, ","), "null") {
+			key = k
+		}
+	}
+	if key == nil {
+		return
+	}
+	// The deletion is restricted by the child rows.
+	setReferOptions(sqlgen.ReferOptionRestrict, sqlgen.ReferOptionCascade)
+	require.False(t, state.DeleteRows(parent, fk.RefColumns, key))
+	require.True(t, parent.HasRow(fk.RefColumns, key))
+	require.True(t, child.HasRow(fk.Columns, key))
+	// The child rows are updated or deleted along with the parent rows.
+	newKey := append([]string{}, key...)
+	newKey[0] = "'new'"
+	require.True(t, state.UpdateRows(parent, fk.RefColumns, key, fk.RefColumns[0], newKey[0]))
+	require.False(t, child.HasRow(fk.Columns, key))
+	require.True(t, child.HasRow(fk.Columns, newKey))
+	setReferOptions(sqlgen.ReferOptionSetNull, sqlgen.ReferOptionCascade)
+	require.True(t, state.DeleteRows(parent, fk.RefColumns, newKey))
+	require.False(t, parent.HasRow(fk.RefColumns, newKey))
+	require.False(t, child.HasRow(fk.Columns, newKey))
+	// The referenced table cannot be dropped, and the referenced columns cannot be dropped or modified.
+	for i := 0; i < 30; i++ {
+		for _, fn := range []sqlgen.Fn{sqlgen.DropTable, sqlgen.AlterTable, sqlgen.ViolateConstraint.P(sqlgen.HasConstraints)} {
+			if len(state.Tables) == 0 {
+				return
+			}
+			referenced := state.IsReferenced(parent)
+			state.Env().Table = state.Tables.Rand()
+			query, err := fn.Eval(state)
+			if err != nil || query == "" {
+				continue
+			}
+			_, _, err = tidbParser.ParseSQL(query)
+			require.Nilf(t, err, "sql: %s", query)
+			state.CheckIntegrity()
+			if referenced {
+				require.True(t, state.Tables.Contain(parent), query)
+				for _, c := range fk.RefColumns {
+					require.Contains(t, parent.Columns, c, query)
+				}
+			}
+		}
+	}
+}
+
+func TestSwitchCheckConstraint(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	state.SetWeight(sqlgen.ForeignKeyDefinition, 0)
+	for len(state.Tables) == 0 || len(state.Tables[0].Checks) == 0 {
+		state.Tables = nil
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tbl := state.Tables[0]
+	checks := len(tbl.Checks)
+	for {
+		query, err := sqlgen.SwitchCheckConstraint.Eval(state)
+		require.NoError(t, err)
+		if strings.HasSuffix(query, "= 0") {
+			break
+		}
+	}
+	// The CHECK constraints are neither added, dropped nor violated while they are disabled.
+	state.Env().Table = tbl
+	require.False(t, sqlgen.HasConstraints(state))
+	for i := 0; i < 20; i++ {
+		query, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		require.NotContains(t, query, "check (", query)
+		require.Empty(t, state.Tables[len(state.Tables)-1].Checks, query)
+		state.Env().Table = tbl
+		query, err = sqlgen.AlterConstraint.Eval(state)
+		require.NoError(t, err)
+		require.NotContains(t, query, "chk_", query)
+		require.Len(t, tbl.Checks, checks, query)
+	}
+	for {
+		query, err := sqlgen.SwitchCheckConstraint.Eval(state)
+		require.NoError(t, err)
+		if strings.HasSuffix(query, "= 1") {
+			break
+		}
+	}
+	state.Env().Table = tbl
+	require.True(t, sqlgen.HasConstraints(state))
+	query, err := sqlgen.ViolateConstraint.Eval(state)
+	require.NoError(t, err)
+	violated := false
+	for _, chk := range tbl.Checks {
+		violated = violated || strings.Contains(query, chk.Violation)
+	}
+	require.True(t, violated, query)
+}
+
+func TestView(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	// The views are only created over the persistent tables.
+	for len(state.Tables) < 3 || !sqlgen.HasPersistentTables(state) {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	tidbParser := parser.New()
+	for i := 0; i < 20; i++ {
+		query, err := sqlgen.CreateView.Eval(state)
+		require.NoError(t, err)
+		stmts, _, err := tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		view := state.Views[len(state.Views)-1]
+		stmt := stmts[0].(*ast.CreateViewStmt)
+		require.Equal(t, view.Name, stmt.ViewName.Name.L)
+		require.Len(t, stmt.Cols, len(view.Columns))
+		require.True(t, state.IsValidView(view))
+	}
+	require.Len(t, state.Views, 20)
+
+	// The views are read like the tables, but never written.
+	var joined, inSubQuery bool
+	for i := 0; i < 300; i++ {
+		query, err := sqlgen.Query.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		joined = joined || regexp.MustCompile(`join v_\d+`).MatchString(query)
+		inSubQuery = inSubQuery || regexp.MustCompile(`\(select .* from v_\d+ where`).MatchString(query)
+	}
+	require.True(t, joined)
+	require.True(t, inSubQuery)
+	for i := 0; i < 50; i++ {
+		state.Env().Table = state.Tables.Rand()
+		for _, fn := range []sqlgen.Fn{sqlgen.CommonUpdate, sqlgen.CommonDelete} {
+			query, err := fn.Eval(state)
+			require.NoError(t, err)
+			require.NotRegexp(t, `\bv_\d+\b`, query)
+		}
+	}
+
+	query, inlined, ok := sqlgen.ViewOracle(state)
+	require.True(t, ok)
+	for _, q := range []string{query, inlined} {
+		_, _, err := tidbParser.ParseSQL(q)
+		require.Nilf(t, err, "sql: %s", q)
+	}
+	view := state.Views.ByName(strings.TrimPrefix(query, "select * from "))
+	require.Contains(t, inlined, view.View.Query)
+
+	// A view is replaced in place, and the views reading the old definition become invalid.
+	query, err := sqlgen.AlterView.Eval(state)
+	require.NoError(t, err)
+	require.Regexp(t, `^create or replace view v_\d+`, query)
+	require.Len(t, state.Views, 20)
+	view = state.Views.ByName(regexp.MustCompile(`v_\d+`).FindString(query))
+	for _, v := range state.Views {
+		if v.ID > view.ID && regexp.MustCompile(`\b`+view.Name+`\b`).MatchString(v.View.Query) {
+			require.False(t, state.IsValidView(v), v.View.Query)
+		}
+	}
+
+	// The views reading a dropped table become invalid.
+	tbl := state.Tables[0]
+	state.RemoveTable(tbl)
+	for _, v := range state.Views {
+		if regexp.MustCompile(`\b` + tbl.Name + `\b`).MatchString(v.View.Query) {
+			require.False(t, state.IsValidView(v), v.View.Query)
+			require.False(t, state.ReadableTables().Contain(v))
+		}
+	}
+	for len(state.Views) > 0 {
+		query, err := sqlgen.DropView.Eval(state)
+		require.NoError(t, err)
+		require.Regexp(t, `^drop view +(if exists )?v_\d+$`, query)
+	}
+}
+
+func TestTemporaryTable(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	tidbParser := parser.New()
+	state.SetWeight(sqlgen.LocalTemporaryTable, 0)
+	state.SetWeight(sqlgen.GlobalTemporaryTable, 0)
+	for i := 0; i < 3; i++ {
+		_, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+	}
+	state.SetWeight(sqlgen.LocalTemporaryTable, 20)
+	state.SetWeight(sqlgen.GlobalTemporaryTable, 20)
+	kinds := map[sqlgen.TempTableType]int{}
+	for kinds[sqlgen.TempTableLocal] == 0 || kinds[sqlgen.TempTableGlobal] == 0 {
+		query, err := sqlgen.CreateTable.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		tbl := state.Tables[len(state.Tables)-1]
+		kinds[tbl.Temporary]++
+		switch tbl.Temporary {
+		case sqlgen.TempTableLocal:
+			require.True(t, strings.HasPrefix(query, "create temporary table "+tbl.Name), query)
+		case sqlgen.TempTableGlobal:
+			require.True(t, strings.HasPrefix(query, "create global temporary table "+tbl.Name), query)
+			require.True(t, strings.HasSuffix(query, "on commit delete rows"), query)
+		}
+		if tbl.Temporary != sqlgen.TempTableNone {
+			require.Nil(t, tbl.Partition)
+			require.Empty(t, tbl.ForeignKeys)
+			require.NotContains(t, query, "auto_random")
+			require.NotContains(t, query, "shard_row_id_bits")
+		}
+	}
+
+	// The rows of a global temporary table are only kept in an explicit transaction.
+	state.Env().Table = state.Tables.Filter(func(t *sqlgen.Table) bool {
+		return t.Temporary == sqlgen.TempTableGlobal
+	}).Rand()
+	_, err := sqlgen.InsertInto.Eval(state)
+	require.NoError(t, err)
+	require.Empty(t, state.Env().Table.Values)
+	state.BeginTxn()
+	_, err = sqlgen.InsertInto.Eval(state)
+	require.NoError(t, err)
+	require.Len(t, state.Env().Table.Values, 1)
+	state.EndTxn()
+	require.Empty(t, state.Env().Table.Values)
+
+	// The statements which are not supported on the temporary tables never touch them.
+	state.Hook().Append(sqlgen.NewFnHookTxnWrap(state, 5))
+	unsupported := regexp.MustCompile(`^(split table|admin check table|admin check index|alter table|analyze table|` +
+		`flashback table|create table \w+ like) (tbl_\d+)`)
+	temporary := map[string]bool{}
+	var begun, ended bool
+	for i := 0; i < 300; i++ {
+		for _, tbl := range state.Tables {
+			if tbl.Temporary != sqlgen.TempTableNone {
+				temporary[tbl.Name] = true
+			}
+		}
+		query, err := sqlgen.Start.Eval(state)
+		require.NoError(t, err)
+		for _, stmt := range strings.Split(query, " ; ") {
+			_, _, err = tidbParser.ParseSQL(stmt)
+			require.Nilf(t, err, "sql: %s", stmt)
+			if m := unsupported.FindStringSubmatch(stmt); m != nil {
+				require.Falsef(t, temporary[m[2]], "sql: %s", stmt)
+			}
+			begun = begun || strings.HasPrefix(stmt, "begin")
+			ended = ended || stmt == "commit" || stmt == "rollback"
+		}
+		for _, tbl := range state.Tables {
+			if !state.KeepsRows(tbl) {
+				require.Emptyf(t, tbl.Values, "sql: %s", query)
+			}
+		}
+		for _, v := range state.Views {
+			for _, dep := range v.View.Deps {
+				require.False(t, temporary[dep.Name], v.View.Query)
+			}
+		}
+	}
+	require.True(t, begun)
+	require.True(t, ended)
+}
+
+func TestSequence(t *testing.T) {
+	state := sqlgen.NewState()
+	defer state.CheckIntegrity()
+	tidbParser := parser.New()
+	for i := 0; i < 5; i++ {
+		query, err := sqlgen.CreateSequence.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		require.True(t, strings.HasPrefix(query, "create sequence seq_"), query)
+	}
+	require.Len(t, state.Sequences, 5)
+
+	// The model follows NEXTVAL, SETVAL and CYCLE.
+	seq := &sqlgen.Sequence{Start: 3, Increment: 2, MinValue: 1, MaxValue: 7, Cycle: true}
+	seq.Restart()
+	for _, expected := range []int64{3, 5, 7, 1, 3} {
+		v, ok := seq.NextVal()
+		require.True(t, ok)
+		require.Equal(t, expected, v)
+	}
+	seq.SetVal(1)
+	require.Equal(t, int64(5), seq.Next)
+	seq.SetVal(7)
+	require.Equal(t, int64(9), seq.Next)
+	seq.Cycle = false
+	_, ok := seq.NextVal()
+	require.False(t, ok)
+	seq.Restart()
+	seq.SkipValues()
+	_, ok = seq.NextVal()
+	require.False(t, ok)
+
+	// The sequences are used by the default values, DML and queries.
+	state.SetWeight(sqlgen.SequenceColumnDefinition, 10)
+	state.SetWeight(sqlgen.CreateSequence, 5)
+	state.SetWeight(sqlgen.DropSequence, 5)
+	state.SetWeight(sqlgen.InsertNextVal, 20)
+	state.SetWeight(sqlgen.UpdateNextVal, 20)
+	state.SetWeight(sqlgen.SequenceQuery, 20)
+	var defaults, dmls int
+	for i := 0; i < 300; i++ {
+		query, err := sqlgen.Start.Eval(state)
+		require.NoError(t, err)
+		_, _, err = tidbParser.ParseSQL(query)
+		require.Nilf(t, err, "sql: %s", query)
+		if strings.Contains(query, "default nextval(") {
+			defaults++
+		}
+		if regexp.MustCompile(`^(insert|update).*nextval\(`).MatchString(query) {
+			dmls++
+		}
+	}
+	require.Greater(t, defaults, 0)
+	require.Greater(t, dmls, 0)
+	for _, tbl := range state.Tables {
+		for _, c := range tbl.Columns {
+			if c.DefaultSeq != nil {
+				require.True(t, state.IsSequenceInUse(c.DefaultSeq))
+				require.Equal(t, c.DefaultSeq, state.Sequences.ByName(c.DefaultSeq.Name))
+			}
+		}
+	}
+
+	// The oracle expects the next value of an uncached sequence.
+	for _, s := range state.Sequences {
+		s.SkipValues()
+	}
+	seq = state.GenNewSequence()
+	seq.Cache = 0
+	seq.Restart()
+	state.Sequences = append(state.Sequences, seq)
+	query, expected, ok := sqlgen.SequenceOracle(state)
+	require.True(t, ok)
+	require.Equal(t, fmt.Sprintf("select nextval(%s) as v", seq.Name), query)
+	require.Equal(t, "1", expected)
+	_, expected, ok = sqlgen.SequenceOracle(state)
+	require.True(t, ok)
+	require.Equal(t, "2", expected)
+	seq.Cache = 1000
+	_, _, ok = sqlgen.SequenceOracle(state)
+	require.False(t, ok)
+}
@@ -6,12 +6,12 @@ import (
 )
 
 var AdminCheck = NewFn(func(state *State) Fn {
-	state.env.Table = state.Tables.Rand()
+	state.env.Table = state.PersistentTables().Rand()
 	return Or(
 		AdminCheckTable,
 		AdminCheckIndex.P(HasModifiableIndexes),
 	)
-}).P(HasTables)
+}).P(HasPersistentTables)
 
 var AdminCheckTable = NewFn(func(state *State) Fn {
 	tbl := state.env.Table
@@ -33,20 +33,40 @@ var AdminCheckIndex = NewFn(func(state *State) Fn {
 	return Strs("admin check index", tbl.Name, idx.Name)
 })
 
+// FlashBackTable restores a dropped or truncated table. The referenced tables and columns of its foreign keys
+// and the sequences of its default values must exist, and the truncated table to be replaced cannot be referenced.
 var FlashBackTable = NewFn(func(state *State) Fn {
-	tbl := state.droppedTables.Rand()
+	tbl := state.droppedTables.Filter(func(t *Table) bool {
+		if t.Columns.Found(func(c *Column) bool {
+			return c.DefaultSeq != nil && state.Sequences.ByName(c.DefaultSeq.Name) != c.DefaultSeq
+		}) {
+			return false
+		}
+		for _, fk := range t.ForeignKeys {
+			if !state.Tables.Contain(fk.RefTable) || fk.RefColumns.Found(func(c *Column) bool {
+				return !fk.RefTable.Columns.Contain(c)
+			}) {
+				return false
+			}
+		}
+		cur := state.Tables.ByName(t.Name)
+		return cur == nil || !state.IsReferenced(cur)
+	}).Rand()
+	if tbl == nil {
+		return None("no table can be restored")
+	}
 	state.FlashbackTable(tbl)
 	return Strs("flashback table", tbl.Name)
 })
 
 var SetTiFlashReplica = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.PersistentTables().Rand()
 	tbl.TiflashReplica = 1
 	return Strs("alter table", tbl.Name, "set tiflash replica 1")
 })
 
 var SplitRegion = NewFn(func(state *State) Fn {
-	tbl := state.Tables.Rand()
+	tbl := state.PersistentTables().Rand()
 	splitTablePrefix := fmt.Sprintf("split table %s", tbl.Name)
 
 	splittingIndex := len(tbl.Indexes) > 0 && RandomBool()
@@ -0,0 +1,116 @@
+package sqlgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"unicode"
+
+	"github.com/cznic/mathutil"
+)
+
+// CreateView defines a new view over a query, e.g. create view v_7 (col_20, col_21) as select ... .
+var CreateView = NewFn(func(state *State) Fn {
+	view := state.GenNewView()
+	return And(Str("create"), Opt(Str("or replace")), viewDefinition(view))
+}).P(HasPersistentTables)
+
+// AlterView redefines a view by another query. TiDB does not support ALTER VIEW,
+// so the view is replaced by CREATE OR REPLACE VIEW instead.
+var AlterView = NewFn(func(state *State) Fn {
+	return And(Str("create or replace"), viewDefinition(state.Views.Rand()))
+}).P(HasPersistentTables, HasViews)
+
+var DropView = NewFn(func(state *State) Fn {
+	view := state.Views.Rand()
+	state.RemoveView(view)
+	return And(Str("drop view"), Opt(Str("if exists")), Str(view.Name))
+}).P(HasViews)
+
+// viewDefinition defines the view by a query whose fields are of random types, and records it in the state.
+// The columns of the view are named explicitly, so the fields of the query can be referenced by the new names.
+func viewDefinition(view *Table) Fn {
+	ret := defaultFn()
+	ret.Info = "ViewDefinition"
+	ret.Gen = func(state *State) (string, error) {
+		state.env.View = view
+		fieldTps := randFieldTypes(state)
+		query, err := viewQuery(fieldTps).Eval(state)
+		if err != nil {
+			return "", err
+		}
+		cols := make(Columns, 0, len(fieldTps))
+		for _, tp := range fieldTps {
+			col := state.GenNewColumnWithType(tp)
+			// The nullability of a field depends on the expression.
+			col.IsNotNull, col.DefaultVal = false, ""
+			cols = append(cols, col)
+		}
+		view.Columns = cols
+		view.View = &View{Query: query, Deps: viewDeps(state, query)}
+		if !state.Views.Contain(view) {
+			state.Views = state.Views.Append(view)
+		}
+		return fmt.Sprintf("view %s %s as %s", view.Name, PrintColumnNamesWithPar(cols, ""), query), nil
+	}
+	return ret
+}
+
+// viewQuery returns a Fn which generates the query of a view, which is a single-table query, a join,
+// a set operation or a query with CTEs. The fields are of the types fieldTps and named by r0, r1, ...
+func viewQuery(fieldTps []ColumnType) Fn {
+	ret := defaultFn()
+	ret.Info = "ViewQuery"
+	ret.Gen = func(state *State) (string, error) {
+		switch rand.Intn(5) {
+		case 0:
+			state.env.QState = &QueryState{FieldTypes: fieldTps, SelectedCols: randJoinedTables(state)}
+			return CommonSelect.Eval(state)
+		case 1:
+			n := 2 + rand.Intn(mathutil.Max(maxSetOpBranches-1, 1))
+			return setOpTree(state, n, fieldTps, true)
+		case 2:
+			return And(WithClause(state, state.ReadableTables()), setOpBranch(fieldTps)).Eval(state)
+		}
+		return setOpBranch(fieldTps).Eval(state)
+	}
+	return ret
+}
+
+// viewDeps returns the tables and the views whose names appear in the query of a view.
+func viewDeps(state *State, query string) []*ViewDep {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		words[w] = true
+	}
+	var deps []*ViewDep
+	for _, t := range append(state.Tables.Copy(), state.Views...) {
+		if !words[t.Name] {
+			continue
+		}
+		dep := &ViewDep{Name: t.Name}
+		for _, c := range t.Columns {
+			dep.Columns = append(dep.Columns, c.Name)
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// ViewOracle returns a query over a random valid view, and the same query over the inlined query of the view.
+// Both are expected to return the same rows. It returns false if there is no valid view.
+func ViewOracle(state *State) (query string, inlined string, ok bool) {
+	view := state.Views.Filter(state.IsValidView).Rand()
+	if view == nil {
+		return "", "", false
+	}
+	fields := make([]string, 0, len(view.Columns))
+	for i, c := range view.Columns {
+		fields = append(fields, fmt.Sprintf("r%d as %s", i, c.Name))
+	}
+	query = fmt.Sprintf("select * from %s", view.Name)
+	inlined = fmt.Sprintf("select %s from (%s) as %s", strings.Join(fields, ", "), view.View.Query, view.Name)
+	return query, inlined, true
+}